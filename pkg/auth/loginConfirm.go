@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/handewo/gojump/pkg/core"
@@ -31,11 +32,17 @@ type LoginConfirmService struct {
 	option *connectionConfirmOption
 
 	reviewers []string
-
-	approver string
-	ticketId string
+	steps     []model.TicketStep
+
+	approver   string
+	ticketId   string
+	expireAt   int64
+	validUntil int64
+	// the last polled model.TicketState
+	state atomic.Value
 }
 
+// CheckIsNeedLoginConfirm returns false with the ticket ID if the login is within the time window of an approved ticket
 func (c *LoginConfirmService) CheckIsNeedLoginConfirm() (bool, error) {
 	userid := c.option.user.ID
 	username := c.option.user.Username
@@ -48,10 +55,39 @@ func (c *LoginConfirmService) CheckIsNeedLoginConfirm() (bool, error) {
 		return false, err
 	}
 	c.ticketId = res.TicketId
-	c.reviewers = res.Reviewers
+	c.validUntil = res.ValidUntil
 	return res.NeedConfirm, nil
 }
 
+// RequestLoginConfirm creates the ticket of the login with the reason and the change or incident ID
+func (c *LoginConfirmService) RequestLoginConfirm(reason, changeID string) error {
+	res, err := c.core.CreateLoginTicket(c.option.user.Username, c.option.assetID, c.option.assetName,
+		c.option.systemUser.Username, reason, changeID)
+	if err != nil {
+		return err
+	}
+	c.setTicket(res)
+	return nil
+}
+
+func (c *LoginConfirmService) setTicket(res model.AssetLoginTicketInfo) {
+	c.ticketId = res.TicketId
+	c.reviewers = res.Reviewers
+	c.steps = res.Steps
+	c.expireAt = res.ExpireAt
+}
+
+// RequestCommandConfirm creates the ticket of the command, which is waited the same as login
+func (c *LoginConfirmService) RequestCommandConfirm(command string) error {
+	res, err := c.core.CreateCommandTicket(c.option.user.Username, c.option.assetID, c.option.assetName,
+		c.option.systemUser.Username, command)
+	if err != nil {
+		return err
+	}
+	c.setTicket(res)
+	return nil
+}
+
 func (c *LoginConfirmService) WaitLoginConfirm(ctx context.Context) Status {
 	return c.waitConfirmFinish(ctx)
 }
@@ -62,6 +98,17 @@ func (c *LoginConfirmService) GetReviewers() []string {
 	return reviewers
 }
 
+// GetSteps returns the steps of the review flow, empty if the ticket is reviewed by any one of the reviewers
+func (c *LoginConfirmService) GetSteps() []model.TicketStep {
+	return c.steps
+}
+
+// GetState returns the state of the ticket polled last time
+func (c *LoginConfirmService) GetState() (model.TicketState, bool) {
+	s, ok := c.state.Load().(model.TicketState)
+	return s, ok
+}
+
 func (c *LoginConfirmService) GetApprover() string {
 	return c.approver
 }
@@ -70,7 +117,20 @@ func (c *LoginConfirmService) GetTicketId() string {
 	return c.ticketId
 }
 
+// GetExpireAt returns the unix time when the pending ticket expires, 0 never expires
+func (c *LoginConfirmService) GetExpireAt() int64 {
+	return c.expireAt
+}
+
+// GetValidUntil returns the end of the time window of the reused ticket
+func (c *LoginConfirmService) GetValidUntil() int64 {
+	return c.validUntil
+}
+
+// waitConfirmFinish checks the ticket once it's reviewed, and polls it in case an event is dropped
 func (c *LoginConfirmService) waitConfirmFinish(ctx context.Context) Status {
+	events, cancel := c.core.Subscribe(core.EventTicketUpdated)
+	defer cancel()
 	t := time.NewTicker(5 * time.Second)
 	defer t.Stop()
 	for {
@@ -78,26 +138,39 @@ func (c *LoginConfirmService) waitConfirmFinish(ctx context.Context) Status {
 		case <-ctx.Done():
 			c.cancelConfirm()
 			return StatusCancel
-		case <-t.C:
-			statusRes, err := c.core.CheckConfirmStatusByRequestInfo(c.ticketId)
-			if err != nil {
-				log.Error.Printf("Check confirm status err: %s", err.Error())
+		case e := <-events:
+			if e.Ticket.TicketId != c.ticketId {
 				continue
 			}
-			switch statusRes.State {
-			case model.TicketOpen:
-				continue
-			case model.TicketApproved:
-				c.approver = statusRes.Approver
-				return StatusApprove
-			case model.TicketRejected, model.TicketClosed:
-				c.approver = statusRes.Approver
-				return StatusReject
-			default:
-				log.Error.Printf("Receive unknown login confirm status %s",
-					statusRes.State)
+		case <-t.C:
+			// the status is checked after expiring, so the wait ends even if the event is dropped
+			if c.expireAt > 0 && c.expireAt <= time.Now().Unix() {
+				if err := c.core.ExpireTicket(c.ticketId); err != nil {
+					log.Error.Printf("Expire ticket err: %s", err.Error())
+				}
 			}
 		}
+		statusRes, err := c.core.CheckConfirmStatusByRequestInfo(c.ticketId)
+		if err != nil {
+			log.Error.Printf("Check confirm status err: %s", err.Error())
+			continue
+		}
+		c.state.Store(statusRes)
+		switch statusRes.State {
+		case model.TicketOpen:
+			continue
+		case model.TicketApproved:
+			c.approver = statusRes.Approver
+			return StatusApprove
+		case model.TicketRejected, model.TicketClosed:
+			c.approver = statusRes.Approver
+			return StatusReject
+		case model.TicketExpired:
+			return StatusExpire
+		default:
+			log.Error.Printf("Receive unknown login confirm status %s",
+				statusRes.State)
+		}
 	}
 }
 
@@ -113,6 +186,7 @@ const (
 	StatusApprove Status = iota + 1
 	StatusReject
 	StatusCancel
+	StatusExpire
 )
 
 type ConfirmOption func(*connectionConfirmOption)
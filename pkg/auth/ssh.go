@@ -8,12 +8,14 @@ import (
 	"github.com/handewo/gojump/pkg/core"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 const (
 	ContextKeyUser              = "CONTEXT_USER"
 	ContextKeyClient            = "CONTEXT_CLIENT"
 	ContextKeyDirectLoginFormat = "CONTEXT_DIRECT_LOGIN_FORMAT"
+	ContextKeyAuthMethod        = "CONTEXT_AUTH_METHOD"
 )
 
 type SSHAuthFunc func(ctx ssh.Context, password, publicKey string) bool
@@ -44,6 +46,12 @@ func SSHPasswordAndPublicKeyAuth(c *core.Core) SSHAuthFunc {
 		switch res {
 		case AuthSuccess:
 			ctx.SetValue(ContextKeyUser, &user)
+			ctx.SetValue(ContextKeyAuthMethod, authMethod)
+			if NeedTOTP(c, &user) {
+				log.Info.Printf("SSH conn[%s] %s for %s from %s, need verification code", ctx.SessionID()[:10],
+					authMethod, username, remoteAddr)
+				return true
+			}
 			c.AuthenticationLog(username, authMethod, remoteAddr)
 			log.Info.Printf("SSH conn[%s] %s for %s from %s", ctx.SessionID()[:10],
 				authMethod, username, remoteAddr)
@@ -58,6 +66,42 @@ func SSHPasswordAndPublicKeyAuth(c *core.Core) SSHAuthFunc {
 	}
 }
 
+type SSHKeyboardInteractiveAuthFunc func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool
+
+// SSHTOTPAuth verifies the TOTP code as the second step after password or public key auth.
+func SSHTOTPAuth(c *core.Core) SSHKeyboardInteractiveAuthFunc {
+	return func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+		remoteAddr, _, _ := net.SplitHostPort(ctx.RemoteAddr().String())
+		user, ok := ctx.Value(ContextKeyUser).(*model.User)
+		if !ok || user.ID == "" {
+			return false
+		}
+		if c.UserIsBlocked(user.Username) {
+			return false
+		}
+		answers, err := challenger("", "", []string{"Verification code: "}, []bool{false})
+		if err != nil || len(answers) != 1 {
+			return false
+		}
+		authMethod, _ := ctx.Value(ContextKeyAuthMethod).(string)
+		authMethod += "+totp"
+		if !c.VerifyTOTP(user, answers[0]) {
+			log.Info.Printf("SSH conn[%s] %s for %s from %s failed", ctx.SessionID()[:10],
+				authMethod, user.Username, remoteAddr)
+			c.LimitTryLogin(user.Username)
+			return false
+		}
+		c.AuthenticationLog(user.Username, authMethod, remoteAddr)
+		log.Info.Printf("SSH conn[%s] %s for %s from %s", ctx.SessionID()[:10],
+			authMethod, user.Username, remoteAddr)
+		return true
+	}
+}
+
+func NeedTOTP(c *core.Core, user *model.User) bool {
+	return user.OTPLevel == model.OTPLevelTOTP && c.IsTOTPEnrolled(user)
+}
+
 func parseUserFormatBySeparator(s string) (map[string]string, bool) {
 	authInfos := strings.Split(s, "@")
 	if len(authInfos) != 3 {
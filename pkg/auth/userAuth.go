@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/core"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
@@ -33,7 +35,7 @@ func (u *UserAuthClient) Authenticate(username string) (model.User, int) {
 		return model.User{}, AuthFailed
 	}
 
-	if user.AddrWhiteList != nil {
+	if len(user.AddrWhiteList) > 0 {
 		isMatch := false
 		for _, addr := range user.AddrWhiteList {
 			if u.UserClient.RemoteAddr == addr {
@@ -50,6 +52,9 @@ func (u *UserAuthClient) Authenticate(username string) (model.User, int) {
 	t := time.Now().Unix()
 	if user.ExpireAt != 0 && user.ExpireAt < t {
 		log.Info.Printf("user %s has expired", username)
+		u.Core.Publish(core.Event{Type: core.EventExpiredLogin, User: username,
+			Message: fmt.Sprintf("%s expired at %s tries to login from %s", username,
+				time.Unix(user.ExpireAt, 0).Format(common.LogFormat), u.UserClient.RemoteAddr)})
 		return model.User{}, AuthFailed
 	}
 	return user, AuthSuccess
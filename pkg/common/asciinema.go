@@ -2,6 +2,8 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
@@ -64,13 +66,24 @@ func (w *AsciiWriter) WriteHeader() error {
 }
 
 func (w *AsciiWriter) WriteRow(p []byte) error {
-	now := time.Now().UnixNano()
-	ts := float64(now-w.TimestampNano) / 1000 / 1000 / 1000
-	return w.WriteStdout(ts, p)
+	return w.WriteStdout(w.Elapsed(time.Now()), p)
+}
+
+// Elapsed returns the seconds from the start of the recording to t
+func (w *AsciiWriter) Elapsed(t time.Time) float64 {
+	return float64(t.UnixNano()-w.TimestampNano) / 1000 / 1000 / 1000
 }
 
 func (w *AsciiWriter) WriteStdout(ts float64, data []byte) error {
-	row := []interface{}{ts, "o", string(data)}
+	return w.writeEvent(ts, "o", data)
+}
+
+func (w *AsciiWriter) WriteStdin(ts float64, data []byte) error {
+	return w.writeEvent(ts, "i", data)
+}
+
+func (w *AsciiWriter) writeEvent(ts float64, code string, data []byte) error {
+	row := []interface{}{ts, code, string(data)}
 	raw, err := json.Marshal(row)
 	if err != nil {
 		return err
@@ -83,6 +96,51 @@ func (w *AsciiWriter) WriteStdout(ts float64, data []byte) error {
 	return err
 }
 
+// Event is a row of the recording, the code is "o" for output and "i" for input
+type Event struct {
+	Time float64
+	Code string
+	Data string
+}
+
+// ReadRecording parses the header and the events of an asciicast v2 recording
+func ReadRecording(r io.Reader) (*Header, []Event, error) {
+	dec := json.NewDecoder(r)
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, nil, fmt.Errorf("invalid header: %s", err)
+	}
+	if header.Version != version {
+		return nil, nil, fmt.Errorf("unsupported version %d", header.Version)
+	}
+	events := make([]Event, 0, 1024)
+	for {
+		var row []interface{}
+		err := dec.Decode(&row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the recording of a broken session may end with a partial row
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, nil, fmt.Errorf("invalid event: %s", err)
+		}
+		if len(row) != 3 {
+			return nil, nil, fmt.Errorf("invalid event: %v", row)
+		}
+		ts, ok1 := row[0].(float64)
+		code, ok2 := row[1].(string)
+		data, ok3 := row[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, nil, fmt.Errorf("invalid event: %v", row)
+		}
+		events = append(events, Event{Time: ts, Code: code, Data: data})
+	}
+	return &header, events, nil
+}
+
 type Header struct {
 	Version   int    `json:"version"`
 	Width     int    `json:"width"`
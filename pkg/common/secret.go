@@ -0,0 +1,239 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The secrets are sealed by envelope encryption, the value is sealed by a random data key,
+// which is sealed by the master key, so that a new master key only seals the data keys again.
+// The format is enc:v1:MASTER_KEY_ID:SEALED_DATA_KEY:SEALED_VALUE
+const (
+	secretPrefix = "enc:v1:"
+
+	minMasterKeyLen = 32
+	dataKeyLen      = 32
+)
+
+var (
+	ErrNoMasterKey      = errors.New("no master key")
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	ErrInvalidSecret    = errors.New("invalid encrypted secret")
+)
+
+type MasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewMasterKey derives the master key from the key material, which is at least 32 characters
+func NewMasterKey(material []byte) (*MasterKey, error) {
+	material = []byte(strings.TrimSpace(string(material)))
+	if len(material) < minMasterKeyLen {
+		return nil, fmt.Errorf("master key is shorter than %d characters", minMasterKeyLen)
+	}
+	sum := sha256.Sum256(material)
+	aead, err := newAEAD(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	idSum := sha256.Sum256(sum[:])
+	return &MasterKey{id: hex.EncodeToString(idSum[:4]), aead: aead}, nil
+}
+
+// LoadMasterKey reads the master key from the file, or else the environment variable named env.
+// It returns nil if neither is set.
+func LoadMasterKey(file string, env string) (*MasterKey, error) {
+	if file != "" {
+		material, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return NewMasterKey(material)
+	}
+	if env != "" {
+		material := os.Getenv(env)
+		if material == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", env)
+		}
+		return NewMasterKey([]byte(material))
+	}
+	return nil, nil
+}
+
+func (k *MasterKey) ID() string {
+	return k.id
+}
+
+var secretKeys = struct {
+	sync.RWMutex
+	current *MasterKey
+	keys    map[string]*MasterKey
+}{keys: make(map[string]*MasterKey)}
+
+// SetMasterKey seals the new secrets by the key, the former keys still open the secrets sealed by them.
+func SetMasterKey(k *MasterKey) {
+	secretKeys.Lock()
+	defer secretKeys.Unlock()
+	secretKeys.current = k
+	if k != nil {
+		secretKeys.keys[k.id] = k
+	}
+}
+
+// AddMasterKey opens the secrets sealed by the former key, the new secrets are not sealed by it.
+func AddMasterKey(k *MasterKey) {
+	secretKeys.Lock()
+	defer secretKeys.Unlock()
+	secretKeys.keys[k.id] = k
+}
+
+func GetMasterKey() *MasterKey {
+	secretKeys.RLock()
+	defer secretKeys.RUnlock()
+	return secretKeys.current
+}
+
+func getMasterKeyByID(id string) (*MasterKey, error) {
+	secretKeys.RLock()
+	defer secretKeys.RUnlock()
+	k, ok := secretKeys.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownMasterKey, id)
+	}
+	return k, nil
+}
+
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, secretPrefix)
+}
+
+// EncryptSecret seals the secret by the current master key. The secret is kept unchanged if it is
+// empty or sealed already, or if there is no master key.
+func EncryptSecret(s string) (string, error) {
+	k := GetMasterKey()
+	if s == "" || IsEncryptedSecret(s) || k == nil {
+		return s, nil
+	}
+	return sealSecret(k, s)
+}
+
+// DecryptSecret opens the sealed secret, a plaintext secret is returned as it is.
+func DecryptSecret(s string) (string, error) {
+	if !IsEncryptedSecret(s) {
+		return s, nil
+	}
+	id, dataKey, sealed, err := openDataKey(s)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := openSealed(aead, sealed)
+	if err != nil {
+		return "", fmt.Errorf("%w sealed by master key %s", ErrInvalidSecret, id)
+	}
+	return string(plain), nil
+}
+
+// ResealSecret seals the data key of the secret by the master key k, a plaintext secret is sealed by k.
+func ResealSecret(s string, k *MasterKey) (string, error) {
+	if s == "" {
+		return s, nil
+	}
+	if !IsEncryptedSecret(s) {
+		return sealSecret(k, s)
+	}
+	_, dataKey, sealed, err := openDataKey(s)
+	if err != nil {
+		return "", err
+	}
+	return formatSecret(k, dataKey, sealed)
+}
+
+func sealSecret(k *MasterKey, s string) (string, error) {
+	dataKey := make([]byte, dataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(s))
+	if err != nil {
+		return "", err
+	}
+	return formatSecret(k, dataKey, sealed)
+}
+
+func formatSecret(k *MasterKey, dataKey []byte, sealed []byte) (string, error) {
+	sealedKey, err := seal(k.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return secretPrefix + k.id + ":" + enc.EncodeToString(sealedKey) + ":" + enc.EncodeToString(sealed), nil
+}
+
+// openDataKey returns the master key ID, the data key and the sealed value of the secret
+func openDataKey(s string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(s, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	enc := base64.RawStdEncoding
+	sealedKey, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	sealed, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	k, err := getMasterKeyByID(parts[0])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	dataKey, err := openSealed(k.aead, sealedKey)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%w sealed by master key %s", ErrInvalidSecret, k.id)
+	}
+	return k.id, dataKey, sealed, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal prepends the random nonce to the sealed data
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func openSealed(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidSecret
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, data[:n], data[n:], nil)
+}
@@ -309,3 +309,17 @@ func GzipCompressFile(srcPath, dstPath string) error {
 	}
 	return nil
 }
+
+// FormatSize returns the size in B, KB, MB, GB or TB
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGT"[exp])
+}
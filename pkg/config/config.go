@@ -29,7 +29,68 @@ type Config struct {
 	ReuseConnection    bool   `mapstructure:"REUSE_CONNECTION" json:"REUSE_CONNECTION"`
 	DisableRecorder    bool   `mapstructure:"DISABLE_RECORDER" json:"DISABLE_RECORDER"`
 
+	// The replays are uploaded to the storage of local, s3 or sftp, and removed from REPLAY_PATH
+	// after the upload is confirmed. The replays stay in REPLAY_PATH if it is local.
+	ReplayStorage      string `mapstructure:"REPLAY_STORAGE" json:"REPLAY_STORAGE"`
+	ReplayS3Endpoint   string `mapstructure:"REPLAY_S3_ENDPOINT" json:"REPLAY_S3_ENDPOINT"`
+	ReplayS3Region     string `mapstructure:"REPLAY_S3_REGION" json:"REPLAY_S3_REGION"`
+	ReplayS3Bucket     string `mapstructure:"REPLAY_S3_BUCKET" json:"REPLAY_S3_BUCKET"`
+	ReplayS3Prefix     string `mapstructure:"REPLAY_S3_PREFIX" json:"REPLAY_S3_PREFIX"`
+	ReplayS3AccessKey  string `mapstructure:"REPLAY_S3_ACCESS_KEY" json:"REPLAY_S3_ACCESS_KEY"`
+	ReplayS3SecretKey  string `mapstructure:"REPLAY_S3_SECRET_KEY" json:"-"`
+	ReplaySFTPAddr     string `mapstructure:"REPLAY_SFTP_ADDR" json:"REPLAY_SFTP_ADDR"`
+	ReplaySFTPUser     string `mapstructure:"REPLAY_SFTP_USER" json:"REPLAY_SFTP_USER"`
+	ReplaySFTPPassword string `mapstructure:"REPLAY_SFTP_PASSWORD" json:"-"`
+	ReplaySFTPKeyFile  string `mapstructure:"REPLAY_SFTP_KEY_FILE" json:"REPLAY_SFTP_KEY_FILE"`
+	ReplaySFTPHostKey  string `mapstructure:"REPLAY_SFTP_HOST_KEY" json:"REPLAY_SFTP_HOST_KEY"`
+	ReplaySFTPPath     string `mapstructure:"REPLAY_SFTP_PATH" json:"REPLAY_SFTP_PATH"`
+
+	// The replays older than the days or over the total size in MB are deleted, or moved to
+	// REPLAY_ARCHIVE_PATH if it is set, the oldest first. 0 keeps them. The limits apply to the storage
+	// and to REPLAY_PATH, where the replays failed to upload are left.
+	ReplayKeepDays    int    `mapstructure:"REPLAY_KEEP_DAYS" json:"REPLAY_KEEP_DAYS"`
+	ReplayMaxSize     int64  `mapstructure:"REPLAY_MAX_SIZE" json:"REPLAY_MAX_SIZE"`
+	ReplayArchivePath string `mapstructure:"REPLAY_ARCHIVE_PATH" json:"REPLAY_ARCHIVE_PATH"`
+	// The volume of REPLAY_PATH is full if the free space in MB is less than REPLAY_DISK_MIN_FREE or it
+	// can not be written, then new sessions are not recorded with disable_recorder, or refused with refuse.
+	ReplayDiskWarnPercent int    `mapstructure:"REPLAY_DISK_WARN_PERCENT" json:"REPLAY_DISK_WARN_PERCENT"`
+	ReplayDiskMinFree     int64  `mapstructure:"REPLAY_DISK_MIN_FREE" json:"REPLAY_DISK_MIN_FREE"`
+	ReplayDiskFullAction  string `mapstructure:"REPLAY_DISK_FULL_ACTION" json:"REPLAY_DISK_FULL_ACTION"`
+
 	EnableLocalPortForward bool `mapstructure:"ENABLE_LOCAL_PORT_FORWARD" json:"ENABLE_LOCAL_PORT_FORWARD"`
+
+	//Minute, the pending tickets expire after the wait, 0 keeps them pending
+	TicketTimeout int `mapstructure:"TICKET_TIMEOUT" json:"TICKET_TIMEOUT"`
+	//Minute, the longest time window granted by the approvers to login without a new ticket, 0 disables the windows
+	TicketMaxWindow int `mapstructure:"TICKET_MAX_WINDOW" json:"TICKET_MAX_WINDOW"`
+
+	// The security events are sent to the channels of the rules, such as login_blocked: [webhook, email],
+	// the event * matches all of them. The webhook posts the events in JSON signed by HMAC-SHA256 of the secret,
+	// the failed deliveries are retried NOTIFY_RETRY times.
+	NotifyRules         map[string][]string `mapstructure:"NOTIFY_RULES" json:"NOTIFY_RULES"`
+	NotifyRetry         int                 `mapstructure:"NOTIFY_RETRY" json:"NOTIFY_RETRY"`
+	NotifyWebhookURL    string              `mapstructure:"NOTIFY_WEBHOOK_URL" json:"NOTIFY_WEBHOOK_URL"`
+	NotifyWebhookSecret string              `mapstructure:"NOTIFY_WEBHOOK_SECRET" json:"-"`
+	NotifySMTPAddr      string              `mapstructure:"NOTIFY_SMTP_ADDR" json:"NOTIFY_SMTP_ADDR"`
+	NotifySMTPUser      string              `mapstructure:"NOTIFY_SMTP_USER" json:"NOTIFY_SMTP_USER"`
+	NotifySMTPPassword  string              `mapstructure:"NOTIFY_SMTP_PASSWORD" json:"-"`
+	NotifySMTPFrom      string              `mapstructure:"NOTIFY_SMTP_FROM" json:"NOTIFY_SMTP_FROM"`
+	NotifySMTPTo        []string            `mapstructure:"NOTIFY_SMTP_TO" json:"NOTIFY_SMTP_TO"`
+
+	//Minute, the health check of assets is disabled if it is 0
+	AssetCheckInterval int `mapstructure:"ASSET_CHECK_INTERVAL" json:"ASSET_CHECK_INTERVAL"`
+
+	// RESTful api is disabled if the port is empty
+	APIPort    string `mapstructure:"API_PORT" json:"API_PORT"`
+	APITLSCert string `mapstructure:"API_TLS_CERT" json:"API_TLS_CERT"`
+	APITLSKey  string `mapstructure:"API_TLS_KEY" json:"API_TLS_KEY"`
+
+	// The master key to encrypt the secrets of system users and gateways is read from the file,
+	// or else the environment variable named by SECRET_KEY_ENV
+	SecretKeyFile string `mapstructure:"SECRET_KEY_FILE" json:"SECRET_KEY_FILE"`
+	SecretKeyEnv  string `mapstructure:"SECRET_KEY_ENV" json:"SECRET_KEY_ENV"`
+	// The former master keys only open the secrets sealed by them, until reencrypt seals them by the current one
+	SecretOldKeyFiles []string `mapstructure:"SECRET_OLD_KEY_FILES" json:"SECRET_OLD_KEY_FILES"`
 }
 
 var GlobalConfig *Config
@@ -64,10 +125,21 @@ func newDefaultConfig() *Config {
 		LogLevel:         "INFO",
 		LogFile:          "gojump.log",
 		ReplayFolderPath: "gojumpreplay",
+		ReplayStorage:    "local",
 		Database:         "genji",
 		GenjiDbPath:      "gojumpdb",
 		OtpDuration:      120,
 		MaxTryLogin:      15,
 		LoginBlockTime:   5,
+
+		AssetCheckInterval: 30,
+
+		ReplayDiskWarnPercent: 90,
+		ReplayDiskMinFree:     100,
+
+		TicketTimeout:   30,
+		TicketMaxWindow: 1440,
+
+		NotifyRetry: 3,
 	}
 }
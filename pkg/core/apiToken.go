@@ -0,0 +1,122 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+const apiTokenSize = 32
+
+func apiTokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken creates a token of the user of an admin role, the token is only returned here.
+func (c *Core) CreateAPIToken(username string, name string, expireAt int64, admin string) (string, error) {
+	user, err := c.GetUser(username)
+	if err != nil {
+		return "", err
+	}
+	if !model.IsAdminRole(user.Role) {
+		return "", fmt.Errorf("%s is not an admin", username)
+	}
+	b := make([]byte, apiTokenSize)
+	if _, err = rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	id, err := c.nextID("APITOKEN")
+	if err != nil {
+		return "", err
+	}
+	t := model.APIToken{
+		ID:         id,
+		UserID:     user.ID,
+		Name:       name,
+		Digest:     apiTokenDigest(token),
+		ExpireAt:   expireAt,
+		CreateDate: time.Now().Format(common.LogFormat),
+	}
+	if err = c.db.InsertData("INSERT INTO APITOKEN VALUES ?", &t); err != nil {
+		return "", err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("create api token %s(%s) of %s", name, id, username))
+	return token, nil
+}
+
+func (c *Core) RevokeAPIToken(id string, admin string) error {
+	t := model.APIToken{}
+	if err := c.db.QueryStruct(&t, "SELECT * FROM APITOKEN WHERE id = ?", id); err != nil {
+		return err
+	}
+	if t.ID == "" {
+		return fmt.Errorf("api token %s not found", id)
+	}
+	if err := c.db.DeleteData("DELETE FROM APITOKEN WHERE id = ?", id); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("revoke api token %s(%s)", t.Name, id))
+	return nil
+}
+
+// AuthenticateAPIToken returns the admin user who owns the token.
+func (c *Core) AuthenticateAPIToken(token string) (model.User, error) {
+	t := model.APIToken{}
+	err := c.db.QueryStruct(&t, "SELECT * FROM APITOKEN WHERE digest = ?", apiTokenDigest(token))
+	if err != nil {
+		return model.User{}, err
+	}
+	now := time.Now()
+	if t.ID == "" || (t.ExpireAt != 0 && t.ExpireAt < now.Unix()) {
+		return model.User{}, ErrInvalidAPIToken
+	}
+	user, err := c.GetUserById(t.UserID)
+	if err != nil {
+		return model.User{}, ErrInvalidAPIToken
+	}
+	if !user.IsActive || !model.IsAdminRole(user.Role) ||
+		(user.ExpireAt != 0 && user.ExpireAt < now.Unix()) {
+		return model.User{}, ErrInvalidAPIToken
+	}
+	err = c.db.UpdateData("UPDATE APITOKEN SET lastused = ? WHERE id = ?", now.Format(common.LogFormat), t.ID)
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+func (c *Core) QueryAllAPIToken() ([]string, error) {
+	v, err := c.db.QueryStructs(model.APITokenType, "SELECT * FROM APITOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, ok := v.([]model.APIToken)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range tokens {
+		var ea string
+		ea = time.Unix(v.ExpireAt, 0).Format(common.LogFormat)
+		if v.ExpireAt == 0 {
+			ea = "9999-12-31 23:59:59"
+		}
+		s := fmt.Sprintf("%4s|%7s|%10s|%s|%s|%s", v.ID, v.UserID, v.Name, v.CreateDate, ea, v.LastUsed)
+		res = append(res, s)
+	}
+	return res, nil
+}
@@ -38,6 +38,11 @@ func (c *Core) GetAllUserPermsAssets(nodeIDs []string) ([]map[string]interface{}
 		return nil, nil, err
 	}
 
+	healths, err := c.GetAssetHealths()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	res := make([]map[string]interface{}, 0, 10)
 	for _, v := range ats {
 		mp := make(map[string]interface{})
@@ -47,6 +52,8 @@ func (c *Core) GetAllUserPermsAssets(nodeIDs []string) ([]map[string]interface{}
 		mp["ip"] = v.IP
 		mp["platform"] = v.Platform
 		mp["comment"] = v.Comment
+		h := healths[v.ID]
+		mp["status"] = h.Status()
 		res = append(res, mp)
 	}
 
@@ -66,7 +73,7 @@ func (c *Core) getAssets(assetIDs []string) ([]model.Asset, error) {
 	return assets, nil
 }
 
-func (c *Core) QueryAllAsset() ([]string, error) {
+func (c *Core) GetAllAssets() ([]model.Asset, error) {
 	v, err := c.db.QueryStructs(model.AssetType, "SELECT * FROM ASSET")
 	if err != nil {
 		return nil, err
@@ -76,18 +83,32 @@ func (c *Core) QueryAllAsset() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return assets, nil
+}
+
+func (c *Core) QueryAllAsset() ([]string, error) {
+	assets, err := c.GetAllAssets()
+	if err != nil {
+		return nil, err
+	}
+
+	healths, err := c.GetAssetHealths()
+	if err != nil {
+		return nil, err
+	}
 
 	res := make([]string, 0, 10)
 	for _, v := range assets {
 		ps := strings.Join(v.Protocols, ",")
-		s := fmt.Sprintf("%4s|%10s|%10s|%39s|%10s|%6v|%10s|%15s|%s",
-			v.ID, v.Name, v.Hostname, v.IP, v.Os, v.IsActive, v.Platform, ps, v.Comment)
+		h := healths[v.ID]
+		s := fmt.Sprintf("%4s|%10s|%10s|%39s|%10s|%6v|%10s|%15s|%11s|%s",
+			v.ID, v.Name, v.Hostname, v.IP, v.Os, v.IsActive, v.Platform, ps, h.Status(), v.Comment)
 		res = append(res, s)
 	}
 	return res, nil
 }
 
-func (c *Core) QueryAssetUserInfo() ([]string, error) {
+func (c *Core) GetAllAssetUserInfos() ([]model.AssetUserInfo, error) {
 	v, err := c.db.QueryStructs(model.AssetUserInfoType, "SELECT * FROM ASSETUSERINFO")
 	if err != nil {
 		return nil, err
@@ -97,6 +118,14 @@ func (c *Core) QueryAssetUserInfo() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return aus, nil
+}
+
+func (c *Core) QueryAssetUserInfo() ([]string, error) {
+	aus, err := c.GetAllAssetUserInfos()
+	if err != nil {
+		return nil, err
+	}
 
 	res := make([]string, 0, 10)
 	for _, v := range aus {
@@ -106,9 +135,225 @@ func (c *Core) QueryAssetUserInfo() ([]string, error) {
 			ea = "9999-12-31 23:59:59"
 		}
 		si := strings.Join(v.SysUserID, ",")
-		s := fmt.Sprintf("%4s|%7s|%8s|%s|%12v|%14v|%s",
-			v.ID, v.UserID, v.AssetID, ea, v.NeedConfirm, v.EnableVscode, si)
+		s := fmt.Sprintf("%4s|%7s|%8s|%s|%12v|%14v|%11v|%s",
+			v.ID, v.UserID, v.AssetID, ea, v.NeedConfirm, v.EnableVscode, v.EnableSFTP, si)
 		res = append(res, s)
 	}
 	return res, nil
 }
+
+func (c *Core) validateAsset(asset *model.Asset) error {
+	if err := validateName("asset name", asset.Name); err != nil {
+		return err
+	}
+	if asset.Hostname == "" {
+		asset.Hostname = asset.Name
+	}
+	if asset.IP == "" {
+		return errors.New("ip is required")
+	}
+	if err := model.ValidateProtocols(asset.Protocols); err != nil {
+		return err
+	}
+	if asset.Platform == "" {
+		asset.Platform = "Linux"
+	}
+	ids, err := c.db.QueryOneFieldMutilRows("SELECT id FROM ASSET WHERE name = ? AND id != ?",
+		asset.Name, asset.ID)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("asset %s already exists", asset.Name)
+	}
+	return nil
+}
+
+func (c *Core) AddAsset(asset *model.Asset, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	asset.ID, err = c.nextID("ASSET")
+	if err != nil {
+		return err
+	}
+	if err = c.validateAsset(asset); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO ASSET VALUES ?", asset); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add asset %s(%s)", asset.Name, asset.ID))
+	return nil
+}
+
+func (c *Core) UpdateAsset(asset *model.Asset, admin string) error {
+	if err := c.validateAsset(asset); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE ASSET SET name = ?, hostname = ?, ip = ?, os = ?, comment = ?, protocols = ?, platform = ?, isactive = ? WHERE id = ?",
+		asset.Name, asset.Hostname, asset.IP, asset.Os, asset.Comment, asset.Protocols, asset.Platform, asset.IsActive, asset.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit asset %s(%s)", asset.Name, asset.ID))
+	return nil
+}
+
+func (c *Core) SetAssetActive(assetID string, active bool, admin string) error {
+	asset, err := c.GetAssetById(assetID)
+	if err != nil {
+		return err
+	}
+	if asset.ID == "" {
+		return fmt.Errorf("asset %s %w", assetID, ErrNotFound)
+	}
+	if err = c.db.UpdateData("UPDATE ASSET SET isactive = ? WHERE id = ?", active, assetID); err != nil {
+		return err
+	}
+	action := "disable"
+	if active {
+		action = "enable"
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("%s asset %s(%s)", action, asset.Name, assetID))
+	return nil
+}
+
+// DeleteAsset removes the asset, its grants and pinned host key, and detaches it from nodes.
+func (c *Core) DeleteAsset(assetID string, admin string) error {
+	asset, err := c.GetAssetById(assetID)
+	if err != nil {
+		return err
+	}
+	if asset.ID == "" {
+		return fmt.Errorf("asset %s %w", assetID, ErrNotFound)
+	}
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return err
+	}
+	d := &deletion{}
+	for _, n := range nodes {
+		if !containString(n.AssetIDs, assetID) {
+			continue
+		}
+		d.add("UPDATE NODE SET assetids = ? WHERE id = ?", removeString(n.AssetIDs, assetID), n.ID)
+	}
+	d.add("DELETE FROM ASSETUSERINFO WHERE assetid = ?", assetID)
+	if err = c.detachGateways(d, "assetids", assetID); err != nil {
+		return err
+	}
+	if err = c.detachReviewFlows(d, "assetids", assetID); err != nil {
+		return err
+	}
+	d.add("DELETE FROM ASSETHOSTKEY WHERE assetid = ?", assetID)
+	d.add("DELETE FROM ASSETSECRET WHERE assetid = ?", assetID)
+	d.add("DELETE FROM ASSETHEALTH WHERE assetid = ?", assetID)
+	d.add("DELETE FROM ASSET WHERE id = ?", assetID)
+	d.log(fmt.Sprintf("delete asset %s(%s)", asset.Name, assetID))
+	return c.commitDeletion(d, admin)
+}
+
+func (c *Core) GetAssetUserInfoById(id string) (model.AssetUserInfo, error) {
+	au := model.AssetUserInfo{}
+	err := c.db.QueryStruct(&au, "SELECT * FROM ASSETUSERINFO WHERE id = ?", id)
+	if err != nil {
+		return au, err
+	}
+	if au.ID == "" {
+		return au, fmt.Errorf("grant %s %w", id, ErrNotFound)
+	}
+	return au, nil
+}
+
+func (c *Core) validateAssetUserInfo(au *model.AssetUserInfo) error {
+	if _, err := c.GetUserById(au.UserID); err != nil {
+		return err
+	}
+	asset, err := c.GetAssetById(au.AssetID)
+	if err != nil {
+		return err
+	}
+	if asset.ID == "" {
+		return fmt.Errorf("asset %s not found", au.AssetID)
+	}
+	if len(au.SysUserID) == 0 {
+		return errors.New("at least one system user is required")
+	}
+	sys, err := c.getSystemUsers(au.SysUserID)
+	if err != nil {
+		return err
+	}
+	found := make([]string, 0, len(sys))
+	for _, s := range sys {
+		found = append(found, s.ID)
+	}
+	if id := missingID(au.SysUserID, found); id != "" {
+		return fmt.Errorf("system user %s not found", id)
+	}
+	ids, err := c.db.QueryOneFieldMutilRows("SELECT id FROM ASSETUSERINFO WHERE userid = ? AND assetid = ? AND id != ?",
+		au.UserID, au.AssetID, au.ID)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("user %s has been granted asset %s by %s", au.UserID, au.AssetID, ids[0])
+	}
+	return nil
+}
+
+func (c *Core) AddAssetUserInfo(au *model.AssetUserInfo, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	au.ID, err = c.nextID("ASSETUSERINFO")
+	if err != nil {
+		return err
+	}
+	if err = c.validateAssetUserInfo(au); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO ASSETUSERINFO VALUES ?", au); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("grant asset %s to user %s(%s)", au.AssetID, au.UserID, au.ID))
+	return nil
+}
+
+func (c *Core) UpdateAssetUserInfo(au *model.AssetUserInfo, admin string) error {
+	if err := c.validateAssetUserInfo(au); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE ASSETUSERINFO SET userid = ?, assetid = ?, expireat = ?, sysuserid = ?, enablevscode = ?, enablesftp = ?, needconfirm = ? WHERE id = ?",
+		au.UserID, au.AssetID, au.ExpireAt, au.SysUserID, au.EnableVscode, au.EnableSFTP, au.NeedConfirm, au.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit grant %s", au.ID))
+	return nil
+}
+
+// DisableAssetUserInfo expires the grant immediately, edit it with a new expiration to enable it again.
+func (c *Core) DisableAssetUserInfo(id string, admin string) error {
+	if _, err := c.GetAssetUserInfoById(id); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE ASSETUSERINFO SET expireat = ? WHERE id = ?", time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("disable grant %s", id))
+	return nil
+}
+
+func (c *Core) DeleteAssetUserInfo(id string, admin string) error {
+	au, err := c.GetAssetUserInfoById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.DeleteData("DELETE FROM ASSETUSERINFO WHERE id = ?", id); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("delete grant %s of asset %s to user %s", id, au.AssetID, au.UserID))
+	return nil
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/handewo/gojump/pkg/common"
@@ -12,6 +13,10 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+const maxTicketReasonLen = 256
+
+// CheckIfNeedAssetLoginConfirm returns whether the login needs a ticket, the ticket approved with
+// a time window for the same asset and system user is returned if it is still valid.
 func (c *Core) CheckIfNeedAssetLoginConfirm(userId, username, assetId, assetName,
 	sysUsername string) (res model.AssetLoginTicketInfo, err error) {
 	need := true
@@ -24,50 +29,293 @@ func (c *Core) CheckIfNeedAssetLoginConfirm(userId, username, assetId, assetName
 	if !need {
 		return model.AssetLoginTicketInfo{NeedConfirm: need}, nil
 	}
-	ticketId := uuid.NewV4().String()
-	date := time.Now()
-	cl := model.LoginTicket{
-		TicketId:        ticketId,
-		State:           model.TicketOpen,
-		Approver:        "",
-		ApplicationDate: date.Format(common.LogFormat),
-		ApproveDate:     "",
-		Username:        username,
-		AssetName:       assetName,
-		SysUsername:     sysUsername,
-	}
-	err = c.db.InsertData("INSERT INTO LOGINTICKET VALUES ?", &cl)
+	v, err := c.db.QueryStructs(model.LoginTicketType,
+		"SELECT * FROM LOGINTICKET WHERE state = ? AND username = ? AND assetname = ? AND sysusername = ? AND validuntil > ?",
+		model.TicketApproved, username, assetName, sysUsername, time.Now().Unix())
 	if err != nil {
-		log.Error.Printf("insert into LOGINTICKET falied, %s", err)
 		return model.AssetLoginTicketInfo{}, err
 	}
+	tickets, ok := v.([]model.LoginTicket)
+	if !ok {
+		return model.AssetLoginTicketInfo{}, errors.New("invalid value type")
+	}
+	for _, t := range tickets {
+		if t.Command != "" {
+			continue
+		}
+		c.InsertLog("ticket", username, fmt.Sprintf("login %s as %s within the window of ticket %s",
+			assetName, sysUsername, t.TicketId))
+		return model.AssetLoginTicketInfo{TicketId: t.TicketId, ValidUntil: t.ValidUntil}, nil
+	}
+	return model.AssetLoginTicketInfo{NeedConfirm: need}, nil
+}
 
+// CreateLoginTicket asks the reviewers to confirm the login with the reason and the change or incident ID
+func (c *Core) CreateLoginTicket(username, assetId, assetName, sysUsername, reason,
+	changeID string) (model.AssetLoginTicketInfo, error) {
+	if len(reason) > maxTicketReasonLen || len(changeID) > maxTicketReasonLen {
+		return model.AssetLoginTicketInfo{}, fmt.Errorf("the reason is longer than %d", maxTicketReasonLen)
+	}
+	return c.createTicket(&model.LoginTicket{
+		Username:    username,
+		AssetName:   assetName,
+		SysUsername: sysUsername,
+		Reason:      reason,
+		ChangeID:    changeID,
+	}, assetId)
+}
+
+// CreateCommandTicket asks the reviewers to confirm the command matched by a command filter
+func (c *Core) CreateCommandTicket(username, assetId, assetName, sysUsername, command string) (model.AssetLoginTicketInfo, error) {
+	return c.createTicket(&model.LoginTicket{
+		Username:    username,
+		AssetName:   assetName,
+		SysUsername: sysUsername,
+		Command:     command,
+	}, assetId)
+}
+
+func (c *Core) createTicket(t *model.LoginTicket, assetId string) (model.AssetLoginTicketInfo, error) {
+	steps, err := c.getTicketSteps(assetId)
+	if err != nil {
+		return model.AssetLoginTicketInfo{}, err
+	}
+	now := time.Now()
+	t.TicketId = uuid.NewV4().String()
+	t.State = model.TicketOpen
+	t.ApplicationDate = now.Format(common.LogFormat)
+	t.Steps = steps
+	if timeout := config.GetConf().TicketTimeout; timeout > 0 {
+		t.ExpireAt = now.Add(time.Duration(timeout) * time.Minute).Unix()
+	}
+	err = c.db.InsertData("INSERT INTO LOGINTICKET VALUES ?", t)
+	if err != nil {
+		log.Error.Printf("insert into LOGINTICKET falied, %s", err)
+		return model.AssetLoginTicketInfo{}, err
+	}
+	created := *t
+	msg := fmt.Sprintf("%s requests login on %s@%s", t.Username, t.SysUsername, t.AssetName)
+	if t.Command != "" {
+		msg = fmt.Sprintf("%s requests command `%s` on %s@%s", t.Username, t.Command, t.SysUsername, t.AssetName)
+	}
+	c.Publish(Event{Type: EventTicketCreated, User: t.Username, Asset: t.AssetName, Message: msg, Ticket: &created})
+	c.Publish(Event{Type: EventTicketPending, User: t.Username, Asset: t.AssetName, Message: msg, Ticket: &created})
 	reviewers, err := c.getReviewers()
 	if err != nil {
 		log.Error.Printf("get reviewers falied, %s", err)
 		return model.AssetLoginTicketInfo{}, err
 	}
 	return model.AssetLoginTicketInfo{
-		TicketId:    ticketId,
-		NeedConfirm: need,
-		Reviewers:   reviewers}, nil
+		TicketId:    t.TicketId,
+		NeedConfirm: true,
+		Reviewers:   reviewers,
+		Steps:       steps,
+		ExpireAt:    t.ExpireAt}, nil
 }
 
 func (c *Core) CheckConfirmStatusByRequestInfo(ticketId string) (model.TicketState, error) {
-	var approver, state string
-
-	err := c.db.QueryTwoField(&approver, &state, "SELECT approver, state FROM LOGINTICKET where ticketid = ?", ticketId)
+	t, err := c.GetLoginTicket(ticketId)
 	if err != nil {
 		return model.TicketState{State: "error"}, err
 	}
 	return model.TicketState{
-		Approver: approver,
-		State:    state}, nil
+		Approver: t.Approver,
+		State:    t.State,
+		Step:     t.Step,
+		Steps:    t.Steps}, nil
+}
+
+func (c *Core) GetLoginTicket(ticketId string) (model.LoginTicket, error) {
+	t := model.LoginTicket{}
+	err := c.db.QueryStruct(&t, "SELECT * FROM LOGINTICKET WHERE ticketid = ?", ticketId)
+	if err != nil {
+		return t, err
+	}
+	if t.TicketId == "" {
+		return t, fmt.Errorf("ticket %s %w", ticketId, ErrNotFound)
+	}
+	return t, nil
+}
+
+// ReviewTicket approves or rejects the current step of the ticket. The ticket is approved after
+// all of its steps are approved, and rejected by any reviewer of the current step. A ticket
+// without steps is reviewed by any one of the reviewers.
+// The approved login ticket is reused within the shortest time window of the approvals, so every
+// approver has to grant a window.
+func (c *Core) ReviewTicket(ticketId string, approve bool, reviewer string, window time.Duration) (model.LoginTicket, error) {
+	c.ticketLock.Lock()
+	defer c.ticketLock.Unlock()
+	t, err := c.reviewTicket(ticketId, approve, reviewer, window)
+	if err != nil {
+		return t, err
+	}
+	reviewed := t
+	c.Publish(Event{Type: EventTicketUpdated, User: t.Username, Asset: t.AssetName, Ticket: &reviewed})
+	if t.State == model.TicketOpen && len(t.Steps[t.Step].Approvals) == 0 {
+		// the previous step is passed
+		c.Publish(Event{Type: EventTicketPending, User: t.Username, Asset: t.AssetName, Ticket: &reviewed})
+	}
+	return t, nil
+}
+
+func (c *Core) reviewTicket(ticketId string, approve bool, reviewer string, window time.Duration) (model.LoginTicket, error) {
+	t, err := c.GetLoginTicket(ticketId)
+	if err != nil {
+		return t, err
+	}
+	now := time.Now()
+	if t.State == model.TicketOpen && t.ExpireAt > 0 && t.ExpireAt <= now.Unix() {
+		if err = c.ExpireTicket(ticketId); err != nil {
+			return t, err
+		}
+		t.State = model.TicketExpired
+	}
+	if t.State != model.TicketOpen {
+		return t, fmt.Errorf("ticket is %s", t.State)
+	}
+	if t.Username == reviewer {
+		return t, errors.New("can not review your own ticket")
+	}
+	if window < 0 {
+		return t, errors.New("invalid time window")
+	}
+	if window > 0 {
+		max := time.Duration(config.GetConf().TicketMaxWindow) * time.Minute
+		switch {
+		case !approve || t.Command != "":
+			return t, errors.New("time window is only granted by approving login tickets")
+		case max == 0:
+			return t, errors.New("time windows are disabled")
+		case window > max:
+			return t, fmt.Errorf("time window is longer than %s", max)
+		}
+	}
+	state := model.TicketRejected
+	if approve {
+		state = model.TicketApproved
+	}
+	if len(t.Steps) == 0 {
+		if err = c.UpdateTicketState(ticketId, state, reviewer); err != nil {
+			return t, err
+		}
+		t.State, t.Approver = state, reviewer
+		if window > 0 {
+			t.ValidUntil = now.Add(window).Unix()
+			err = c.db.UpdateData("UPDATE LOGINTICKET SET validuntil = ? WHERE ticketid = ?", t.ValidUntil, ticketId)
+		}
+		return t, err
+	}
+	step := &t.Steps[t.Step]
+	if !containString(step.Reviewers, reviewer) {
+		return t, fmt.Errorf("you are not a reviewer of step %d", t.Step+1)
+	}
+	if !approve {
+		if err = c.UpdateTicketState(ticketId, state, reviewer); err != nil {
+			return t, err
+		}
+		t.State, t.Approver = state, reviewer
+		return t, nil
+	}
+	approvers := make([]string, 0, 4)
+	for _, s := range t.Steps {
+		for _, a := range s.Approvals {
+			approvers = append(approvers, a.Approver)
+		}
+	}
+	if containString(approvers, reviewer) {
+		return t, errors.New("you have approved the ticket")
+	}
+	date := now.Format(common.LogFormat)
+	step.Approvals = append(step.Approvals, model.TicketApproval{Approver: reviewer, Date: date,
+		Window: int64(window / time.Second)})
+	approvers = append(approvers, reviewer)
+	if step.IsApproved() {
+		t.Step++
+	}
+	if t.Step < len(t.Steps) {
+		err = c.db.UpdateData("UPDATE LOGINTICKET SET steps = ?, step = ? WHERE ticketid = ? AND state = ?",
+			t.Steps, t.Step, ticketId, model.TicketOpen)
+		return t, err
+	}
+	t.State, t.Approver, t.ApproveDate = state, strings.Join(approvers, ","), date
+	if w := shortestWindow(t.Steps); w > 0 {
+		t.ValidUntil = now.Unix() + w
+	}
+	err = c.db.UpdateData("UPDATE LOGINTICKET SET steps = ?, step = ?, state = ?, approver = ?, approvedate = ?, validuntil = ? WHERE ticketid = ? AND state = ?",
+		t.Steps, t.Step, t.State, t.Approver, t.ApproveDate, t.ValidUntil, ticketId, model.TicketOpen)
+	return t, err
+}
+
+// shortestWindow returns the shortest window in seconds of the approvals, 0 if any approval has none
+func shortestWindow(steps []model.TicketStep) int64 {
+	var res int64
+	for _, s := range steps {
+		for _, a := range s.Approvals {
+			if a.Window <= 0 {
+				return 0
+			}
+			if res == 0 || a.Window < res {
+				res = a.Window
+			}
+		}
+	}
+	return res
+}
+
+func (c *Core) ExpireTicket(ticketId string) error {
+	if err := c.UpdateTicketState(ticketId, model.TicketExpired, ""); err != nil {
+		return err
+	}
+	c.publishTicket(EventTicketUpdated, ticketId)
+	return nil
+}
+
+// RunTicketJanitor expires the pending tickets after TICKET_TIMEOUT every minute,
+// whose users may have left without closing them.
+func (c *Core) RunTicketJanitor() {
+	for {
+		time.Sleep(time.Minute)
+		ids, err := c.db.QueryOneFieldMutilRows("SELECT ticketid FROM LOGINTICKET WHERE state = ? AND expireat > 0 AND expireat <= ?",
+			model.TicketOpen, time.Now().Unix())
+		if err != nil {
+			log.Error.Printf("Query expired tickets failed: %s", err)
+			continue
+		}
+		for _, id := range ids {
+			if err = c.ExpireTicket(id); err != nil {
+				log.Error.Printf("Expire ticket %s failed: %s", id, err)
+			}
+		}
+	}
+}
+
+// TicketProgress formats the progress of the current step, such as "step 1/2 approved 1 of 2 (alice)"
+func TicketProgress(t *model.LoginTicket) string {
+	if len(t.Steps) == 0 {
+		return ""
+	}
+	step := t.Step
+	if step >= len(t.Steps) {
+		step = len(t.Steps) - 1
+	}
+	s := t.Steps[step]
+	approvers := make([]string, 0, len(s.Approvals))
+	for _, a := range s.Approvals {
+		approvers = append(approvers, a.Approver)
+	}
+	res := fmt.Sprintf("step %d/%d approved %d of %d", step+1, len(t.Steps), len(s.Approvals), s.Required)
+	if len(approvers) > 0 {
+		res += fmt.Sprintf(" (%s)", strings.Join(approvers, ","))
+	}
+	return res
 }
 
 func (c *Core) CancelConfirmByRequestInfo(ticketId string) error {
-	err := c.UpdateTicketState(ticketId, model.TicketClosed, "")
-	return err
+	if err := c.UpdateTicketState(ticketId, model.TicketClosed, ""); err != nil {
+		return err
+	}
+	c.publishTicket(EventTicketUpdated, ticketId)
+	return nil
 }
 
 func (c *Core) UpdateTicketState(ticketId string, state string, user string) error {
@@ -77,11 +325,18 @@ func (c *Core) UpdateTicketState(ticketId string, state string, user string) err
 	return err
 }
 
+// getReviewers returns the active users whose role can review the tickets
 func (c *Core) getReviewers() ([]string, error) {
-	res, err := c.db.QueryOneFieldMutilRows("SELECT username from USER WHERE role = ?", "admin")
+	users, err := c.GetAllUsers()
 	if err != nil {
 		return nil, err
 	}
+	res := make([]string, 0, len(users))
+	for _, u := range users {
+		if u.IsActive && model.HasPermission(u.Role, model.PermReviewTicket) {
+			res = append(res, u.Username)
+		}
+	}
 	return res, nil
 }
 
@@ -99,13 +354,13 @@ func (c *Core) QueryPengdingLoginTicket() ([]string, error) {
 
 	ticks := make([]string, 0, 5)
 	for _, v := range lgtik {
-		ticks = append(ticks, fmt.Sprintf("%s|%s|%10s|%10s|%10s", v.TicketId, v.ApplicationDate, v.Username,
-			v.AssetName, v.SysUsername))
+		ticks = append(ticks, fmt.Sprintf("%s|%s|%10s|%10s|%10s|%20s|%10s|%s|%s", v.TicketId, v.ApplicationDate, v.Username,
+			v.AssetName, v.SysUsername, TicketProgress(&v), v.ChangeID, v.Reason, v.Command))
 	}
 	return ticks, err
 }
 
-func (c *Core) QueryLoginTicket() ([]string, error) {
+func (c *Core) GetLoginTickets() ([]model.LoginTicket, error) {
 	v, err := c.db.QueryStructs(model.LoginTicketType, "SELECT * FROM LOGINTICKET")
 	if err != nil {
 		return nil, err
@@ -115,11 +370,24 @@ func (c *Core) QueryLoginTicket() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return lgtik, nil
+}
+
+func (c *Core) QueryLoginTicket() ([]string, error) {
+	lgtik, err := c.GetLoginTickets()
+	if err != nil {
+		return nil, err
+	}
 
 	ticks := make([]string, 0, 10)
 	for _, v := range lgtik {
-		ticks = append(ticks, fmt.Sprintf("%s|%s|%10s|%10s|%10s|%10s|%19s|%10s", v.TicketId,
-			v.ApplicationDate, v.Username, v.AssetName, v.SysUsername, v.Approver, v.ApproveDate, v.State))
+		validUntil := ""
+		if v.ValidUntil > 0 {
+			validUntil = time.Unix(v.ValidUntil, 0).Format(common.LogFormat)
+		}
+		ticks = append(ticks, fmt.Sprintf("%s|%s|%10s|%10s|%10s|%10s|%19s|%10s|%19s|%10s|%s|%s", v.TicketId,
+			v.ApplicationDate, v.Username, v.AssetName, v.SysUsername, v.Approver, v.ApproveDate, v.State,
+			validUntil, v.ChangeID, v.Reason, v.Command))
 	}
 	return ticks, nil
 }
@@ -144,6 +412,10 @@ func (c *Core) LimitTryLogin(user string) {
 	c.tryLoginCount[user] = count + 1
 	c.loginLock.Unlock()
 	log.Debug.Printf("%s has tried login %d times", user, count+1)
+	if max := config.GlobalConfig.MaxTryLogin; count+1 == max {
+		c.Publish(Event{Type: EventLoginBlocked, User: user, Message: fmt.Sprintf("%s is blocked for %d minutes after %d failed logins",
+			user, config.GlobalConfig.LoginBlockTime, max)})
+	}
 	if !ok {
 		go func() {
 			blockTime := time.Duration(config.GlobalConfig.LoginBlockTime) * time.Minute
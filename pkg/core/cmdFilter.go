@@ -0,0 +1,280 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/model"
+)
+
+func (c *Core) GetAllCommandFilters() ([]model.CommandFilter, error) {
+	v, err := c.db.QueryStructs(model.CommandFilterType, "SELECT * FROM CMDFILTER")
+	if err != nil {
+		return nil, err
+	}
+
+	filters, ok := v.([]model.CommandFilter)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	return filters, nil
+}
+
+func (c *Core) QueryAllCommandFilter() ([]string, error) {
+	filters, err := c.GetAllCommandFilters()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range filters {
+		s := fmt.Sprintf("%4s|%10s|%7s|%6t|%10s|%10s|%10s|%s|%s", v.ID, v.Name, v.Action, v.IsActive,
+			strings.Join(v.UserIDs, ","), strings.Join(v.NodeIDs, ","), strings.Join(v.SysUserIDs, ","),
+			strings.Join(v.Patterns, " , "), v.Comment)
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (c *Core) GetCommandFilterById(id string) (model.CommandFilter, error) {
+	f := model.CommandFilter{}
+	err := c.db.QueryStruct(&f, "SELECT * FROM CMDFILTER WHERE id = ?", id)
+	if err != nil {
+		return f, err
+	}
+	if f.ID == "" {
+		return f, fmt.Errorf("command filter %s %w", id, ErrNotFound)
+	}
+	return f, nil
+}
+
+// GetSessionCommandFilters returns the active filters which apply to the session
+func (c *Core) GetSessionCommandFilters(userID, assetID, sysUserID string) ([]model.CommandFilter, error) {
+	filters, err := c.GetAllCommandFilters()
+	if err != nil {
+		return nil, err
+	}
+	var nodeIDs []string
+	res := make([]model.CommandFilter, 0, len(filters))
+	for _, f := range filters {
+		if !f.IsActive {
+			continue
+		}
+		if f.IsGlobal() || containString(f.UserIDs, userID) || containString(f.SysUserIDs, sysUserID) {
+			res = append(res, f)
+			continue
+		}
+		if len(f.NodeIDs) == 0 {
+			continue
+		}
+		if nodeIDs == nil {
+			if nodeIDs, err = c.getAssetNodeIDs(assetID); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range f.NodeIDs {
+			if containString(nodeIDs, id) {
+				res = append(res, f)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// MatchCommandFilter returns the filter with the strictest action which matches the command,
+// or nil if none of the filters of the session matches.
+func (c *Core) MatchCommandFilter(userID, assetID, sysUserID string, command string) (*model.CommandFilter, error) {
+	filters, err := c.GetSessionCommandFilters(userID, assetID, sysUserID)
+	if err != nil {
+		return nil, err
+	}
+	var res *model.CommandFilter
+	for i := range filters {
+		f := &filters[i]
+		if res != nil && model.FilterActionLevel(f.Action) <= model.FilterActionLevel(res.Action) {
+			continue
+		}
+		for _, p := range f.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s of command filter %s: %w", p, f.ID, err)
+			}
+			if re.MatchString(command) {
+				res = f
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// LogFilteredCommand records the command matched by the filter in USERLOG, and notifies it by EventCommandFiltered
+func (c *Core) LogFilteredCommand(f *model.CommandFilter, user, asset, sysUser, command string) {
+	msg := fmt.Sprintf("%s command `%s` on %s as %s, filter %s(%s)", f.Action, command, asset, sysUser, f.Name, f.ID)
+	c.InsertLog("command", user, msg)
+	c.Publish(Event{Type: EventCommandFiltered, User: user, Asset: asset, Message: fmt.Sprintf("%s %s", user, msg)})
+}
+
+func (c *Core) getAssetNodeIDs(assetID string) ([]string, error) {
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, 5)
+	for _, n := range nodes {
+		if containString(n.AssetIDs, assetID) {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (c *Core) validateCommandFilter(f *model.CommandFilter) error {
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+	f.Action = strings.ToLower(f.Action)
+	if model.FilterActionLevel(f.Action) == 0 {
+		return fmt.Errorf("invalid action %s, the action is one of deny, confirm and warn", f.Action)
+	}
+	if len(f.Patterns) == 0 {
+		return errors.New("patterns are required")
+	}
+	for _, p := range f.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", p, err)
+		}
+	}
+	if len(f.UserIDs) > 0 {
+		users, err := c.GetAllUsers()
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(users))
+		for _, u := range users {
+			found = append(found, u.ID)
+		}
+		if id := missingID(f.UserIDs, found); id != "" {
+			return fmt.Errorf("user %s not found", id)
+		}
+	}
+	if len(f.NodeIDs) > 0 {
+		nodes, err := c.getNodes(f.NodeIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			found = append(found, n.ID)
+		}
+		if id := missingID(f.NodeIDs, found); id != "" {
+			return fmt.Errorf("node %s not found", id)
+		}
+	}
+	if len(f.SysUserIDs) > 0 {
+		sys, err := c.getSystemUsers(f.SysUserIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(sys))
+		for _, s := range sys {
+			found = append(found, s.ID)
+		}
+		if id := missingID(f.SysUserIDs, found); id != "" {
+			return fmt.Errorf("system user %s not found", id)
+		}
+	}
+	return nil
+}
+
+func (c *Core) AddCommandFilter(f *model.CommandFilter, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	f.ID, err = c.nextID("CMDFILTER")
+	if err != nil {
+		return err
+	}
+	if err = c.validateCommandFilter(f); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO CMDFILTER VALUES ?", f); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add command filter %s(%s)", f.Name, f.ID))
+	return nil
+}
+
+func (c *Core) UpdateCommandFilter(f *model.CommandFilter, admin string) error {
+	if err := c.validateCommandFilter(f); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE CMDFILTER SET name = ?, action = ?, patterns = ?, userids = ?, nodeids = ?, sysuserids = ?, isactive = ?, comment = ? WHERE id = ?",
+		f.Name, f.Action, f.Patterns, f.UserIDs, f.NodeIDs, f.SysUserIDs, f.IsActive, f.Comment, f.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit command filter %s(%s)", f.Name, f.ID))
+	return nil
+}
+
+func (c *Core) SetCommandFilterActive(id string, active bool, admin string) error {
+	f, err := c.GetCommandFilterById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.UpdateData("UPDATE CMDFILTER SET isactive = ? WHERE id = ?", active, id); err != nil {
+		return err
+	}
+	action := "disable"
+	if active {
+		action = "enable"
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("%s command filter %s(%s)", action, f.Name, id))
+	return nil
+}
+
+func (c *Core) DeleteCommandFilter(id string, admin string) error {
+	f, err := c.GetCommandFilterById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.DeleteData("DELETE FROM CMDFILTER WHERE id = ?", id); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("delete command filter %s(%s)", f.Name, id))
+	return nil
+}
+
+// detachCommandFilters adds the updates to remove the deleted user, node or system user from the filters to d.
+// A filter without any binding would apply to all sessions, so it is disabled instead.
+func (c *Core) detachCommandFilters(d *deletion, field string, id string) error {
+	filters, err := c.GetAllCommandFilters()
+	if err != nil {
+		return err
+	}
+	for _, f := range filters {
+		var ids *[]string
+		switch field {
+		case "userids":
+			ids = &f.UserIDs
+		case "nodeids":
+			ids = &f.NodeIDs
+		case "sysuserids":
+			ids = &f.SysUserIDs
+		}
+		if !containString(*ids, id) {
+			continue
+		}
+		*ids = removeString(*ids, id)
+		if f.IsGlobal() && f.IsActive {
+			f.IsActive = false
+			d.log(fmt.Sprintf("disable command filter %s(%s) without binding", f.Name, f.ID))
+		}
+		d.add(fmt.Sprintf("UPDATE CMDFILTER SET %s = ?, isactive = ? WHERE id = ?", field), *ids, f.IsActive, f.ID)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/config"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
@@ -18,6 +19,10 @@ type Core struct {
 	otpassword    map[string]string
 	loginLock     sync.RWMutex
 	tryLoginCount map[string]uint64
+	hostKeyLock   sync.Mutex
+	ticketLock    sync.Mutex
+	idLock        sync.Mutex
+	events        eventBus
 }
 
 func NewCore() *Core {
@@ -32,6 +37,24 @@ func NewCore() *Core {
 	if err != nil {
 		log.Fatal.Fatal(err)
 	}
+	masterKey, err := common.LoadMasterKey(config.GlobalConfig.SecretKeyFile, config.GlobalConfig.SecretKeyEnv)
+	if err != nil {
+		log.Fatal.Fatalf("Load master key failed: %s", err)
+	}
+	if masterKey == nil {
+		log.Warning.Print("No master key, secrets of system users and gateways are stored without encryption")
+	} else {
+		log.Info.Printf("Load master key %s", masterKey.ID())
+	}
+	common.SetMasterKey(masterKey)
+	for _, file := range config.GlobalConfig.SecretOldKeyFiles {
+		k, err := common.LoadMasterKey(file, "")
+		if err != nil {
+			log.Fatal.Fatalf("Load former master key %s failed: %s", file, err)
+		}
+		log.Info.Printf("Load former master key %s", k.ID())
+		common.AddMasterKey(k)
+	}
 	session := make(map[string]model.Session, 100)
 	otpass := make(map[string]string, 4)
 	tryLoginCnt := make(map[string]uint64, 10)
@@ -12,4 +12,37 @@ type DB interface {
 	QueryOneFieldMutilRows(sql string, cond ...interface{}) ([]string, error)
 	InsertData(sql string, data ...interface{}) error
 	UpdateData(sql string, args ...interface{}) error
+	DeleteData(sql string, args ...interface{}) error
+	// UpdateDataInTx runs the statements in one transaction, none of them is applied if one fails
+	UpdateDataInTx(stmts []Statement) error
+}
+
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// deletion collects the statements to delete an entity and detach it from others, which run in one
+// transaction, and the logs of the admin written after it
+type deletion struct {
+	stmts []Statement
+	logs  []string
+}
+
+func (d *deletion) add(sql string, args ...interface{}) {
+	d.stmts = append(d.stmts, Statement{sql, args})
+}
+
+func (d *deletion) log(msg string) {
+	d.logs = append(d.logs, msg)
+}
+
+func (c *Core) commitDeletion(d *deletion, admin string) error {
+	if err := c.db.UpdateDataInTx(d.stmts); err != nil {
+		return err
+	}
+	for _, msg := range d.logs {
+		c.InsertLog("admin", admin, msg)
+	}
+	return nil
 }
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// Types of the events published in the process
+const (
+	// the ticket waits for the reviewers of its current step, after it's created or a step is passed
+	EventTicketPending = "ticket_pending"
+	// the ticket is approved, rejected, closed, expired or a step of it is approved
+	EventTicketUpdated = "ticket_updated"
+
+	EventTicketCreated     = "ticket_created"
+	EventLoginBlocked      = "login_blocked"
+	EventSessionTerminated = "session_terminated"
+	EventCommandFiltered   = "command_filtered"
+	EventExpiredLogin      = "expired_account_login"
+)
+
+// SecurityEvents returns the types of the events which are worth notifying outside of the process
+func SecurityEvents() []string {
+	return []string{EventTicketCreated, EventLoginBlocked, EventSessionTerminated, EventCommandFiltered,
+		EventExpiredLogin}
+}
+
+const eventBufferSize = 16
+
+type Event struct {
+	Type    string
+	Time    time.Time
+	User    string
+	Asset   string
+	Message string
+	// only for the events of tickets
+	Ticket *model.LoginTicket
+}
+
+type eventSubscriber struct {
+	types []string
+	ch    chan Event
+}
+
+// eventBus delivers the events to the subscribers in the process, the events are dropped
+// for the subscribers which don't keep up, so they should never block for long.
+type eventBus struct {
+	lock   sync.RWMutex
+	subs   map[int]*eventSubscriber
+	nextID int
+}
+
+// Subscribe returns the channel of the events of the types, all events if no type is given.
+// The cancel function must be called to release the channel.
+func (c *Core) Subscribe(types ...string) (<-chan Event, func()) {
+	b := &c.events
+	sub := &eventSubscriber{types: types, ch: make(chan Event, eventBufferSize)}
+	b.lock.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]*eventSubscriber)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+	b.lock.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subs, id)
+			b.lock.Unlock()
+		})
+	}
+}
+
+// Publish delivers the event to the subscribers without blocking
+func (c *Core) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b := &c.events
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, sub := range b.subs {
+		if len(sub.types) > 0 && !containString(sub.types, e.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			log.Warning.Printf("Drop the event %s of a slow subscriber", e.Type)
+		}
+	}
+}
+
+// publishTicket publishes the event with the latest ticket
+func (c *Core) publishTicket(typ string, ticketId string) {
+	t, err := c.GetLoginTicket(ticketId)
+	if err != nil {
+		log.Error.Printf("Get ticket %s of the event %s failed: %s", ticketId, typ, err)
+		return
+	}
+	c.Publish(Event{Type: typ, User: t.Username, Asset: t.AssetName, Ticket: &t})
+}
@@ -0,0 +1,303 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// maxGatewayHops limits the gateways of a route, including the one bound to the asset
+const maxGatewayHops = 5
+
+func (c *Core) GetAllGateways() ([]model.Gateway, error) {
+	v, err := c.db.QueryStructs(model.GatewayType, "SELECT * FROM GATEWAY")
+	if err != nil {
+		return nil, err
+	}
+
+	gateways, ok := v.([]model.Gateway)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	return gateways, nil
+}
+
+func (c *Core) QueryAllGateway() ([]string, error) {
+	gateways, err := c.GetAllGateways()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range gateways {
+		pass := ""
+		key := ""
+		if v.Password != "" {
+			pass = "********"
+		}
+		if v.PrivateKey != "" {
+			key = "********"
+		}
+		s := fmt.Sprintf("%4s|%10s|%21s|%10s|%8s|%11s|%8d|%6t|%10s|%10s|%8s|%s", v.ID, v.Name,
+			fmt.Sprintf("%s:%d", v.IP, v.Port), v.Username, pass, key, v.Priority, v.IsActive,
+			strings.Join(v.AssetIDs, ","), strings.Join(v.NodeIDs, ","), strings.Join(v.ViaIDs, ","), v.Comment)
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (c *Core) GetGatewayById(id string) (model.Gateway, error) {
+	g := model.Gateway{}
+	err := c.db.QueryStruct(&g, "SELECT * FROM GATEWAY WHERE id = ?", id)
+	if err != nil {
+		return g, err
+	}
+	if g.ID == "" {
+		return g, fmt.Errorf("gateway %s %w", id, ErrNotFound)
+	}
+	return g, nil
+}
+
+// GetAssetGatewayRoutes returns the routes of the active gateways bound to the asset or its nodes,
+// in the order of priority. The asset is reached directly if there is none.
+func (c *Core) GetAssetGatewayRoutes(assetID string) ([]model.GatewayRoute, error) {
+	gateways, err := c.GetAllGateways()
+	if err != nil {
+		return nil, err
+	}
+	if len(gateways) == 0 {
+		return nil, nil
+	}
+	nodeIDs, err := c.getAssetNodeIDs(assetID)
+	if err != nil {
+		return nil, err
+	}
+	bound := make([]model.Gateway, 0, 2)
+	for _, g := range gateways {
+		if !g.IsActive {
+			continue
+		}
+		if containString(g.AssetIDs, assetID) {
+			bound = append(bound, g)
+			continue
+		}
+		for _, id := range g.NodeIDs {
+			if containString(nodeIDs, id) {
+				bound = append(bound, g)
+				break
+			}
+		}
+	}
+	model.SortGatewayByPriority(bound)
+	all := make(map[string]model.Gateway, len(gateways))
+	for _, g := range gateways {
+		all[g.ID] = g
+	}
+	res := make([]model.GatewayRoute, 0, len(bound))
+	for _, g := range bound {
+		route, err := resolveGatewayRoute(all, g, nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, route)
+	}
+	return res, nil
+}
+
+// resolveGatewayRoute follows the gateways to reach g, the inactive ones are skipped.
+// path holds the IDs of the gateways reached through g.
+func resolveGatewayRoute(all map[string]model.Gateway, g model.Gateway, path []string) (model.GatewayRoute, error) {
+	route := model.GatewayRoute{Gateway: g}
+	if containString(path, g.ID) {
+		return route, fmt.Errorf("gateway %s is reached through itself", g.ID)
+	}
+	path = append(path, g.ID)
+	if len(path) > maxGatewayHops {
+		return route, fmt.Errorf("gateway route of %s exceeds %d hops", strings.Join(path, ","), maxGatewayHops)
+	}
+	for _, id := range g.ViaIDs {
+		via, ok := all[id]
+		if !ok || !via.IsActive {
+			continue
+		}
+		r, err := resolveGatewayRoute(all, via, path)
+		if err != nil {
+			return route, err
+		}
+		route.Via = append(route.Via, r)
+	}
+	return route, nil
+}
+
+func (c *Core) validateGateway(g *model.Gateway) error {
+	if g.Name == "" {
+		return errors.New("name is required")
+	}
+	if g.IP == "" {
+		return errors.New("ip is required")
+	}
+	if g.Port == 0 {
+		g.Port = 22
+	}
+	if g.Port < 0 || g.Port > 65535 {
+		return fmt.Errorf("invalid port %d", g.Port)
+	}
+	if g.Username == "" {
+		return errors.New("username is required")
+	}
+	if g.Password == "" && g.PrivateKey == "" {
+		return errors.New("password or private key is required")
+	}
+	if g.PrivateKey != "" && !common.IsEncryptedSecret(g.PrivateKey) {
+		if _, err := gossh.ParsePrivateKey([]byte(g.PrivateKey)); err != nil {
+			return fmt.Errorf("invalid private key: %s", err)
+		}
+	}
+	if len(g.AssetIDs) > 0 {
+		assets, err := c.getAssets(g.AssetIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(assets))
+		for _, a := range assets {
+			found = append(found, a.ID)
+		}
+		if id := missingID(g.AssetIDs, found); id != "" {
+			return fmt.Errorf("asset %s not found", id)
+		}
+	}
+	if len(g.NodeIDs) > 0 {
+		nodes, err := c.getNodes(g.NodeIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			found = append(found, n.ID)
+		}
+		if id := missingID(g.NodeIDs, found); id != "" {
+			return fmt.Errorf("node %s not found", id)
+		}
+	}
+	if len(g.ViaIDs) == 0 {
+		return nil
+	}
+	gateways, err := c.GetAllGateways()
+	if err != nil {
+		return err
+	}
+	all := make(map[string]model.Gateway, len(gateways)+1)
+	for _, v := range gateways {
+		all[v.ID] = v
+	}
+	for _, id := range g.ViaIDs {
+		if _, ok := all[id]; !ok {
+			return fmt.Errorf("gateway %s not found", id)
+		}
+	}
+	// check the route as if all gateways are active
+	all[g.ID] = *g
+	for id, v := range all {
+		v.IsActive = true
+		all[id] = v
+	}
+	_, err = resolveGatewayRoute(all, all[g.ID], nil)
+	return err
+}
+
+func (c *Core) AddGateway(g *model.Gateway, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	g.ID, err = c.nextID("GATEWAY")
+	if err != nil {
+		return err
+	}
+	if err = c.validateGateway(g); err != nil {
+		return err
+	}
+	if err = encryptSecrets(&g.Password, &g.PrivateKey); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO GATEWAY VALUES ?", g); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add gateway %s(%s)", g.Name, g.ID))
+	return nil
+}
+
+func (c *Core) UpdateGateway(g *model.Gateway, admin string) error {
+	if err := c.validateGateway(g); err != nil {
+		return err
+	}
+	if err := encryptSecrets(&g.Password, &g.PrivateKey); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE GATEWAY SET name = ?, ip = ?, port = ?, username = ?, password = ?, privatekey = ?, priority = ?, assetids = ?, nodeids = ?, viaids = ?, isactive = ?, comment = ? WHERE id = ?",
+		g.Name, g.IP, g.Port, g.Username, g.Password, g.PrivateKey, g.Priority, g.AssetIDs, g.NodeIDs, g.ViaIDs,
+		g.IsActive, g.Comment, g.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit gateway %s(%s)", g.Name, g.ID))
+	return nil
+}
+
+func (c *Core) SetGatewayActive(id string, active bool, admin string) error {
+	g, err := c.GetGatewayById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.UpdateData("UPDATE GATEWAY SET isactive = ? WHERE id = ?", active, id); err != nil {
+		return err
+	}
+	action := "disable"
+	if active {
+		action = "enable"
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("%s gateway %s(%s)", action, g.Name, id))
+	return nil
+}
+
+func (c *Core) DeleteGateway(id string, admin string) error {
+	g, err := c.GetGatewayById(id)
+	if err != nil {
+		return err
+	}
+	d := &deletion{}
+	if err = c.detachGateways(d, "viaids", id); err != nil {
+		return err
+	}
+	d.add("DELETE FROM ASSETHOSTKEY WHERE assetid = ?", GatewayHostKeyID(id))
+	d.add("DELETE FROM GATEWAY WHERE id = ?", id)
+	d.log(fmt.Sprintf("delete gateway %s(%s)", g.Name, id))
+	return c.commitDeletion(d, admin)
+}
+
+// detachGateways adds the updates to remove the deleted asset, node or gateway from the gateways to d
+func (c *Core) detachGateways(d *deletion, field string, id string) error {
+	gateways, err := c.GetAllGateways()
+	if err != nil {
+		return err
+	}
+	for _, g := range gateways {
+		var ids []string
+		switch field {
+		case "assetids":
+			ids = g.AssetIDs
+		case "nodeids":
+			ids = g.NodeIDs
+		case "viaids":
+			ids = g.ViaIDs
+		}
+		if !containString(ids, id) {
+			continue
+		}
+		d.add(fmt.Sprintf("UPDATE GATEWAY SET %s = ? WHERE id = ?", field), removeString(ids, id), g.ID)
+	}
+	return nil
+}
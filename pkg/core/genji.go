@@ -2,6 +2,7 @@ package core
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/genjidb/genji"
 	"github.com/genjidb/genji/document"
@@ -14,7 +15,9 @@ type Genji struct {
 }
 
 type Model interface {
-	model.Asset | model.Node | model.User | model.SystemUser | model.AssetUserInfo | model.UserLog | model.LoginTicket | model.UserSecret
+	model.Asset | model.Node | model.User | model.SystemUser | model.AssetUserInfo | model.UserLog | model.LoginTicket | model.UserSecret |
+		model.AssetHostKey | model.APIToken | model.CommandFilter | model.CommandLog | model.Gateway |
+		model.AssetSecret | model.RotationLog | model.AssetHealth | model.ReviewFlow
 }
 
 func NewGenji(path string) (DB, error) {
@@ -22,9 +25,34 @@ func NewGenji(path string) (DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// tables added after the initial schema, so that existing databases keep working
+	for _, t := range []string{"ASSETHOSTKEY", "APITOKEN", "CMDFILTER", "CMDLOG", "GATEWAY", "ASSETSECRET", "ROTATIONLOG", "ASSETHEALTH", "REVIEWFLOW"} {
+		if err = createTableIfMissing(db, t); err != nil {
+			return nil, err
+		}
+	}
 	return &Genji{db: db}, nil
 }
 
+// createTableIfMissing looks up the catalog first, because CREATE TABLE IF NOT EXISTS
+// allocates a new sequence even if the table exists.
+func createTableIfMissing(db *genji.DB, table string) error {
+	res, err := db.Query("SELECT name FROM __genji_catalog WHERE name = ? AND type = 'table'", table)
+	if err != nil {
+		return err
+	}
+	found := false
+	err = res.Iterate(func(d types.Document) error {
+		found = true
+		return nil
+	})
+	res.Close()
+	if err != nil || found {
+		return err
+	}
+	return db.Exec(fmt.Sprintf("CREATE TABLE %s", table))
+}
+
 func (g *Genji) Close() error {
 	return g.db.Close()
 }
@@ -111,6 +139,24 @@ func (g *Genji) QueryStructs(mod int, sql string, cond ...interface{}) (interfac
 		return queryStructs[model.LoginTicket](g.db, sql, cond...)
 	case model.UserSecretType:
 		return queryStructs[model.UserSecret](g.db, sql, cond...)
+	case model.AssetHostKeyType:
+		return queryStructs[model.AssetHostKey](g.db, sql, cond...)
+	case model.APITokenType:
+		return queryStructs[model.APIToken](g.db, sql, cond...)
+	case model.CommandFilterType:
+		return queryStructs[model.CommandFilter](g.db, sql, cond...)
+	case model.CommandLogType:
+		return queryStructs[model.CommandLog](g.db, sql, cond...)
+	case model.GatewayType:
+		return queryStructs[model.Gateway](g.db, sql, cond...)
+	case model.AssetSecretType:
+		return queryStructs[model.AssetSecret](g.db, sql, cond...)
+	case model.RotationLogType:
+		return queryStructs[model.RotationLog](g.db, sql, cond...)
+	case model.AssetHealthType:
+		return queryStructs[model.AssetHealth](g.db, sql, cond...)
+	case model.ReviewFlowType:
+		return queryStructs[model.ReviewFlow](g.db, sql, cond...)
 	}
 	return nil, errors.New("invalid model type")
 }
@@ -160,3 +206,22 @@ func (g *Genji) UpdateData(sql string, args ...interface{}) error {
 	err := g.db.Exec(sql, args...)
 	return err
 }
+
+func (g *Genji) UpdateDataInTx(stmts []Statement) error {
+	tx, err := g.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, s := range stmts {
+		if err = tx.Exec(s.SQL, s.Args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (g *Genji) DeleteData(sql string, args ...interface{}) error {
+	err := g.db.Exec(sql, args...)
+	return err
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// SaveAssetHealth replaces the result of the last check of the asset
+func (c *Core) SaveAssetHealth(h *model.AssetHealth) error {
+	h.CheckDate = time.Now().Format(common.LogFormat)
+	return c.db.UpdateDataInTx([]Statement{
+		{"DELETE FROM ASSETHEALTH WHERE assetid = ?", []interface{}{h.AssetID}},
+		{"INSERT INTO ASSETHEALTH VALUES ?", []interface{}{h}},
+	})
+}
+
+// GetAssetHealths returns the results of the last checks by asset ID
+func (c *Core) GetAssetHealths() (map[string]model.AssetHealth, error) {
+	v, err := c.db.QueryStructs(model.AssetHealthType, "SELECT * FROM ASSETHEALTH")
+	if err != nil {
+		return nil, err
+	}
+
+	healths, ok := v.([]model.AssetHealth)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	res := make(map[string]model.AssetHealth, len(healths))
+	for _, h := range healths {
+		res[h.AssetID] = h
+	}
+	return res, nil
+}
+
+// GetAssetSystemUsers returns the system users granted on the asset
+func (c *Core) GetAssetSystemUsers(assetID string) ([]model.SystemUser, error) {
+	aus, err := c.GetAllAssetUserInfos()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, 5)
+	for _, au := range aus {
+		if au.AssetID != assetID {
+			continue
+		}
+		for _, id := range au.SysUserID {
+			if !containString(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return c.getSystemUsers(ids)
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	ErrNoPendingKey    = errors.New("no pending host key")
+)
+
+// AssetHostKeyCallback pins the first host key presented by the asset (trust on first use)
+// and refuses any different key until an admin accepts it.
+func (c *Core) AssetHostKeyCallback(asset *model.Asset, username string) gossh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		return c.verifyHostKey(asset.ID, asset.Name, username, hostname, key)
+	}
+}
+
+// GatewayHostKeyCallback pins the host keys of the gateways like the assets, by the ID from GatewayHostKeyID.
+func (c *Core) GatewayHostKeyCallback(username string) func(gateway *model.Gateway) gossh.HostKeyCallback {
+	return func(gateway *model.Gateway) gossh.HostKeyCallback {
+		id, name := GatewayHostKeyID(gateway.ID), gateway.Name
+		return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+			return c.verifyHostKey(id, name, username, hostname, key)
+		}
+	}
+}
+
+// GatewayHostKeyID is the ID of the pinned host key of the gateway, which differs from the asset IDs
+func GatewayHostKeyID(id string) string {
+	return "gw" + id
+}
+
+// verifyHostKey checks the key against the pinned one, addr is the dialed address,
+// as the remote address is unknown through the gateways.
+func (c *Core) verifyHostKey(id string, name string, username string, addr string,
+	key gossh.PublicKey) error {
+	c.hostKeyLock.Lock()
+	defer c.hostKeyLock.Unlock()
+	pin, err := c.GetAssetHostKey(id)
+	if err != nil {
+		log.Error.Printf("query host key of %s failed, %s", name, err)
+		return err
+	}
+	pubKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+	fp := gossh.FingerprintSHA256(key)
+	date := time.Now().Format(common.LogFormat)
+	if pin.AssetID == "" {
+		pin = model.AssetHostKey{
+			AssetID:     id,
+			Address:     addr,
+			PublicKey:   pubKey,
+			Fingerprint: fp,
+			CreateDate:  date,
+			UpdateDate:  date,
+		}
+		err = c.db.InsertData("INSERT INTO ASSETHOSTKEY VALUES ?", &pin)
+		if err != nil {
+			log.Error.Printf("insert host key of %s failed, %s", name, err)
+			return err
+		}
+		c.InsertLog("hostkey", username, fmt.Sprintf("pin host key %s of %s", fp, name))
+		log.Info.Printf("Pin host key %s of %s(%s)", fp, name, addr)
+		return nil
+	}
+	if pin.PublicKey == pubKey {
+		return nil
+	}
+	if pin.PendingKey != pubKey {
+		err = c.db.UpdateData("UPDATE ASSETHOSTKEY SET pendingkey = ?, pendingfingerprint = ?, updatedate = ? WHERE assetid = ?",
+			pubKey, fp, date, id)
+		if err != nil {
+			log.Error.Printf("update pending host key of %s failed, %s", name, err)
+		}
+	}
+	c.InsertLog("hostkey", username, fmt.Sprintf("refuse host key %s of %s, pinned %s",
+		fp, name, pin.Fingerprint))
+	log.Warning.Printf("Host key of %s(%s) changed from %s to %s", name, addr, pin.Fingerprint, fp)
+	return fmt.Errorf("%w: %s presented %s", ErrHostKeyMismatch, name, fp)
+}
+
+func (c *Core) GetAssetHostKey(assetID string) (model.AssetHostKey, error) {
+	pin := model.AssetHostKey{}
+	err := c.db.QueryStruct(&pin, "SELECT * FROM ASSETHOSTKEY WHERE assetid = ?", assetID)
+	return pin, err
+}
+
+func (c *Core) AcceptAssetHostKey(assetID string, admin string) error {
+	c.hostKeyLock.Lock()
+	defer c.hostKeyLock.Unlock()
+	pin, err := c.GetAssetHostKey(assetID)
+	if err != nil {
+		return err
+	}
+	if pin.PendingKey == "" {
+		return ErrNoPendingKey
+	}
+	date := time.Now().Format(common.LogFormat)
+	err = c.db.UpdateData("UPDATE ASSETHOSTKEY SET publickey = ?, fingerprint = ?, pendingkey = ?, pendingfingerprint = ?, updatedate = ? WHERE assetid = ?",
+		pin.PendingKey, pin.PendingFingerprint, "", "", date, assetID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("hostkey", admin, fmt.Sprintf("accept host key %s of asset %s", pin.PendingFingerprint, assetID))
+	return nil
+}
+
+func (c *Core) RevokeAssetHostKey(assetID string, admin string) error {
+	c.hostKeyLock.Lock()
+	defer c.hostKeyLock.Unlock()
+	err := c.db.DeleteData("DELETE FROM ASSETHOSTKEY WHERE assetid = ?", assetID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("hostkey", admin, fmt.Sprintf("revoke host key of asset %s", assetID))
+	return nil
+}
+
+func (c *Core) QueryAllAssetHostKey() ([]string, error) {
+	v, err := c.db.QueryStructs(model.AssetHostKeyType, "SELECT * FROM ASSETHOSTKEY")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, ok := v.([]model.AssetHostKey)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range keys {
+		s := fmt.Sprintf("%8s|%21s|%s|%s|%s", v.AssetID, v.Address, v.UpdateDate,
+			v.Fingerprint, v.PendingFingerprint)
+		res = append(res, s)
+	}
+	return res, nil
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/handewo/gojump/pkg/common"
@@ -10,7 +11,7 @@ import (
 	"github.com/handewo/gojump/pkg/model"
 )
 
-func (c *Core) QueryUserLog() ([]string, error) {
+func (c *Core) GetUserLogs() ([]model.UserLog, error) {
 	v, err := c.db.QueryStructs(model.UserlogType, "SELECT * FROM USERLOG")
 	if err != nil {
 		return nil, err
@@ -20,6 +21,11 @@ func (c *Core) QueryUserLog() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return logs, nil
+}
+
+func (c *Core) QueryUserLog() ([]string, error) {
+	logs, err := c.GetUserLogs()
 	if err != nil {
 		return nil, err
 	}
@@ -58,3 +64,63 @@ func (c *Core) InsertLog(tp, user, msg string) {
 		log.Error.Printf("insert log failed, %s", err)
 	}
 }
+
+func (c *Core) InsertCommandLog(cl *model.CommandLog) {
+	cl.Datetime = time.Now().Format(common.LogFormat)
+	err := c.db.InsertData("INSERT INTO CMDLOG VALUES ?", cl)
+	if err != nil {
+		log.Error.Printf("insert command log failed, %s", err)
+	}
+}
+
+// GetCommandLogs returns the commands ordered by time, the asset matches the name or the id,
+// from and to are in the log format, empty conditions are ignored.
+func (c *Core) GetCommandLogs(user, asset, from, to string) ([]model.CommandLog, error) {
+	sql := "SELECT * FROM CMDLOG WHERE datetime >= ?"
+	args := []interface{}{from}
+	if to != "" {
+		sql += " AND datetime <= ?"
+		args = append(args, to)
+	}
+	if user != "" {
+		sql += " AND user = ?"
+		args = append(args, user)
+	}
+	v, err := c.db.QueryStructs(model.CommandLogType, sql+" ORDER BY datetime", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, ok := v.([]model.CommandLog)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	if asset == "" {
+		return logs, nil
+	}
+	res := make([]model.CommandLog, 0, len(logs))
+	for _, l := range logs {
+		if l.AssetID == asset || l.Asset == asset || strings.HasPrefix(l.Asset, asset+"(") {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
+
+// QueryCommandLog returns the latest commands, limit 0 means no limit
+func (c *Core) QueryCommandLog(user, asset, from, to string, limit int) ([]string, error) {
+	logs, err := c.GetCommandLogs(user, asset, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(logs) > limit {
+		logs = logs[len(logs)-limit:]
+	}
+
+	res := make([]string, 0, len(logs))
+	for _, l := range logs {
+		res = append(res, fmt.Sprintf("%s|%8s|%10s|%20s|%10s|%7s|%s", l.Datetime, l.SessionID[:8], l.User,
+			l.Asset, l.SystemUser, model.RiskLevelName(l.RiskLevel), l.Command))
+	}
+	return res, nil
+}
@@ -22,6 +22,21 @@ func (c *Core) getNodes(nodeIDs []string) ([]model.Node, error) {
 }
 
 func (c *Core) QueryAllNode() ([]string, error) {
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range nodes {
+		as := strings.Join(v.AssetIDs, ",")
+		s := fmt.Sprintf("%4s|%10s|%10s|%11s|%s", v.ID, v.Name, v.Key, replayDaysString(v.ReplayKeepDays), as)
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (c *Core) GetAllNodes() ([]model.Node, error) {
 	v, err := c.db.QueryStructs(model.NodeType, "SELECT * FROM NODE")
 	if err != nil {
 		return nil, err
@@ -31,12 +46,172 @@ func (c *Core) QueryAllNode() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return nodes, nil
+}
 
-	res := make([]string, 0, 10)
-	for _, v := range nodes {
-		as := strings.Join(v.AssetIDs, ",")
-		s := fmt.Sprintf("%4s|%10s|%10s|%s", v.ID, v.Name, v.Key, as)
-		res = append(res, s)
+func (c *Core) GetNodeById(nodeID string) (model.Node, error) {
+	node := model.Node{}
+	err := c.db.QueryStruct(&node, "SELECT * FROM NODE WHERE id = ?", nodeID)
+	if err != nil {
+		return node, err
+	}
+	if node.ID == "" {
+		return node, fmt.Errorf("node %s %w", nodeID, ErrNotFound)
+	}
+	return node, nil
+}
+
+// GetNodeAssets returns the active assets of the node
+func (c *Core) GetNodeAssets(nodeID string) ([]model.Asset, error) {
+	node, err := c.GetNodeById(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(node.AssetIDs) == 0 {
+		return nil, nil
+	}
+	assets, err := c.getAssets(node.AssetIDs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Asset, 0, len(assets))
+	for _, a := range assets {
+		if a.IsActive {
+			res = append(res, a)
+		}
 	}
 	return res, nil
 }
+
+func (c *Core) validateNode(node *model.Node) error {
+	if node.Name == "" {
+		return errors.New("node name is required")
+	}
+	if !model.ValidNodeKey(node.Key) {
+		return fmt.Errorf("invalid node key %s, the format is numbers separated by colons, such as 1:3:0", node.Key)
+	}
+	if node.ReplayKeepDays < -1 {
+		return fmt.Errorf("invalid replay days %d", node.ReplayKeepDays)
+	}
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return err
+	}
+	parent := model.ParentNodeKey(node.Key)
+	parentFound := parent == ""
+	for _, n := range nodes {
+		if n.ID == node.ID {
+			continue
+		}
+		if n.Key == node.Key {
+			return fmt.Errorf("node key %s already exists", node.Key)
+		}
+		if n.Key == parent {
+			parentFound = true
+		}
+	}
+	if !parentFound {
+		return fmt.Errorf("parent node %s not found", parent)
+	}
+	if len(node.AssetIDs) > 0 {
+		assets, err := c.getAssets(node.AssetIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(assets))
+		for _, a := range assets {
+			found = append(found, a.ID)
+		}
+		if id := missingID(node.AssetIDs, found); id != "" {
+			return fmt.Errorf("asset %s not found", id)
+		}
+	}
+	return nil
+}
+
+func (c *Core) AddNode(node *model.Node, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	node.ID, err = c.nextID("NODE")
+	if err != nil {
+		return err
+	}
+	if err = c.validateNode(node); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO NODE VALUES ?", node); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add node %s(%s)", node.Name, node.ID))
+	return nil
+}
+
+func (c *Core) UpdateNode(node *model.Node, admin string) error {
+	old, err := c.GetNodeById(node.ID)
+	if err != nil {
+		return err
+	}
+	if old.Key != node.Key {
+		if err = c.checkNoChildNode(old.Key); err != nil {
+			return err
+		}
+	}
+	if err = c.validateNode(node); err != nil {
+		return err
+	}
+	err = c.db.UpdateData("UPDATE NODE SET `key` = ?, name = ?, assetids = ?, replaykeepdays = ? WHERE id = ?",
+		node.Key, node.Name, node.AssetIDs, node.ReplayKeepDays, node.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit node %s(%s)", node.Name, node.ID))
+	return nil
+}
+
+func (c *Core) checkNoChildNode(key string) error {
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if model.ParentNodeKey(n.Key) == key {
+			return fmt.Errorf("node %s has child node %s", key, n.Key)
+		}
+	}
+	return nil
+}
+
+// DeleteNode removes a node without children and detaches it from users and command filters.
+func (c *Core) DeleteNode(nodeID string, admin string) error {
+	node, err := c.GetNodeById(nodeID)
+	if err != nil {
+		return err
+	}
+	if err = c.checkNoChildNode(node.Key); err != nil {
+		return err
+	}
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	d := &deletion{}
+	for _, u := range users {
+		if !containString(u.NodeIDs, nodeID) {
+			continue
+		}
+		d.add("UPDATE USER SET nodeids = ? WHERE id = ?", removeString(u.NodeIDs, nodeID), u.ID)
+	}
+	if err = c.detachCommandFilters(d, "nodeids", nodeID); err != nil {
+		return err
+	}
+	if err = c.detachGateways(d, "nodeids", nodeID); err != nil {
+		return err
+	}
+	if err = c.detachReviewFlows(d, "nodeids", nodeID); err != nil {
+		return err
+	}
+	d.add("DELETE FROM NODE WHERE id = ?", nodeID)
+	d.log(fmt.Sprintf("delete node %s(%s)", node.Name, nodeID))
+	return c.commitDeletion(d, admin)
+}
@@ -2,12 +2,15 @@ package core
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math/big"
 	"time"
 
+	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/config"
 	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
 )
 
 func (c *Core) GenOTPassword(name string) string {
@@ -63,3 +66,91 @@ func randomPass() string {
 	log.Error.Printf("generate random number error: %s", err)
 	return "10957890"
 }
+
+func (c *Core) getUserSecret(userID string) (model.UserSecret, error) {
+	var sec model.UserSecret
+	err := c.db.QueryStruct(&sec, "SELECT * FROM USERSECRET WHERE userid = ?", userID)
+	if err != nil {
+		return sec, err
+	}
+	if sec.UserID == "" {
+		return sec, fmt.Errorf("querying secret of user %s failed", userID)
+	}
+	return sec, nil
+}
+
+func (c *Core) IsTOTPEnrolled(user *model.User) bool {
+	sec, err := c.getUserSecret(user.ID)
+	if err != nil {
+		log.Error.Print(err)
+		return false
+	}
+	return sec.TOTPSecret != ""
+}
+
+func (c *Core) VerifyTOTP(user *model.User, code string) bool {
+	// the secret is read in the lock, so that a code is accepted once by concurrent logins
+	c.otpLock.Lock()
+	defer c.otpLock.Unlock()
+	sec, err := c.getUserSecret(user.ID)
+	if err != nil {
+		log.Error.Print(err)
+		return false
+	}
+	if sec.TOTPSecret == "" {
+		return false
+	}
+	counter, ok := common.ValidateTOTP(sec.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	// a code can only be used once, even after restart
+	if int64(counter) <= sec.TOTPCounter {
+		log.Info.Printf("TOTP code of %s is replayed", user.Username)
+		return false
+	}
+	err = c.db.UpdateData("UPDATE USERSECRET SET totpcounter = ? WHERE userid = ?", int64(counter), user.ID)
+	if err != nil {
+		log.Error.Printf("Update TOTP counter of %s failed: %s", user.Username, err)
+		return false
+	}
+	return true
+}
+
+func (c *Core) EnrollTOTP(user *model.User, secret string, code string) error {
+	counter, ok := common.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return errors.New("invalid verification code")
+	}
+	if err := encryptSecrets(&secret); err != nil {
+		return err
+	}
+	// the code of the enrollment can't be used to login
+	err := c.db.UpdateData("UPDATE USERSECRET SET totpsecret = ?, totpcounter = ? WHERE userid = ?",
+		secret, int64(counter), user.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("totp", user.Username, "enroll totp authenticator")
+	return nil
+}
+
+func (c *Core) ResetTOTP(username string, admin string) error {
+	user, err := c.GetUser(username)
+	if err != nil {
+		return err
+	}
+	if err = c.CheckUserAdmin(admin, &user); err != nil {
+		return err
+	}
+	err = c.db.UpdateData("UPDATE USER SET otplevel = ? WHERE id = ?", model.OTPLevelTOTP, user.ID)
+	if err != nil {
+		return err
+	}
+	err = c.db.UpdateData("UPDATE USERSECRET SET totpsecret = ?, totpcounter = ? WHERE userid = ?", "", 0, user.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("totp", admin, fmt.Sprintf("reset totp authenticator of %s", username))
+	return nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"strconv"
+)
+
+// ReplayRetention is the days to keep the replays of users and assets, which override REPLAY_KEEP_DAYS.
+// -1 keeps the replays forever.
+type ReplayRetention struct {
+	Users  map[string]int
+	Assets map[string]int
+}
+
+// KeepDays returns the longest days of the user and the asset, or def if neither is set
+func (r *ReplayRetention) KeepDays(username, assetName string, def int) int {
+	days, ok := 0, false
+	for _, d := range []int{r.Users[username], r.Assets[assetName]} {
+		switch {
+		case d == 0:
+			continue
+		case d < 0:
+			return -1
+		case !ok || d > days:
+			days, ok = d, true
+		}
+	}
+	if !ok {
+		return def
+	}
+	return days
+}
+
+// HasLimit reports whether any user or asset keeps the replays for limited days
+func (r *ReplayRetention) HasLimit() bool {
+	for _, m := range []map[string]int{r.Users, r.Assets} {
+		for _, d := range m {
+			if d > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetReplayRetention returns the days of the users by username, and the days of the assets by asset name
+// from the longest one of their nodes.
+func (c *Core) GetReplayRetention() (*ReplayRetention, error) {
+	res := &ReplayRetention{Users: make(map[string]int), Assets: make(map[string]int)}
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.ReplayKeepDays != 0 {
+			res.Users[u.Username] = u.ReplayKeepDays
+		}
+	}
+	nodes, err := c.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	assetDays := make(map[string]int)
+	for _, n := range nodes {
+		if n.ReplayKeepDays == 0 {
+			continue
+		}
+		for _, id := range n.AssetIDs {
+			d, ok := assetDays[id]
+			if !ok || (d > 0 && (n.ReplayKeepDays < 0 || n.ReplayKeepDays > d)) {
+				assetDays[id] = n.ReplayKeepDays
+			}
+		}
+	}
+	if len(assetDays) == 0 {
+		return res, nil
+	}
+	assets, err := c.GetAllAssets()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range assets {
+		if d, ok := assetDays[a.ID]; ok {
+			res.Assets[a.Name] = d
+		}
+	}
+	return res, nil
+}
+
+func replayDaysString(days int) string {
+	switch days {
+	case 0:
+		return "default"
+	case -1:
+		return "forever"
+	}
+	return strconv.Itoa(days)
+}
@@ -0,0 +1,338 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+func (c *Core) GetAllReviewFlows() ([]model.ReviewFlow, error) {
+	v, err := c.db.QueryStructs(model.ReviewFlowType, "SELECT * FROM REVIEWFLOW")
+	if err != nil {
+		return nil, err
+	}
+
+	flows, ok := v.([]model.ReviewFlow)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	return flows, nil
+}
+
+func (c *Core) QueryAllReviewFlow() ([]string, error) {
+	flows, err := c.GetAllReviewFlows()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, 10)
+	for _, v := range flows {
+		s := fmt.Sprintf("%4s|%10s|%6t|%10s|%10s|%s|%s", v.ID, v.Name, v.IsActive,
+			strings.Join(v.AssetIDs, ","), strings.Join(v.NodeIDs, ","), ReviewStepsString(v.Steps), v.Comment)
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// ReviewStepsString formats the steps as the value of the steps key, such as 4|5|6:2,7
+func ReviewStepsString(steps []model.ReviewStep) string {
+	res := make([]string, 0, len(steps))
+	for _, s := range steps {
+		res = append(res, fmt.Sprintf("%s:%d", strings.Join(s.ReviewerIDs, "|"), s.Required))
+	}
+	return strings.Join(res, ",")
+}
+
+// ParseReviewSteps parses the steps separated by commas, each step is the IDs of the reviewers separated
+// by | and the number of them required, which is 1 if omitted.
+func ParseReviewSteps(v string) ([]model.ReviewStep, error) {
+	res := make([]model.ReviewStep, 0, 2)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		step := model.ReviewStep{Required: 1}
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid required reviewers of %s", item)
+			}
+			step.Required = n
+			item = item[:i]
+		}
+		for _, id := range strings.Split(item, "|") {
+			if id = strings.TrimSpace(id); id != "" {
+				step.ReviewerIDs = append(step.ReviewerIDs, id)
+			}
+		}
+		res = append(res, step)
+	}
+	return res, nil
+}
+
+func (c *Core) GetReviewFlowById(id string) (model.ReviewFlow, error) {
+	f := model.ReviewFlow{}
+	err := c.db.QueryStruct(&f, "SELECT * FROM REVIEWFLOW WHERE id = ?", id)
+	if err != nil {
+		return f, err
+	}
+	if f.ID == "" {
+		return f, fmt.Errorf("review flow %s %w", id, ErrNotFound)
+	}
+	return f, nil
+}
+
+func (c *Core) validateReviewFlow(f *model.ReviewFlow) error {
+	if f.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(f.Steps) == 0 {
+		return errors.New("steps are required")
+	}
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for i, s := range f.Steps {
+		if len(s.ReviewerIDs) == 0 {
+			return fmt.Errorf("reviewers of step %d are required", i+1)
+		}
+		if s.Required < 1 || s.Required > len(s.ReviewerIDs) {
+			return fmt.Errorf("step %d requires %d of %d reviewers", i+1, s.Required, len(s.ReviewerIDs))
+		}
+		for _, id := range s.ReviewerIDs {
+			var user *model.User
+			for j := range users {
+				if users[j].ID == id {
+					user = &users[j]
+					break
+				}
+			}
+			if user == nil {
+				return fmt.Errorf("user %s not found", id)
+			}
+			if !model.HasPermission(user.Role, model.PermReviewTicket) {
+				return fmt.Errorf("user %s of the role %s can not review tickets", user.Username, user.Role)
+			}
+		}
+	}
+	if len(f.AssetIDs) > 0 {
+		assets, err := c.getAssets(f.AssetIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(assets))
+		for _, a := range assets {
+			found = append(found, a.ID)
+		}
+		if id := missingID(f.AssetIDs, found); id != "" {
+			return fmt.Errorf("asset %s not found", id)
+		}
+	}
+	if len(f.NodeIDs) > 0 {
+		nodes, err := c.getNodes(f.NodeIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			found = append(found, n.ID)
+		}
+		if id := missingID(f.NodeIDs, found); id != "" {
+			return fmt.Errorf("node %s not found", id)
+		}
+	}
+	return nil
+}
+
+func (c *Core) AddReviewFlow(f *model.ReviewFlow, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	f.ID, err = c.nextID("REVIEWFLOW")
+	if err != nil {
+		return err
+	}
+	if err = c.validateReviewFlow(f); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO REVIEWFLOW VALUES ?", f); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add review flow %s(%s)", f.Name, f.ID))
+	return nil
+}
+
+func (c *Core) UpdateReviewFlow(f *model.ReviewFlow, admin string) error {
+	if err := c.validateReviewFlow(f); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE REVIEWFLOW SET name = ?, steps = ?, assetids = ?, nodeids = ?, isactive = ?, comment = ? WHERE id = ?",
+		f.Name, f.Steps, f.AssetIDs, f.NodeIDs, f.IsActive, f.Comment, f.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit review flow %s(%s)", f.Name, f.ID))
+	return nil
+}
+
+func (c *Core) SetReviewFlowActive(id string, active bool, admin string) error {
+	f, err := c.GetReviewFlowById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.UpdateData("UPDATE REVIEWFLOW SET isactive = ? WHERE id = ?", active, id); err != nil {
+		return err
+	}
+	action := "disable"
+	if active {
+		action = "enable"
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("%s review flow %s(%s)", action, f.Name, id))
+	return nil
+}
+
+func (c *Core) DeleteReviewFlow(id string, admin string) error {
+	f, err := c.GetReviewFlowById(id)
+	if err != nil {
+		return err
+	}
+	if err = c.db.DeleteData("DELETE FROM REVIEWFLOW WHERE id = ?", id); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("delete review flow %s(%s)", f.Name, id))
+	return nil
+}
+
+// detachReviewFlows adds the updates to remove the deleted asset, node or reviewer from the flows to d.
+// A flow without any asset or node would apply to all tickets, so it is disabled instead. A flow without
+// the reviewer is kept even if a step can not be passed any more, so the tickets are never reviewed by
+// less reviewers than required.
+func (c *Core) detachReviewFlows(d *deletion, field string, id string) error {
+	flows, err := c.GetAllReviewFlows()
+	if err != nil {
+		return err
+	}
+	for _, f := range flows {
+		var value interface{}
+		switch field {
+		case "assetids", "nodeids":
+			ids := &f.AssetIDs
+			if field == "nodeids" {
+				ids = &f.NodeIDs
+			}
+			if !containString(*ids, id) {
+				continue
+			}
+			*ids = removeString(*ids, id)
+			value = *ids
+			if len(f.AssetIDs) == 0 && len(f.NodeIDs) == 0 && f.IsActive {
+				d.add("UPDATE REVIEWFLOW SET isactive = ? WHERE id = ?", false, f.ID)
+				d.log(fmt.Sprintf("disable review flow %s(%s) without binding", f.Name, f.ID))
+			}
+		case "steps":
+			found := false
+			for i := range f.Steps {
+				if containString(f.Steps[i].ReviewerIDs, id) {
+					f.Steps[i].ReviewerIDs = removeString(f.Steps[i].ReviewerIDs, id)
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			value = f.Steps
+		}
+		d.add(fmt.Sprintf("UPDATE REVIEWFLOW SET %s = ? WHERE id = ?", field), value, f.ID)
+	}
+	return nil
+}
+
+// getReviewFlow returns the active flow of the asset, then the one of its nodes, then the one without
+// any asset or node. The earliest created one wins if several flows apply, nil if none applies.
+func (c *Core) getReviewFlow(assetID string) (*model.ReviewFlow, error) {
+	flows, err := c.GetAllReviewFlows()
+	if err != nil {
+		return nil, err
+	}
+	// the flows are returned in the order of their ids as strings, where "10" is before "9"
+	sort.Slice(flows, func(i, j int) bool {
+		return lessID(flows[i].ID, flows[j].ID)
+	})
+	var nodeIDs []string
+	var byNode, global *model.ReviewFlow
+	for i := range flows {
+		f := &flows[i]
+		if !f.IsActive {
+			continue
+		}
+		if containString(f.AssetIDs, assetID) {
+			return f, nil
+		}
+		if len(f.AssetIDs) == 0 && len(f.NodeIDs) == 0 {
+			if global == nil {
+				global = f
+			}
+			continue
+		}
+		if byNode != nil || len(f.NodeIDs) == 0 {
+			continue
+		}
+		if nodeIDs == nil {
+			if nodeIDs, err = c.getAssetNodeIDs(assetID); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range f.NodeIDs {
+			if containString(nodeIDs, id) {
+				byNode = f
+				break
+			}
+		}
+	}
+	if byNode != nil {
+		return byNode, nil
+	}
+	return global, nil
+}
+
+// getTicketSteps resolves the reviewers of the flow of the asset to the usernames of the active reviewers,
+// the ticket has no steps if no flow applies.
+func (c *Core) getTicketSteps(assetID string) ([]model.TicketStep, error) {
+	f, err := c.getReviewFlow(assetID)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		if u.IsActive && model.HasPermission(u.Role, model.PermReviewTicket) {
+			names[u.ID] = u.Username
+		}
+	}
+	steps := make([]model.TicketStep, 0, len(f.Steps))
+	for i, s := range f.Steps {
+		step := model.TicketStep{Required: s.Required, Reviewers: make([]string, 0, len(s.ReviewerIDs))}
+		for _, id := range s.ReviewerIDs {
+			if name, ok := names[id]; ok {
+				step.Reviewers = append(step.Reviewers, name)
+			}
+		}
+		if len(step.Reviewers) < step.Required {
+			log.Error.Printf("Step %d of review flow %s(%s) has %d reviewers available, %d required",
+				i+1, f.Name, f.ID, len(step.Reviewers), step.Required)
+			return nil, fmt.Errorf("review flow %s can not be passed", f.Name)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+func (c *Core) getAssetSecret(sysUserID string, assetID string) (model.AssetSecret, error) {
+	sec := model.AssetSecret{}
+	err := c.db.QueryStruct(&sec, "SELECT * FROM ASSETSECRET WHERE sysuserid = ? AND assetid = ?", sysUserID, assetID)
+	return sec, err
+}
+
+// ApplyAssetSecret replaces the secrets of the system user by the rotated ones on the asset
+func (c *Core) ApplyAssetSecret(assetID string, sys *model.SystemUser) error {
+	sec, err := c.getAssetSecret(sys.ID, assetID)
+	if err != nil {
+		return err
+	}
+	if sec.SysUserID == "" {
+		return nil
+	}
+	sys.Password = sec.Password
+	sys.PrivateKey = sec.PrivateKey
+	return nil
+}
+
+// SaveAssetSecret stores the rotated secrets of the system user on the asset
+func (c *Core) SaveAssetSecret(sysUserID string, assetID string, password string, privateKey string) error {
+	sec := model.AssetSecret{
+		SysUserID:  sysUserID,
+		AssetID:    assetID,
+		Password:   password,
+		PrivateKey: privateKey,
+		UpdateDate: time.Now().Format(common.LogFormat),
+	}
+	if err := encryptSecrets(&sec.Password, &sec.PrivateKey); err != nil {
+		return err
+	}
+	// in one transaction, so the secret is never lost between the delete and the insert
+	return c.db.UpdateDataInTx([]Statement{
+		{"DELETE FROM ASSETSECRET WHERE sysuserid = ? AND assetid = ?", []interface{}{sysUserID, assetID}},
+		{"INSERT INTO ASSETSECRET VALUES ?", []interface{}{&sec}},
+	})
+}
+
+// SetPendingAssetSecret stores the new password before it's applied on the asset, so it's never lost if the
+// rotation fails halfway. The current secrets of sys are kept for the asset which has not been rotated.
+func (c *Core) SetPendingAssetSecret(sys *model.SystemUser, assetID string, password string) error {
+	if err := encryptSecrets(&password); err != nil {
+		return err
+	}
+	sec, err := c.getAssetSecret(sys.ID, assetID)
+	if err != nil {
+		return err
+	}
+	if sec.SysUserID != "" {
+		return c.db.UpdateData("UPDATE ASSETSECRET SET pendingpassword = ? WHERE sysuserid = ? AND assetid = ?",
+			password, sys.ID, assetID)
+	}
+	sec = model.AssetSecret{
+		SysUserID:       sys.ID,
+		AssetID:         assetID,
+		Password:        sys.Password,
+		PrivateKey:      sys.PrivateKey,
+		PendingPassword: password,
+		UpdateDate:      time.Now().Format(common.LogFormat),
+	}
+	return c.db.InsertData("INSERT INTO ASSETSECRET VALUES ?", &sec)
+}
+
+// GetPendingAssetSecret returns the password left by a failed rotation, empty if there is none
+func (c *Core) GetPendingAssetSecret(sysUserID string, assetID string) (string, error) {
+	sec, err := c.getAssetSecret(sysUserID, assetID)
+	if err != nil || sec.PendingPassword == "" {
+		return "", err
+	}
+	return common.DecryptSecret(sec.PendingPassword)
+}
+
+func (c *Core) ClearPendingAssetSecret(sysUserID string, assetID string) error {
+	return c.db.UpdateData("UPDATE ASSETSECRET SET pendingpassword = ? WHERE sysuserid = ? AND assetid = ?",
+		"", sysUserID, assetID)
+}
+
+func (c *Core) getAllAssetSecrets() ([]model.AssetSecret, error) {
+	v, err := c.db.QueryStructs(model.AssetSecretType, "SELECT * FROM ASSETSECRET")
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, ok := v.([]model.AssetSecret)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	return secrets, nil
+}
+
+// GetRotationAssets returns the active assets which the system user is granted on
+func (c *Core) GetRotationAssets(sysUserID string) ([]model.Asset, error) {
+	aus, err := c.GetAllAssetUserInfos()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, 10)
+	for _, au := range aus {
+		if containString(au.SysUserID, sysUserID) && !containString(ids, au.AssetID) {
+			ids = append(ids, au.AssetID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	assets, err := c.getAssets(ids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.Asset, 0, len(assets))
+	for _, a := range assets {
+		if a.IsActive {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+// GetRotateDueSystemUsers returns the system users whose secrets are due to rotate
+func (c *Core) GetRotateDueSystemUsers(now time.Time) ([]model.SystemUser, error) {
+	sys, err := c.GetAllSystemUsers()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]model.SystemUser, 0, len(sys))
+	for _, v := range sys {
+		if v.IsRotateDue(now.Unix()) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (c *Core) InsertRotationLog(l *model.RotationLog) {
+	l.Datetime = time.Now().Format(common.LogFormat)
+	if err := c.db.InsertData("INSERT INTO ROTATIONLOG VALUES ?", l); err != nil {
+		log.Error.Printf("insert rotation log failed, %s", err)
+	}
+}
+
+// FinishRotation records the time of the rotation, so that the next one is scheduled after RotateDays
+func (c *Core) FinishRotation(sys *model.SystemUser, operator string, succeeded int, failed int) error {
+	sys.RotatedAt = time.Now().Unix()
+	if err := c.db.UpdateData("UPDATE SYSTEMUSER SET rotatedat = ? WHERE id = ?", sys.RotatedAt, sys.ID); err != nil {
+		return err
+	}
+	c.InsertLog("rotate", operator, fmt.Sprintf("rotate secret of system user %s(%s), %d succeeded, %d failed",
+		sys.Username, sys.ID, succeeded, failed))
+	return nil
+}
+
+func (c *Core) GetRotationLogs() ([]model.RotationLog, error) {
+	v, err := c.db.QueryStructs(model.RotationLogType, "SELECT * FROM ROTATIONLOG ORDER BY datetime")
+	if err != nil {
+		return nil, err
+	}
+
+	logs, ok := v.([]model.RotationLog)
+	if !ok {
+		return nil, errors.New("invalid value type")
+	}
+	return logs, nil
+}
+
+func (c *Core) QueryRotationLog() ([]string, error) {
+	logs, err := c.GetRotationLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(logs))
+	for _, l := range logs {
+		res = append(res, fmt.Sprintf("%s|%10s|%20s|%10s|%7t|%s", l.Datetime,
+			fmt.Sprintf("%s(%s)", l.SysUsername, l.SysUserID), l.Asset, l.Operator, l.Success, l.Message))
+	}
+	return res, nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// encryptSecrets seals the plaintext secrets in place by the master key
+func encryptSecrets(secrets ...*string) error {
+	for _, s := range secrets {
+		v, err := common.EncryptSecret(*s)
+		if err != nil {
+			return err
+		}
+		*s = v
+	}
+	return nil
+}
+
+// ErrMasterKeyNotConfigured is returned if the master key to re-encrypt is not the one loaded from the config,
+// as the secrets sealed by it could not be opened after restart.
+var ErrMasterKeyNotConfigured = errors.New("master key is not the configured one")
+
+// ReencryptSecrets seals the secrets of system users, users, gateways and rotated assets by the master key k,
+// including the private keys and TOTP secrets of users, the plaintext ones are sealed as well.
+// k must be the current master key, the secrets sealed by the keys in SECRET_OLD_KEY_FILES are moved to it.
+// It returns the number of the sealed secrets.
+func (c *Core) ReencryptSecrets(k *common.MasterKey, admin string) (int, error) {
+	if k == nil {
+		return 0, common.ErrNoMasterKey
+	}
+	if cur := common.GetMasterKey(); cur == nil || cur.ID() != k.ID() {
+		return 0, ErrMasterKeyNotConfigured
+	}
+	n, err := c.resealSecrets(k)
+	if err != nil {
+		return 0, err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("re-encrypt %d secrets by master key %s", n, k.ID()))
+	log.Info.Printf("Re-encrypt %d secrets by master key %s", n, k.ID())
+	return n, nil
+}
+
+func (c *Core) resealSecrets(k *common.MasterKey) (int, error) {
+	n := 0
+	reseal := func(secrets ...*string) error {
+		for _, s := range secrets {
+			if *s == "" {
+				continue
+			}
+			v, err := common.ResealSecret(*s, k)
+			if err != nil {
+				return err
+			}
+			*s = v
+			n++
+		}
+		return nil
+	}
+	// all secrets are sealed before any update, so that nothing changes if one fails to open
+	updates := make([]Statement, 0, 10)
+	sys, err := c.GetAllSystemUsers()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range sys {
+		if err = reseal(&v.Password, &v.PrivateKey); err != nil {
+			return 0, fmt.Errorf("system user %s: %w", v.ID, err)
+		}
+		updates = append(updates, Statement{"UPDATE SYSTEMUSER SET password = ?, privatekey = ? WHERE id = ?",
+			[]interface{}{v.Password, v.PrivateKey, v.ID}})
+	}
+	gateways, err := c.GetAllGateways()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range gateways {
+		if err = reseal(&v.Password, &v.PrivateKey); err != nil {
+			return 0, fmt.Errorf("gateway %s: %w", v.ID, err)
+		}
+		updates = append(updates, Statement{"UPDATE GATEWAY SET password = ?, privatekey = ? WHERE id = ?",
+			[]interface{}{v.Password, v.PrivateKey, v.ID}})
+	}
+	v, err := c.db.QueryStructs(model.UserSecretType, "SELECT * FROM USERSECRET")
+	if err != nil {
+		return 0, err
+	}
+	secrets, ok := v.([]model.UserSecret)
+	if !ok {
+		return 0, errors.New("invalid value type")
+	}
+	for _, v := range secrets {
+		if v.PrivateKey == "" && v.TOTPSecret == "" {
+			continue
+		}
+		if err = reseal(&v.PrivateKey, &v.TOTPSecret); err != nil {
+			return 0, fmt.Errorf("secret of user %s: %w", v.UserID, err)
+		}
+		updates = append(updates, Statement{"UPDATE USERSECRET SET privatekey = ?, totpsecret = ? WHERE userid = ?",
+			[]interface{}{v.PrivateKey, v.TOTPSecret, v.UserID}})
+	}
+	assetSecrets, err := c.getAllAssetSecrets()
+	if err != nil {
+		return 0, err
+	}
+	for _, v := range assetSecrets {
+		if err = reseal(&v.Password, &v.PrivateKey, &v.PendingPassword); err != nil {
+			return 0, fmt.Errorf("secret of system user %s on asset %s: %w", v.SysUserID, v.AssetID, err)
+		}
+		updates = append(updates, Statement{"UPDATE ASSETSECRET SET password = ?, privatekey = ?, pendingpassword = ? WHERE sysuserid = ? AND assetid = ?",
+			[]interface{}{v.Password, v.PrivateKey, v.PendingPassword, v.SysUserID, v.AssetID}})
+	}
+	// in one transaction, so the old key still opens every secret if the update fails
+	if err = c.db.UpdateDataInTx(updates); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/handewo/gojump/pkg/common"
@@ -74,3 +75,24 @@ func (c *Core) SessionDisconnect(id string) error {
 	c.sessLock.Unlock()
 	return err
 }
+
+// RemoveSession removes the live session without logging, for the sessions which log their own end
+func (c *Core) RemoveSession(id string) {
+	c.sessLock.Lock()
+	defer c.sessLock.Unlock()
+	delete(c.session, id)
+}
+
+// GetSessions returns the live sessions ordered by start time.
+func (c *Core) GetSessions() []model.Session {
+	c.sessLock.RLock()
+	sessions := make([]model.Session, 0, len(c.session))
+	for _, s := range c.session {
+		sessions = append(sessions, s)
+	}
+	c.sessLock.RUnlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].DateStart.Before(sessions[j].DateStart)
+	})
+	return sessions
+}
@@ -3,8 +3,12 @@ package core
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func (c *Core) GetSystemUsersByUserIdAndAssetId(userID string, assetID string) (sysUsers []model.SystemUser, err error) {
@@ -30,7 +34,7 @@ func (c *Core) getSystemUsers(ids []string) ([]model.SystemUser, error) {
 	return sys, err
 }
 
-func (c *Core) QueryAllSystemUser() ([]string, error) {
+func (c *Core) GetAllSystemUsers() ([]model.SystemUser, error) {
 	v, err := c.db.QueryStructs(model.SystemUserType, "SELECT * FROM SYSTEMUSER")
 	if err != nil {
 		return nil, err
@@ -40,6 +44,14 @@ func (c *Core) QueryAllSystemUser() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return sys, nil
+}
+
+func (c *Core) QueryAllSystemUser() ([]string, error) {
+	sys, err := c.GetAllSystemUsers()
+	if err != nil {
+		return nil, err
+	}
 
 	res := make([]string, 0, 10)
 	for _, v := range sys {
@@ -51,9 +63,136 @@ func (c *Core) QueryAllSystemUser() ([]string, error) {
 		if v.PrivateKey != "" {
 			key = "********"
 		}
-		s := fmt.Sprintf("%4s|%10s|%8d|%8s|%8s|%11s|%s", v.ID, v.Username,
-			v.Priority, v.Protocol, pass, key, v.Comment)
+		rotated := ""
+		if v.RotatedAt > 0 {
+			rotated = time.Unix(v.RotatedAt, 0).Format(common.LogFormat)
+		}
+		s := fmt.Sprintf("%4s|%10s|%8d|%8s|%8s|%11s|%6d|%19s|%s", v.ID, v.Username,
+			v.Priority, v.Protocol, pass, key, v.RotateDays, rotated, v.Comment)
 		res = append(res, s)
 	}
 	return res, nil
 }
+
+func (c *Core) GetSystemUserById(id string) (model.SystemUser, error) {
+	sys := model.SystemUser{}
+	err := c.db.QueryStruct(&sys, "SELECT * FROM SYSTEMUSER WHERE id = ?", id)
+	if err != nil {
+		return sys, err
+	}
+	if sys.ID == "" {
+		return sys, fmt.Errorf("system user %s %w", id, ErrNotFound)
+	}
+	return sys, nil
+}
+
+func validateSystemUser(sys *model.SystemUser) error {
+	if sys.Username == "" {
+		return errors.New("username is required")
+	}
+	if sys.Protocol == "" {
+		sys.Protocol = model.ProtocolSSH
+	}
+	if !sys.IsProtocol(model.ProtocolSSH) {
+		return fmt.Errorf("unsupported protocol %s", sys.Protocol)
+	}
+	if sys.Password == "" && sys.PrivateKey == "" {
+		return errors.New("password or private key is required")
+	}
+	if sys.PrivateKey != "" && !common.IsEncryptedSecret(sys.PrivateKey) {
+		if _, err := gossh.ParsePrivateKey([]byte(sys.PrivateKey)); err != nil {
+			return fmt.Errorf("invalid private key: %s", err)
+		}
+	}
+	if sys.Shell != "" && !strings.HasPrefix(sys.Shell, "/") {
+		return fmt.Errorf("shell %s is not an absolute path", sys.Shell)
+	}
+	if strings.ContainsAny(sys.Shell+sys.Sudo, "\r\n") {
+		return errors.New("shell and sudo must be in one line")
+	}
+	if sys.RotateDays < 0 {
+		return fmt.Errorf("invalid rotate days %d", sys.RotateDays)
+	}
+	return nil
+}
+
+func (c *Core) AddSystemUser(sys *model.SystemUser, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	sys.ID, err = c.nextID("SYSTEMUSER")
+	if err != nil {
+		return err
+	}
+	if err = validateSystemUser(sys); err != nil {
+		return err
+	}
+	if err = encryptSecrets(&sys.Password, &sys.PrivateKey); err != nil {
+		return err
+	}
+	// the scheduled rotation starts from now
+	sys.RotatedAt = time.Now().Unix()
+	if err = c.db.InsertData("INSERT INTO SYSTEMUSER VALUES ?", sys); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add system user %s(%s)", sys.Username, sys.ID))
+	return nil
+}
+
+func (c *Core) UpdateSystemUser(sys *model.SystemUser, admin string) error {
+	if err := validateSystemUser(sys); err != nil {
+		return err
+	}
+	old, err := c.GetSystemUserById(sys.ID)
+	if err != nil {
+		return err
+	}
+	if err = encryptSecrets(&sys.Password, &sys.PrivateKey); err != nil {
+		return err
+	}
+	err = c.db.UpdateData("UPDATE SYSTEMUSER SET username = ?, priority = ?, protocol = ?, comment = ?, password = ?, privatekey = ?, shell = ?, sudo = ?, rotatedays = ? WHERE id = ?",
+		sys.Username, sys.Priority, sys.Protocol, sys.Comment, sys.Password, sys.PrivateKey, sys.Shell, sys.Sudo,
+		sys.RotateDays, sys.ID)
+	if err != nil {
+		return err
+	}
+	// the secrets set by the admin replace the rotated ones on all assets
+	if old.Password != sys.Password || old.PrivateKey != sys.PrivateKey {
+		if err = c.db.DeleteData("DELETE FROM ASSETSECRET WHERE sysuserid = ?", sys.ID); err != nil {
+			return err
+		}
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit system user %s(%s)", sys.Username, sys.ID))
+	return nil
+}
+
+// DeleteSystemUser removes the system user, and refuses if it is the only system user of any grant.
+func (c *Core) DeleteSystemUser(id string, admin string) error {
+	sys, err := c.GetSystemUserById(id)
+	if err != nil {
+		return err
+	}
+	aus, err := c.GetAllAssetUserInfos()
+	if err != nil {
+		return err
+	}
+	for _, au := range aus {
+		if containString(au.SysUserID, id) && len(au.SysUserID) == 1 {
+			return fmt.Errorf("system user %s is the only system user of grant %s", id, au.ID)
+		}
+	}
+	d := &deletion{}
+	for _, au := range aus {
+		if !containString(au.SysUserID, id) {
+			continue
+		}
+		d.add("UPDATE ASSETUSERINFO SET sysuserid = ? WHERE id = ?", removeString(au.SysUserID, id), au.ID)
+	}
+	if err = c.detachCommandFilters(d, "sysuserids", id); err != nil {
+		return err
+	}
+	d.add("DELETE FROM ASSETSECRET WHERE sysuserid = ?", id)
+	d.add("DELETE FROM SYSTEMUSER WHERE id = ?", id)
+	d.log(fmt.Sprintf("delete system user %s(%s)", sys.Username, id))
+	return c.commitDeletion(d, admin)
+}
@@ -3,12 +3,14 @@ package core
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
 	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func (c *Core) UserAuthenticate(username string, pass string, pubKey string) (model.User, bool) {
@@ -23,7 +25,7 @@ func (c *Core) UserAuthenticate(username string, pass string, pubKey string) (mo
 	}
 
 	switch user.OTPLevel {
-	case 1:
+	case model.OTPLevelOnce:
 		return user, c.verifyOTP(user.Username, pass)
 	}
 	var sec model.UserSecret
@@ -54,7 +56,7 @@ func (c *Core) GetUser(name string) (model.User, error) {
 	return user, nil
 }
 
-func (c *Core) QueryAllUser() ([]string, error) {
+func (c *Core) GetAllUsers() ([]model.User, error) {
 	v, err := c.db.QueryStructs(model.UserType, "SELECT * FROM USER")
 	if err != nil {
 		return nil, err
@@ -64,6 +66,14 @@ func (c *Core) QueryAllUser() ([]string, error) {
 	if !ok {
 		return nil, errors.New("invalid value type")
 	}
+	return users, nil
+}
+
+func (c *Core) QueryAllUser() ([]string, error) {
+	users, err := c.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
 
 	res := make([]string, 0, 10)
 	for _, v := range users {
@@ -74,8 +84,8 @@ func (c *Core) QueryAllUser() ([]string, error) {
 		}
 		n := strings.Join(v.NodeIDs, ",")
 		l := strings.Join(v.AddrWhiteList, ",")
-		s := fmt.Sprintf("%4s|%10s|%6s|%s|%9d|%6v|%16s|%s", v.ID,
-			v.Username, v.Role, ea, v.OTPLevel, v.IsActive, n, l)
+		s := fmt.Sprintf("%4s|%10s|%11s|%s|%9d|%6v|%11s|%16s|%s", v.ID,
+			v.Username, v.Role, ea, v.OTPLevel, v.IsActive, replayDaysString(v.ReplayKeepDays), n, l)
 		res = append(res, s)
 	}
 	return res, nil
@@ -97,6 +107,7 @@ func (c *Core) QueryAllUserSecret() ([]string, error) {
 		pass := ""
 		key := ""
 		auth := ""
+		totp := ""
 		if v.Password != "" {
 			pass = "********"
 		}
@@ -110,9 +121,234 @@ func (c *Core) QueryAllUserSecret() ([]string, error) {
 			}
 			auth = strings.Join(ks, ",")
 		}
-		s := fmt.Sprintf("%4s|%8s|%11s|%s", v.UserID,
-			pass, key, auth)
+		if v.TOTPSecret != "" {
+			totp = "********"
+		}
+		s := fmt.Sprintf("%4s|%8s|%11s|%11s|%s", v.UserID,
+			pass, key, totp, auth)
 		res = append(res, s)
 	}
 	return res, nil
 }
+
+func (c *Core) GetUserById(id string) (model.User, error) {
+	var user model.User
+	err := c.db.QueryStruct(&user, "SELECT * FROM USER WHERE id = ?", id)
+	if err != nil {
+		return user, err
+	}
+	if user.ID == "" {
+		return user, fmt.Errorf("user %s %w", id, ErrNotFound)
+	}
+	return user, nil
+}
+
+func (c *Core) validateUser(user *model.User) error {
+	if err := validateName("username", user.Username); err != nil {
+		return err
+	}
+	if !model.ValidRole(user.Role) {
+		return fmt.Errorf("invalid role %s", user.Role)
+	}
+	if user.OTPLevel < model.OTPLevelNone || user.OTPLevel > model.OTPLevelTOTP {
+		return fmt.Errorf("invalid otp level %d", user.OTPLevel)
+	}
+	if user.ReplayKeepDays < -1 {
+		return fmt.Errorf("invalid replay days %d", user.ReplayKeepDays)
+	}
+	for _, addr := range user.AddrWhiteList {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("invalid address %s", addr)
+		}
+	}
+	if len(user.NodeIDs) > 0 {
+		nodes, err := c.getNodes(user.NodeIDs)
+		if err != nil {
+			return err
+		}
+		found := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			found = append(found, n.ID)
+		}
+		if id := missingID(user.NodeIDs, found); id != "" {
+			return fmt.Errorf("node %s not found", id)
+		}
+	}
+	ids, err := c.db.QueryOneFieldMutilRows("SELECT id FROM USER WHERE username = ? AND id != ?",
+		user.Username, user.ID)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		return fmt.Errorf("user %s already exists", user.Username)
+	}
+	return nil
+}
+
+// CheckUserAdmin returns an error if the admin can not manage the user,
+// only the super admin can manage the users of the admin roles.
+func (c *Core) CheckUserAdmin(admin string, user *model.User) error {
+	op, err := c.GetUser(admin)
+	if err != nil {
+		return err
+	}
+	if op.Role == model.RoleAdmin || user.Role == model.RoleUser {
+		return nil
+	}
+	return fmt.Errorf("only the super admin can manage the user %s of the role %s", user.Username, user.Role)
+}
+
+func (c *Core) checkUserAdminById(admin string, userID string) error {
+	user, err := c.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	return c.CheckUserAdmin(admin, &user)
+}
+
+func validateAuthorizedKeys(keys []string) error {
+	for _, k := range keys {
+		if _, _, _, _, err := gossh.ParseAuthorizedKey([]byte(k)); err != nil {
+			return fmt.Errorf("invalid authorized key %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func (c *Core) AddUser(user *model.User, password string, authorizedKeys []string, admin string) error {
+	c.idLock.Lock()
+	defer c.idLock.Unlock()
+	var err error
+	user.ID, err = c.nextID("USER")
+	if err != nil {
+		return err
+	}
+	if err = c.validateUser(user); err != nil {
+		return err
+	}
+	if err = c.CheckUserAdmin(admin, user); err != nil {
+		return err
+	}
+	if password == "" && len(authorizedKeys) == 0 {
+		return errors.New("password or authorized key is required")
+	}
+	if err = validateAuthorizedKeys(authorizedKeys); err != nil {
+		return err
+	}
+	sec := model.UserSecret{
+		UserID:         user.ID,
+		AuthorizedKeys: authorizedKeys,
+	}
+	if password != "" {
+		if sec.Password, err = common.HashPassword(password); err != nil {
+			return err
+		}
+	}
+	if err = c.db.InsertData("INSERT INTO USER VALUES ?", user); err != nil {
+		return err
+	}
+	if err = c.db.InsertData("INSERT INTO USERSECRET VALUES ?", &sec); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("add user %s(%s)", user.Username, user.ID))
+	return nil
+}
+
+func (c *Core) UpdateUser(user *model.User, admin string) error {
+	if err := c.validateUser(user); err != nil {
+		return err
+	}
+	if err := c.checkUserAdminById(admin, user.ID); err != nil {
+		return err
+	}
+	if err := c.CheckUserAdmin(admin, user); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE USER SET username = ?, role = ?, expireat = ?, otplevel = ?, isactive = ?, nodeids = ?, addrwhitelist = ?, replaykeepdays = ? WHERE id = ?",
+		user.Username, user.Role, user.ExpireAt, user.OTPLevel, user.IsActive, user.NodeIDs, user.AddrWhiteList, user.ReplayKeepDays, user.ID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("edit user %s(%s)", user.Username, user.ID))
+	return nil
+}
+
+func (c *Core) SetUserPassword(userID string, password string, admin string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if err := c.checkUserAdminById(admin, userID); err != nil {
+		return err
+	}
+	hash, err := common.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err = c.db.UpdateData("UPDATE USERSECRET SET password = ? WHERE userid = ?", hash, userID); err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("set password of user %s", userID))
+	return nil
+}
+
+func (c *Core) SetUserAuthorizedKeys(userID string, authorizedKeys []string, admin string) error {
+	if err := validateAuthorizedKeys(authorizedKeys); err != nil {
+		return err
+	}
+	if err := c.checkUserAdminById(admin, userID); err != nil {
+		return err
+	}
+	err := c.db.UpdateData("UPDATE USERSECRET SET authorizedkeys = ? WHERE userid = ?", authorizedKeys, userID)
+	if err != nil {
+		return err
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("set authorized keys of user %s", userID))
+	return nil
+}
+
+func (c *Core) SetUserActive(userID string, active bool, admin string) error {
+	user, err := c.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	if !active && user.Username == admin {
+		return errors.New("can not disable yourself")
+	}
+	if err = c.CheckUserAdmin(admin, &user); err != nil {
+		return err
+	}
+	if err = c.db.UpdateData("UPDATE USER SET isactive = ? WHERE id = ?", active, userID); err != nil {
+		return err
+	}
+	action := "disable"
+	if active {
+		action = "enable"
+	}
+	c.InsertLog("admin", admin, fmt.Sprintf("%s user %s(%s)", action, user.Username, userID))
+	return nil
+}
+
+func (c *Core) DeleteUser(userID string, admin string) error {
+	user, err := c.GetUserById(userID)
+	if err != nil {
+		return err
+	}
+	if user.Username == admin {
+		return errors.New("can not delete yourself")
+	}
+	if err = c.CheckUserAdmin(admin, &user); err != nil {
+		return err
+	}
+	d := &deletion{}
+	d.add("DELETE FROM ASSETUSERINFO WHERE userid = ?", userID)
+	d.add("DELETE FROM USERSECRET WHERE userid = ?", userID)
+	if err = c.detachCommandFilters(d, "userids", userID); err != nil {
+		return err
+	}
+	if err = c.detachReviewFlows(d, "steps", userID); err != nil {
+		return err
+	}
+	d.add("DELETE FROM USER WHERE id = ?", userID)
+	d.log(fmt.Sprintf("delete user %s(%s)", user.Username, userID))
+	return c.commitDeletion(d, admin)
+}
@@ -1,13 +1,30 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/handewo/gojump/pkg/model"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// the names of users and assets are a part of the paths of the replays
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+func validateName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("%s is required", kind)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%s can only contain letters, digits, '.', '_' and '-', and can not start with '.'", kind)
+	}
+	return nil
+}
+
 func doPublicKeyMatch(authKeys []string, currPubkey string) bool {
 	for _, v := range authKeys {
 		keyInfo := strings.Split(v, " ")
@@ -44,6 +61,18 @@ func (c *Core) QueryAssetUserVscodePerm(userID string, assetID string) (bool, er
 	return enable, nil
 }
 
+// QueryAssetUserSFTPPerm returns whether the user can transfer files with the asset,
+// the grants created before the flag existed have no such field.
+func (c *Core) QueryAssetUserSFTPPerm(userID string, assetID string) (bool, error) {
+	au := model.AssetUserInfo{}
+	err := c.db.QueryStruct(&au,
+		"SELECT * FROM ASSETUSERINFO where userid = ? and assetid = ?", userID, assetID)
+	if err != nil {
+		return false, err
+	}
+	return au.EnableSFTP, nil
+}
+
 func (c *Core) GetTerminalConfig() (model.TerminalConfig, error) {
 	t := model.TerminalConfig{}
 	err := c.db.QueryStruct(&t, "SELECT * FROM TERMINALCONF")
@@ -90,3 +119,86 @@ func (c *Core) QueryDirectLoginInfo(userID string, directLogin map[string]string
 	}
 	return
 }
+
+// GetGrantedAssetByAddr returns the active asset granted to the user, whose name, hostname or ip is
+// the host, and whose ssh port is the port.
+func (c *Core) GetGrantedAssetByAddr(userID string, host string, port int) (model.Asset, error) {
+	assetIDs, err := c.db.QueryOneFieldMutilRows("SELECT assetid FROM ASSETUSERINFO WHERE userid = ?", userID)
+	if err != nil {
+		return model.Asset{}, err
+	}
+	assets, err := c.getAssets(assetIDs)
+	if err != nil {
+		return model.Asset{}, err
+	}
+	for _, a := range assets {
+		if !a.IsActive || a.ProtocolPort(model.ProtocolSSH) != port {
+			continue
+		}
+		if strings.EqualFold(a.Name, host) || strings.EqualFold(a.Hostname, host) || a.IP == host {
+			return a, nil
+		}
+	}
+	return model.Asset{}, fmt.Errorf("asset %s %w", net.JoinHostPort(host, strconv.Itoa(port)), ErrNotFound)
+}
+
+var ErrNotFound = errors.New("not found")
+
+// nextID returns the next numeric id of the table
+// nextID returns the next id of the table, c.idLock must be held until the row is inserted,
+// otherwise the concurrent requests of the admin shell and the api may get the same id.
+func (c *Core) nextID(table string) (string, error) {
+	ids, err := c.db.QueryOneFieldMutilRows(fmt.Sprintf("SELECT id FROM %s", table))
+	if err != nil {
+		return "", err
+	}
+	max := 0
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil && n > max {
+			max = n
+		}
+	}
+	return strconv.Itoa(max + 1), nil
+}
+
+// lessID orders the ids allocated by nextID by their numbers, the ones which are not numbers last
+func lessID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return x < y
+	case errA == nil || errB == nil:
+		return errA == nil
+	}
+	return a < b
+}
+
+func containString(items []string, s string) bool {
+	for _, v := range items {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(items []string, s string) []string {
+	res := make([]string, 0, len(items))
+	for _, v := range items {
+		if v != s {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// missingID returns the first id of want which is not in got
+func missingID(want []string, got []string) string {
+	for _, id := range want {
+		if !containString(got, id) {
+			return id
+		}
+	}
+	return ""
+}
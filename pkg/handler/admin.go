@@ -3,24 +3,40 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/core"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/ops"
+	"github.com/handewo/gojump/pkg/proxy"
 )
 
 func (h *InteractiveHandler) AdminSystem() {
 	defer log.Info.Printf("Request %s: Admin %s stop interactive", h.sess.ID()[:8], h.user.Username)
 	checkChan := make(chan bool)
 	go h.checkMaxIdleTime(checkChan)
-	displayAdminHelp(h.sess)
+	h.adminShell(checkChan)
+}
+
+// adminShell runs the commands allowed for the role until q, which goes back to the asset menu
+// for the roles but admin.
+func (h *InteractiveHandler) adminShell(checkChan chan<- bool) {
+	h.term.SetPrompt("Opt> ")
+	notifier := newTicketNotifier(h)
+	defer notifier.Close()
+	displayAdminHelp(h.sess, h.user.Role)
 	for {
 		checkChan <- true
+		notifier.setIdle(true)
 		line, err := h.term.ReadLine()
+		notifier.setIdle(false)
 		if err != nil {
 			log.Debug.Printf("User %s close connect %s", h.user.Username, err)
 			break
@@ -30,34 +46,112 @@ func (h *InteractiveHandler) AdminSystem() {
 		if len(line) == 0 {
 			continue
 		}
-		switch line[0] {
-		case 'h':
-			displayAdminHelp(h.sess)
+		switch line {
+		case "h":
+			displayAdminHelp(h.sess, h.user.Role)
 			continue
-		case 'q':
+		case "q":
 			return
 		}
 		words := strings.Split(line, " ")
+		if perm := adminCommandPermission(words); perm != "" && !model.HasPermission(h.user.Role, perm) {
+			log.Warning.Printf("Admin %s(%s) is denied to %s, %s is required", h.user.Username, h.user.Role, words[0], perm)
+			msg := common.WrapperString(fmt.Sprintf("Error: permission denied, %s is required", perm), common.Red)
+			common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+			continue
+		}
 		switch words[0] {
 		case "list":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
 			h.listTable(words[1])
 			continue
 		case "ticket":
 			h.listTable("PENDINGTICKET")
 			continue
 		case "approve":
-			h.updateTicketState(words[1], model.TicketApproved)
+			h.reviewTicket(words[1:], true)
 			continue
 		case "reject":
-			h.updateTicketState(words[1], model.TicketRejected)
+			h.reviewTicket(words[1:], false)
+			continue
+		case "add", "edit", "enable", "disable", "delete":
+			h.manageEntity(line)
+			continue
+		case "hostkey":
+			h.manageHostKey(words[1:])
+			continue
+		case "monitor", "join":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.shareSession(words[1], words[0] == "join")
+			continue
+		case "token":
+			h.manageAPIToken(words[1:])
+			continue
+		case "commands":
+			h.queryCommands(words[1:])
+			continue
+		case "sessions":
+			h.listTable("SESSION")
+			continue
+		case "replays":
+			h.queryReplays(words[1:])
+			continue
+		case "play":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.playReplay(words[1])
+			continue
+		case "kill":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.killSession(words[1])
 			continue
 		case "otp":
-			pass := h.core.GenOTPassword(words[1])
-			msg := pass + common.CharNewLine
-			h.term.Write([]byte(msg))
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.genOTPassword(words[1])
+			continue
+		case "totp":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.resetTOTP(words[1])
+			continue
+		case "reencrypt":
+			h.reencryptSecrets(words[1:])
+			continue
+		case "rotate":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.rotateSystemUser(words[1])
+			continue
+		case "push":
+			h.pushSystemUser(words[1:])
+			continue
+		case "check":
+			if len(words) < 2 {
+				displayAdminHelp(h.sess, h.user.Role)
+				continue
+			}
+			h.checkAsset(words[1])
 			continue
 		case "help":
-			displayAdminHelp(h.sess)
+			displayAdminHelp(h.sess, h.user.Role)
 			continue
 		case "exit", "quit":
 			return
@@ -65,14 +159,377 @@ func (h *InteractiveHandler) AdminSystem() {
 	}
 }
 
-func (h *InteractiveHandler) updateTicketState(id string, state string) {
-	err := h.core.UpdateTicketState(id, state, h.user.Username)
+// adminCommandPermission returns the permission required by the command, or empty if none is required
+func adminCommandPermission(words []string) string {
+	arg := ""
+	if len(words) > 1 {
+		arg = strings.ToUpper(words[1])
+	}
+	switch words[0] {
+	case "list":
+		switch arg {
+		case "":
+			return ""
+		case "USERLOG", "CMDLOG":
+			return model.PermAudit
+		case "SESSION":
+			return model.PermSession
+		case "TICKET", "PENDINGTICKET", "REVIEWFLOW":
+			return model.PermReadTicket
+		case "USER", "SECRET":
+			return model.PermReadUser
+		case "TOKEN", "CONFIG":
+			return model.PermSystem
+		}
+		return model.PermReadAsset
+	case "ticket":
+		return model.PermReadTicket
+	case "approve", "reject":
+		return model.PermReviewTicket
+	case "add", "edit", "enable", "disable", "delete":
+		switch arg {
+		case "":
+			return ""
+		case "USER":
+			return model.PermWriteUser
+		case "REVIEWFLOW":
+			return model.PermSystem
+		}
+		return model.PermWriteAsset
+	case "hostkey":
+		if arg == "" || arg == "LIST" {
+			return model.PermReadAsset
+		}
+		return model.PermWriteAsset
+	case "commands", "replays", "play":
+		return model.PermAudit
+	case "monitor", "join", "kill", "sessions":
+		return model.PermSession
+	case "otp", "totp":
+		return model.PermWriteUser
+	case "token", "reencrypt":
+		return model.PermSystem
+	case "rotate", "push", "check":
+		return model.PermWriteAsset
+	}
+	return ""
+}
+
+func (h *InteractiveHandler) genOTPassword(username string) {
+	user, err := h.core.GetUser(username)
+	if err == nil {
+		err = h.core.CheckUserAdmin(h.user.Username, &user)
+	}
+	if err != nil {
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	pass := h.core.GenOTPassword(username)
+	h.term.Write([]byte(pass + common.CharNewLine))
+}
+
+// reviewTicket reviews the ticket of args[0], the approved login ticket is reused within the window of args[1]
+func (h *InteractiveHandler) reviewTicket(args []string, approve bool) {
+	if len(args) == 0 || len(args) > 2 {
+		displayAdminHelp(h.sess, h.user.Role)
+		return
+	}
+	id := args[0]
+	var window time.Duration
+	var err error
+	if len(args) == 2 {
+		if window, err = time.ParseDuration(args[1]); err != nil {
+			msg := common.WrapperString(fmt.Sprintf("Error: invalid time window %s", args[1]), common.Red)
+			common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+			return
+		}
+	}
+	t, err := h.core.ReviewTicket(id, approve, h.user.Username, window)
+	if err != nil {
+		log.Error.Printf("review ticket %s falied, %s", id, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	msg := common.WrapperString("Submit", common.Green)
+	if t.State == model.TicketOpen {
+		msg += ", " + core.TicketProgress(&t)
+	}
+	if t.ValidUntil > 0 {
+		msg += fmt.Sprintf(", valid until %s", time.Unix(t.ValidUntil, 0).Format(common.LogFormat))
+	}
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) resetTOTP(username string) {
+	err := h.core.ResetTOTP(username, h.user.Username)
 	if err != nil {
-		log.Error.Printf("update ticket's state falied, %s", err)
+		log.Error.Printf("reset totp of %s failed, %s", username, err)
 		msg := common.WrapperString("Error", common.Red)
 		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
 		return
 	}
+	msg := fmt.Sprintf("%s will enroll a TOTP authenticator at the next login", username)
+	common.IgnoreErrWriteString(h.sess, common.WrapperString(msg, common.Green)+common.CharNewLine)
+}
+
+// reencryptSecrets encrypts the secrets by the current master key, which encrypts the plaintext secrets
+// and the ones of the former keys. The key read from the file, or entered without echo if the file is -,
+// must be the current one, or else the config to change is written.
+func (h *InteractiveHandler) reencryptSecrets(args []string) {
+	k, err := h.readMasterKey(args)
+	if err == nil {
+		var n int
+		n, err = h.core.ReencryptSecrets(k, h.user.Username)
+		if err == nil {
+			msg := fmt.Sprintf("%d secrets are encrypted by master key %s, the keys in SECRET_OLD_KEY_FILES can be removed",
+				n, k.ID())
+			common.IgnoreErrWriteString(h.sess, common.WrapperString(msg, common.Green)+common.CharNewLine)
+			return
+		}
+		if errors.Is(err, core.ErrMasterKeyNotConfigured) {
+			h.writeMasterKeyConfig(k, args[0])
+			return
+		}
+	}
+	log.Error.Printf("Admin %s re-encrypt secrets failed, %s", h.user.Username, err)
+	msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+// rotateSystemUser rotates the secret of the system user on its assets, the result of each asset
+// is in the list of ROTATION.
+func (h *InteractiveHandler) rotateSystemUser(id string) {
+	common.IgnoreErrWriteString(h.sess, "Rotating..."+common.CharNewLine)
+	succeeded, failed, err := ops.RotateSystemUser(h.core, id, h.user.Username)
+	if err != nil {
+		log.Error.Printf("Admin %s rotate secret of system user %s failed, %s", h.user.Username, id, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	msg := fmt.Sprintf("%d assets succeeded, %d assets failed", succeeded, failed)
+	color := common.Green
+	if failed > 0 {
+		color = common.Red
+	}
+	common.IgnoreErrWriteString(h.sess, common.WrapperString(msg, color)+common.CharNewLine)
+}
+
+// pushSystemUser creates the account of the system user on the asset or the assets of the node,
+// and writes the result of each asset.
+func (h *InteractiveHandler) pushSystemUser(args []string) {
+	const usage = "Usage: push SYSUSER_ID admin=SYSUSER_ID asset=ASSET_ID|node=NODE_ID"
+	if len(args) == 0 {
+		common.IgnoreErrWriteString(h.sess, common.WrapperString(usage, common.Red)+common.CharNewLine)
+		return
+	}
+	var adminID, assetID, nodeID string
+	var err error
+	for _, arg := range args[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("invalid argument %s, the format is key=value", arg)
+			break
+		}
+		switch strings.ToLower(kv[0]) {
+		case "admin":
+			adminID = kv[1]
+		case "asset":
+			assetID = kv[1]
+		case "node":
+			nodeID = kv[1]
+		default:
+			err = fmt.Errorf("unknown key %s", kv[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil && (adminID == "" || (assetID == "") == (nodeID == "")) {
+		err = errors.New(usage)
+	}
+	var assets []model.Asset
+	if err == nil {
+		if nodeID != "" {
+			assets, err = h.core.GetNodeAssets(nodeID)
+		} else {
+			var asset model.Asset
+			if asset, err = h.core.GetAssetById(assetID); err == nil && asset.ID == "" {
+				err = fmt.Errorf("asset %s not found", assetID)
+			}
+			assets = []model.Asset{asset}
+		}
+	}
+	var res []ops.PushResult
+	if err == nil {
+		common.IgnoreErrWriteString(h.sess, fmt.Sprintf("Pushing to %d assets...", len(assets))+common.CharNewLine)
+		res, err = ops.PushSystemUser(h.core, args[0], adminID, assets, h.user.Username)
+	}
+	if err != nil {
+		log.Error.Printf("Admin %s push system user %s failed, %s", h.user.Username, args[0], err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	rows := make([]string, 0, len(res))
+	for _, r := range res {
+		result := common.WrapperString("ok", common.Green)
+		if r.Err != nil {
+			result = common.WrapperString(r.Err.Error(), common.Red)
+		}
+		rows = append(rows, fmt.Sprintf("%22s|%s", r.Asset.String(), result))
+	}
+	h.writeRows("                 Asset      |Result", rows)
+}
+
+// checkAsset checks the asset by ID or name, and writes the result
+func (h *InteractiveHandler) checkAsset(name string) {
+	asset, err := h.core.GetAssetById(name)
+	if err == nil && asset.ID == "" {
+		asset, err = h.core.GetAssetByName(name)
+	}
+	if err == nil && asset.ID == "" {
+		err = fmt.Errorf("asset %s not found", name)
+	}
+	if err != nil {
+		log.Error.Printf("Admin %s check asset %s failed, %s", h.user.Username, name, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	res := ops.CheckAsset(h.core, &asset)
+	row := fmt.Sprintf("%22s|%11s|%7dms|%19s|%s", asset.String(), res.Status(), res.Latency, res.CheckDate, res.Message)
+	h.writeRows("                 Asset      |   Status  | Latency |     Check Date    |Message", []string{row})
+}
+
+// writeMasterKeyConfig writes the config to load the new master key k, the current key is kept in
+// SECRET_OLD_KEY_FILES to open the secrets until they are encrypted by k.
+func (h *InteractiveHandler) writeMasterKeyConfig(k *common.MasterKey, file string) {
+	if file == "-" {
+		file = "NEW_KEY_FILE"
+	}
+	lines := []string{
+		fmt.Sprintf("Master key %s is not the configured one, the secrets encrypted by it could not be decrypted after restart.", k.ID()),
+		"Change the config as follows, restart, and run reencrypt:",
+		fmt.Sprintf("  SECRET_KEY_FILE: %q", file),
+	}
+	conf := config.GetConf()
+	old := conf.SecretOldKeyFiles
+	if conf.SecretKeyFile != "" {
+		old = append([]string{conf.SecretKeyFile}, old...)
+	} else if conf.SecretKeyEnv != "" {
+		lines = append(lines, fmt.Sprintf("  # save the key in %s to a file, and add it to SECRET_OLD_KEY_FILES", conf.SecretKeyEnv))
+	}
+	if len(old) > 0 {
+		lines = append(lines, "  SECRET_OLD_KEY_FILES:")
+		for _, f := range old {
+			lines = append(lines, fmt.Sprintf("    - %q", f))
+		}
+	}
+	if file == "NEW_KEY_FILE" {
+		lines = append(lines, "NEW_KEY_FILE is the file the entered key is saved to.")
+	}
+	common.IgnoreErrWriteString(h.sess, common.WrapperString(strings.Join(lines, common.CharNewLine), common.Red)+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) readMasterKey(args []string) (*common.MasterKey, error) {
+	if len(args) == 0 {
+		return common.GetMasterKey(), nil
+	}
+	if args[0] != "-" {
+		return common.LoadMasterKey(args[0], "")
+	}
+	key, err := h.term.ReadPassword("Master key: ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := h.term.ReadPassword("Confirm master key: ")
+	if err != nil {
+		return nil, err
+	}
+	if key != confirm {
+		return nil, errors.New("master keys do not match")
+	}
+	return common.NewMasterKey([]byte(key))
+}
+
+func (h *InteractiveHandler) manageHostKey(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		h.listTable("HOSTKEY")
+		return
+	}
+	if len(args) < 2 {
+		msg := common.WrapperString("Usage: hostkey [list|accept ASSET_ID|revoke ASSET_ID]", common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	var err error
+	switch args[0] {
+	case "accept":
+		err = h.core.AcceptAssetHostKey(args[1], h.user.Username)
+	case "revoke":
+		err = h.core.RevokeAssetHostKey(args[1], h.user.Username)
+	default:
+		err = fmt.Errorf("unknown action %s", args[0])
+	}
+	if err != nil {
+		log.Error.Printf("%s host key of asset %s failed, %s", args[0], args[1], err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	msg := common.WrapperString("Submit", common.Green)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) killSession(sessionID string) {
+	if err := proxy.KillSession(h.core, sessionID, h.user.Username); err != nil {
+		log.Error.Printf("kill session %s failed, %s", sessionID, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	msg := common.WrapperString("Submit", common.Green)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) manageAPIToken(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		h.listTable("TOKEN")
+		return
+	}
+	var err error
+	switch {
+	case args[0] == "add" && (len(args) == 3 || len(args) == 4):
+		var expireAt int64
+		if len(args) == 4 {
+			if expireAt, err = parseExpire(args[3]); err != nil {
+				break
+			}
+		}
+		var token string
+		token, err = h.core.CreateAPIToken(args[1], args[2], expireAt, h.user.Username)
+		if err != nil {
+			break
+		}
+		msg := fmt.Sprintf("Token: %s%sIt will not be shown again.", token, common.CharNewLine)
+		common.IgnoreErrWriteString(h.sess, common.WrapperString(msg, common.Green)+common.CharNewLine)
+		return
+	case args[0] == "revoke" && len(args) == 2:
+		err = h.core.RevokeAPIToken(args[1], h.user.Username)
+	default:
+		msg := common.WrapperString("Usage: token [list|add USERNAME NAME [EXPIRE]|revoke TOKEN_ID]", common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	if err != nil {
+		log.Error.Printf("%s api token failed, %s", args[0], err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
 	msg := common.WrapperString("Submit", common.Green)
 	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
 }
@@ -95,59 +552,115 @@ func (h *InteractiveHandler) listTable(table string) {
 			log.Error.Printf("query error from LOGINTICKET, %s", err)
 			return
 		}
-		title = "                 Ticket ID                | Application Date  |    User  |   Asset  |  SysUser |  Approver|   Approve Date    |   State"
+		title = "                 Ticket ID                | Application Date  |    User  |   Asset  |  SysUser |  Approver|   Approve Date    |   State  |    Valid Until    | Change ID|Reason|Command"
 	case "PENDINGTICKET":
 		rows, err = h.core.QueryPengdingLoginTicket()
 		if err != nil {
 			log.Error.Printf("query error from LOGINTICKET, %s", err)
 			return
 		}
-		title = "                 Ticket ID                | Application Date  |    User  |   Asset  |  SysUser "
+		title = "                 Ticket ID                | Application Date  |    User  |   Asset  |  SysUser |   Review Progress  | Change ID|Reason|Command"
 	case "USER":
 		rows, err = h.core.QueryAllUser()
 		if err != nil {
 			log.Error.Printf("query error from USER, %s", err)
 			return
 		}
-		title = "        ID|    User  |  Role|      Expire At    |OTP Level|Active|      Nodes     |    White list"
+		title = "        ID|    User  |    Role   |      Expire At    |OTP Level|Active|Replay Days|      Nodes     |    White list"
 	case "SYSUSER":
 		rows, err = h.core.QueryAllSystemUser()
 		if err != nil {
 			log.Error.Printf("query error from SYSTEMUSER, %s", err)
 			return
 		}
-		title = "        ID|    User  |Priority|Protocol|Password|Private Key|Comment"
+		title = "        ID|    User  |Priority|Protocol|Password|Private Key|Rotate|     Rotated At    |Comment"
 	case "ASSET":
 		rows, err = h.core.QueryAllAsset()
 		if err != nil {
 			log.Error.Printf("query error from ASSET, %s", err)
 			return
 		}
-		title = "        ID|Asset Name| Hostname |                   IP                  |    OS    |Active| Platform |   Protocols   |Comment"
+		title = "        ID|Asset Name| Hostname |                   IP                  |    OS    |Active| Platform |   Protocols   |   Status  |Comment"
 	case "NODE":
 		rows, err = h.core.QueryAllNode()
 		if err != nil {
 			log.Error.Printf("query error from NODE, %s", err)
 			return
 		}
-		title = "        ID|   Name   |    Key   |      Asset IDs"
+		title = "        ID|   Name   |    Key   |Replay Days|      Asset IDs"
 	case "ASSETUSER":
 		rows, err = h.core.QueryAssetUserInfo()
 		if err != nil {
 			log.Error.Printf("query error from ASSETUSER, %s", err)
 			return
 		}
-		title = "        ID|User ID|Asset ID|      Expire At    |Need Confirm|Enable VS Code|System User IDs"
+		title = "        ID|User ID|Asset ID|      Expire At    |Need Confirm|Enable VS Code|Enable SFTP|System User IDs"
 	case "SECRET":
 		rows, err = h.core.QueryAllUserSecret()
 		if err != nil {
 			log.Error.Printf("query error from SECRET, %s", err)
 			return
 		}
-		title = "   User ID|Password|Private Key|Authorized Keys"
+		title = "   User ID|Password|Private Key|TOTP Secret|Authorized Keys"
+	case "HOSTKEY":
+		rows, err = h.core.QueryAllAssetHostKey()
+		if err != nil {
+			log.Error.Printf("query error from ASSETHOSTKEY, %s", err)
+			return
+		}
+		title = "  Asset ID|       Address       |    Update Date    |Fingerprint|Pending Fingerprint"
+	case "TOKEN":
+		rows, err = h.core.QueryAllAPIToken()
+		if err != nil {
+			log.Error.Printf("query error from APITOKEN, %s", err)
+			return
+		}
+		title = "        ID|User ID|   Name   |    Create Date    |     Expire At     |     Last Used"
+	case "CMDFILTER":
+		rows, err = h.core.QueryAllCommandFilter()
+		if err != nil {
+			log.Error.Printf("query error from CMDFILTER, %s", err)
+			return
+		}
+		title = "        ID|   Name   | Action|Active|   Users  |   Nodes  | SysUsers |Patterns|Comment"
+	case "REVIEWFLOW":
+		rows, err = h.core.QueryAllReviewFlow()
+		if err != nil {
+			log.Error.Printf("query error from REVIEWFLOW, %s", err)
+			return
+		}
+		title = "        ID|   Name   |Active|  Assets  |   Nodes  |Steps|Comment"
+	case "GATEWAY":
+		rows, err = h.core.QueryAllGateway()
+		if err != nil {
+			log.Error.Printf("query error from GATEWAY, %s", err)
+			return
+		}
+		title = "        ID|   Name   |       Address       | Username |Password|Private Key|Priority|Active|  Assets  |   Nodes  |   Via  |Comment"
+	case "ROTATION":
+		rows, err = h.core.QueryRotationLog()
+		if err != nil {
+			log.Error.Printf("query error from ROTATIONLOG, %s", err)
+			return
+		}
+		title = "           Date          |  SysUser |        Asset       | Operator |Success|Message"
+	case "SESSION":
+		rows = proxy.QueryAliveSessions()
+		title = "      ID|    User  |        Asset       |  SysUser |Protocol|     Remote Address  |     Start Date    |Idle Time|Observers"
+	case "CMDLOG":
+		rows, err = h.core.QueryCommandLog("", "", "", "", commandLogLimit)
+		if err != nil {
+			log.Error.Printf("query error from CMDLOG, %s", err)
+			return
+		}
+		title = commandLogTitle
 	case "CONFIG":
 		h.showConfig()
 	}
+	h.writeRows(title, rows)
+}
+
+func (h *InteractiveHandler) writeRows(title string, rows []string) {
 	common.IgnoreErrWriteString(h.sess, title+common.CharNewLine)
 	for i, v := range rows {
 		l := fmt.Sprintf("%4d. %s", i+1, v)
@@ -69,10 +69,11 @@ func (u *UserSelectHandler) displaySortedAssets(searchHeader string) {
 	hostLabel := ("Hostname")
 	ipLabel := ("IP")
 	platformLabel := ("Platform")
+	statusLabel := ("Status")
 	commentLabel := ("Comment")
 
-	Labels := []string{idLabel, hostLabel, ipLabel, platformLabel, commentLabel}
-	fields := []string{"ID", "Hostname", "IP", "Platform", "Comment"}
+	Labels := []string{idLabel, hostLabel, ipLabel, platformLabel, statusLabel, commentLabel}
+	fields := []string{"ID", "Hostname", "IP", "Platform", "Status", "Comment"}
 	data := make([]map[string]string, len(u.currentResult))
 	for i, j := range u.currentResult {
 		row := make(map[string]string)
@@ -81,6 +82,7 @@ func (u *UserSelectHandler) displaySortedAssets(searchHeader string) {
 			"hostname": "Hostname",
 			"ip":       "IP",
 			"platform": "Platform",
+			"status":   "Status",
 			"comment":  "Comment",
 		}
 		row = convertMapItemToRow(j, fieldMap, row)
@@ -100,6 +102,7 @@ func (u *UserSelectHandler) displaySortedAssets(searchHeader string) {
 			"Hostname": {0, 40, 0},
 			"IP":       {0, 8, 40},
 			"Platform": {0, 8, 0},
+			"Status":   {0, 6, 11},
 			"Comment":  {0, 0, 0},
 		},
 		Data:        data,
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/proxy"
+)
+
+const (
+	commandLogLimit = 100
+	commandLogTitle = "           Date          | Session|    User  |        Asset       |  SysUser |  Risk |Command"
+
+	replayLimit = 50
+	replayTitle = "         Date        |    User  |        Asset       |   Size  |Replay"
+)
+
+// queryCommands handles "commands user=NAME asset=NAME from=DATE to=DATE limit=N"
+func (h *InteractiveHandler) queryCommands(args []string) {
+	var user, asset, from, to string
+	limit := commandLogLimit
+	var err error
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("invalid argument %s, the format is key=value", arg)
+			break
+		}
+		switch strings.ToLower(kv[0]) {
+		case "user":
+			user = kv[1]
+		case "asset":
+			asset = kv[1]
+		case "from":
+			from, err = parseQueryTime(kv[1], false)
+		case "to":
+			to, err = parseQueryTime(kv[1], true)
+		case "limit":
+			limit, err = strconv.Atoi(kv[1])
+		default:
+			err = fmt.Errorf("unknown key %s", kv[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	rows, err := h.core.QueryCommandLog(user, asset, from, to, limit)
+	if err != nil {
+		log.Error.Printf("query error from CMDLOG, %s", err)
+		return
+	}
+	h.writeRows(commandLogTitle, rows)
+}
+
+// parseQueryTime returns the time in the log format, a date of "to" means the end of the day
+func parseQueryTime(v string, end bool) (string, error) {
+	if t, err := time.ParseInLocation(common.LogFormat, v, time.Local); err == nil {
+		return t.Format(common.LogFormat), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %s, the format is 2006-01-02 or \"2006-01-02 15:04:05\"", v)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t.Format(common.LogFormat), nil
+}
+
+// queryReplays handles "replays user=NAME asset=NAME from=DATE to=DATE limit=N"
+func (h *InteractiveHandler) queryReplays(args []string) {
+	var user, asset string
+	var from, to time.Time
+	limit := replayLimit
+	var err error
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("invalid argument %s, the format is key=value", arg)
+			break
+		}
+		var v string
+		switch strings.ToLower(kv[0]) {
+		case "user":
+			user = kv[1]
+		case "asset":
+			asset = kv[1]
+		case "from":
+			if v, err = parseQueryTime(kv[1], false); err == nil {
+				from, err = time.ParseInLocation(common.LogFormat, v, time.Local)
+			}
+		case "to":
+			if v, err = parseQueryTime(kv[1], true); err == nil {
+				to, err = time.ParseInLocation(common.LogFormat, v, time.Local)
+			}
+		case "limit":
+			limit, err = strconv.Atoi(kv[1])
+		default:
+			err = fmt.Errorf("unknown key %s", kv[0])
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	replays, err := proxy.ListReplays(user, asset, from, to)
+	if err != nil {
+		log.Error.Printf("list replays failed, %s", err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+		return
+	}
+	if limit > 0 && len(replays) > limit {
+		replays = replays[:limit]
+	}
+	rows := make([]string, 0, len(replays))
+	for _, v := range replays {
+		rows = append(rows, fmt.Sprintf("%s|%10s|%20s|%9s|%s",
+			v.Date.Format(common.LogFormat), v.User, v.Asset, common.FormatSize(v.Size), v.Name))
+	}
+	h.writeRows(replayTitle, rows)
+}
+
+// playReplay plays the recording in the terminal of the admin, and returns to the menu when it's done
+func (h *InteractiveHandler) playReplay(name string) {
+	h.core.InsertLog("replay", h.user.Username, fmt.Sprintf("play %s", name))
+	err := proxy.PlayReplay(name, h.sess)
+	if err != nil {
+		log.Error.Printf("User %s play replay %s failed, %s", h.user.Username, name, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+	}
+}
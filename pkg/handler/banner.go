@@ -14,6 +14,8 @@ type MenuItem struct {
 	id       int
 	instruct string
 	helpText string
+	// the item is shown in the admin help if the role has any of the permissions
+	perms []string
 }
 
 type Menu []MenuItem
@@ -31,8 +33,14 @@ func (h *InteractiveHandler) displayBanner(sess io.ReadWriter, termConf *model.T
 		{id: 3, instruct: "p", helpText: "display the host you have permission"},
 		{id: 4, instruct: "g", helpText: "display the node that you have permission"},
 		{id: 5, instruct: "r", helpText: "refresh your assets and nodes"},
-		{id: 6, instruct: "h", helpText: "print help"},
-		{id: 7, instruct: "q", helpText: "exit"},
+		{id: 6, instruct: "join SESSION_ID", helpText: "join a live session by its full ID as co-driver after the owner accepts"},
+		{id: 7, instruct: "h", helpText: "print help"},
+		{id: 8, instruct: "q", helpText: "exit"},
+	}
+	if model.IsAdminRole(h.user.Role) {
+		// before h and q
+		item := MenuItem{instruct: "a", helpText: "enter the admin shell"}
+		menu = append(menu[:6], append(Menu{item}, menu[6:]...)...)
 	}
 
 	title := defaultTitle
@@ -49,9 +57,9 @@ func (h *InteractiveHandler) displayBanner(sess io.ReadWriter, termConf *model.T
 		return
 	}
 	cm := ColorMeta{GreenBoldColor: "\033[1;32m", ColorEnd: "\033[0m"}
-	for _, v := range menu {
+	for i, v := range menu {
 		line := fmt.Sprintf("\t%d) Enter {{.GreenBoldColor}}%s{{.ColorEnd}} to %s.%s",
-			v.id, v.instruct, v.helpText, "\r\n")
+			i+1, v.instruct, v.helpText, "\r\n")
 		tmpl := template.Must(template.New("item").Parse(line))
 		if err := tmpl.Execute(sess, cm); err != nil {
 			log.Error.Print(err)
@@ -59,16 +67,50 @@ func (h *InteractiveHandler) displayBanner(sess io.ReadWriter, termConf *model.T
 	}
 }
 
-func displayAdminHelp(sess io.ReadWriter) {
+func hasAnyPermission(role string, perms []string) bool {
+	if len(perms) == 0 {
+		return true
+	}
+	for _, p := range perms {
+		if model.HasPermission(role, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayAdminHelp shows the commands allowed for the role, the items are numbered in order
+func displayAdminHelp(sess io.ReadWriter, role string) {
 	title := common.WrapperTitle("GOJump Admin")
 	menu := Menu{
-		{id: 1, instruct: "otp USERNAME", helpText: "generate otp for user"},
-		{id: 2, instruct: "list TABLE", helpText: "list [USERLOG, TICKET, USER, SYSUSER, ASSET, NDOE, ASSETUSER, CONFIG, SECRET]"},
-		{id: 3, instruct: "ticket", helpText: "list pending tickets"},
-		{id: 4, instruct: "approve TICKET_ID", helpText: "approve the ticket"},
-		{id: 5, instruct: "reject TICKET_ID", helpText: "reject the ticket"},
-		{id: 6, instruct: "h", helpText: "print help"},
-		{id: 7, instruct: "q", helpText: "exit"},
+		{id: 1, instruct: "otp USERNAME", helpText: "generate otp for user", perms: []string{model.PermWriteUser}},
+		{id: 2, instruct: "totp USERNAME", helpText: "require user to enroll a new TOTP authenticator", perms: []string{model.PermWriteUser}},
+		{id: 3, instruct: "list TABLE", helpText: "list [USERLOG, TICKET, USER, SYSUSER, ASSET, NDOE, ASSETUSER, CONFIG, SECRET, HOSTKEY, TOKEN, SESSION, CMDFILTER, CMDLOG, GATEWAY, ROTATION, REVIEWFLOW]"},
+		{id: 4, instruct: "ticket", helpText: "list pending tickets", perms: []string{model.PermReadTicket}},
+		{id: 5, instruct: "approve TICKET_ID [WINDOW]", helpText: "approve the ticket, the login is reused without a new ticket within the window such as 2h", perms: []string{model.PermReviewTicket}},
+		{id: 6, instruct: "reject TICKET_ID", helpText: "reject the ticket", perms: []string{model.PermReviewTicket}},
+		{id: 7, instruct: "add TYPE key=value ...", helpText: "add [USER, ASSET, NODE, SYSUSER, ASSETUSER, CMDFILTER, GATEWAY, REVIEWFLOW], enter add to show the keys", perms: []string{model.PermWriteUser, model.PermWriteAsset}},
+		{id: 8, instruct: "edit TYPE ID key=value ...", helpText: "edit the entity", perms: []string{model.PermWriteUser, model.PermWriteAsset}},
+		{id: 9, instruct: "enable|disable TYPE ID", helpText: "enable or disable the user, asset, grant, command filter, gateway or review flow", perms: []string{model.PermWriteUser, model.PermWriteAsset}},
+		{id: 10, instruct: "delete TYPE ID", helpText: "delete the entity", perms: []string{model.PermWriteUser, model.PermWriteAsset}},
+		{id: 11, instruct: "hostkey [list|accept|revoke] ASSET_ID", helpText: "manage pinned host keys of assets, gwID for gateways", perms: []string{model.PermReadAsset}},
+		{id: 12, instruct: "monitor SESSION_ID", helpText: "watch the live session read-only", perms: []string{model.PermSession}},
+		{id: 13, instruct: "join SESSION_ID", helpText: "join the live session by its full ID as co-driver after the owner accepts", perms: []string{model.PermSession}},
+		{id: 14, instruct: "commands [user=] [asset=] [from=] [to=] [limit=]", helpText: "query the commands of sessions", perms: []string{model.PermAudit}},
+		{id: 15, instruct: "sessions", helpText: "list live sessions", perms: []string{model.PermSession}},
+		{id: 16, instruct: "replays [user=] [asset=] [from=] [to=] [limit=]", helpText: "list the replays of sessions", perms: []string{model.PermAudit}},
+		{id: 17, instruct: "play REPLAY", helpText: "play the replay, space to pause, arrow keys to seek and change speed, q to quit", perms: []string{model.PermAudit}},
+		{id: 18, instruct: "kill SESSION_ID", helpText: "terminate the live session", perms: []string{model.PermSession}},
+		{id: 19, instruct: "token [list|add USERNAME NAME [EXPIRE]|revoke TOKEN_ID]", helpText: "manage api tokens of admin users", perms: []string{model.PermSystem}},
+		{id: 20, instruct: "reencrypt [KEY_FILE|-]", helpText: "encrypt secrets by the current master key, KEY_FILE or - must be the current one", perms: []string{model.PermSystem}},
+		{id: 21, instruct: "rotate SYSUSER_ID", helpText: "rotate the secret of the system user on its assets", perms: []string{model.PermWriteAsset}},
+		{id: 22, instruct: "push SYSUSER_ID admin=SYSUSER_ID asset=ASSET_ID|node=NODE_ID", helpText: "create the account of the system user on the assets", perms: []string{model.PermWriteAsset}},
+		{id: 23, instruct: "check ASSET", helpText: "check the connectivity and the system users of the asset by ID or name", perms: []string{model.PermWriteAsset}},
+		{id: 24, instruct: "h", helpText: "print help"},
+		{id: 25, instruct: "q", helpText: "exit"},
+	}
+	if role != model.RoleAdmin {
+		menu[len(menu)-1].helpText = "go back to the asset menu"
 	}
 
 	prefix := common.CharClear + common.CharTab + common.CharTab + common.CharTab
@@ -79,9 +121,14 @@ func displayAdminHelp(sess io.ReadWriter) {
 		return
 	}
 	cm := ColorMeta{GreenBoldColor: "\033[1;32m", ColorEnd: "\033[0m"}
+	id := 0
 	for _, v := range menu {
+		if !hasAnyPermission(role, v.perms) {
+			continue
+		}
+		id++
 		line := fmt.Sprintf("\t%d) Enter {{.GreenBoldColor}}%s{{.ColorEnd}} to %s.%s",
-			v.id, v.instruct, v.helpText, "\r\n")
+			id, v.instruct, v.helpText, "\r\n")
 		tmpl := template.Must(template.New("item").Parse(line))
 		if err := tmpl.Execute(sess, cm); err != nil {
 			log.Error.Print(err)
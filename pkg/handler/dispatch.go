@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
 )
 
 func (h *InteractiveHandler) Dispatch() {
@@ -13,7 +14,8 @@ func (h *InteractiveHandler) Dispatch() {
 	var initialed bool
 	checkChan := make(chan bool)
 	go h.checkMaxIdleTime(checkChan)
-	if h.selectHandler.HasJustOneAsset() {
+	// the admin roles stay in the menu, from where they enter the admin shell
+	if h.selectHandler.HasJustOneAsset() && !model.IsAdminRole(h.user.Role) {
 		checkChan <- false
 		h.selectHandler.SearchOrProxy("")
 		return
@@ -63,6 +65,13 @@ func (h *InteractiveHandler) Dispatch() {
 			case "r":
 				h.refreshAssetsAndNodesData()
 				continue
+			case "a":
+				if model.IsAdminRole(h.user.Role) {
+					h.adminShell(checkChan)
+					h.displayHelp()
+					initialed = false
+					continue
+				}
 			case "q":
 				return
 			}
@@ -70,6 +79,9 @@ func (h *InteractiveHandler) Dispatch() {
 			switch {
 			case line == "exit", line == "quit":
 				return
+			case strings.HasPrefix(line, "join "):
+				h.shareSession(strings.TrimSpace(strings.TrimPrefix(line, "join ")), true)
+				continue
 			case strings.Index(line, "/") == 0:
 				if strings.Index(line[1:], "/") == 0 {
 					line = strings.TrimSpace(line[2:])
@@ -0,0 +1,653 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anmitsu/go-shlex"
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+const manageUsage = `Usage:
+  add TYPE key=value ...
+  edit TYPE ID key=value ...
+  enable|disable TYPE ID
+  delete TYPE ID
+TYPE and keys:
+  USER      username role=ROLE expire=2006-01-02|never otp=0|1|2 active nodes whitelist password keys replay=DAYS
+  ASSET     name hostname ip os comment protocols=ssh/22 platform active
+  NODE      key=1:3 name assets replay=DAYS
+  SYSUSER   username priority protocol comment password privatekey shell sudo rotate=DAYS
+  ASSETUSER user asset sysusers expire=2006-01-02|never confirm vscode sftp
+  CMDFILTER name action=deny|confirm|warn patterns users nodes sysusers active comment
+  GATEWAY   name ip port username password privatekey priority assets nodes via active comment
+  REVIEWFLOW name steps=4|5|6:2,7 assets nodes active comment
+ROLE is admin (super admin), user_admin, asset_admin, reviewer, auditor or user,
+only the super admin can manage the users of the other roles than user.
+Lists are separated by commas, password=- and privatekey=- read the secret without echo,
+patterns=- reads the regular expressions line by line, a filter without users, nodes and sysusers applies to all.
+A gateway is reached through the gateways of via, the gateways of an asset are tried by priority.
+rotate=0 disables the scheduled rotation of the secret of a system user,
+sudo is the commands of the sudoers entry written by push, such as sudo=ALL.
+replay=DAYS keeps the replays of the user or the assets of the node longer or shorter than REPLAY_KEEP_DAYS,
+the longest one applies, 0 follows REPLAY_KEEP_DAYS and -1 keeps them forever.
+steps of a review flow are passed in order, each step is the user IDs of the reviewers separated by |
+and the number of them to approve, the flow of the asset wins over the flows of its nodes, and a flow
+without assets and nodes applies to the other tickets.`
+
+var manageFields = map[string][]string{
+	"USER":       {"username", "role", "expire", "otp", "active", "nodes", "whitelist", "password", "keys", "replay"},
+	"ASSET":      {"name", "hostname", "ip", "os", "comment", "protocols", "platform", "active"},
+	"NODE":       {"key", "name", "assets", "replay"},
+	"SYSUSER":    {"username", "priority", "protocol", "comment", "password", "privatekey", "shell", "sudo", "rotate"},
+	"ASSETUSER":  {"user", "asset", "sysusers", "expire", "confirm", "vscode", "sftp"},
+	"CMDFILTER":  {"name", "action", "patterns", "users", "nodes", "sysusers", "active", "comment"},
+	"GATEWAY":    {"name", "ip", "port", "username", "password", "privatekey", "priority", "assets", "nodes", "via", "active", "comment"},
+	"REVIEWFLOW": {"name", "steps", "assets", "nodes", "active", "comment"},
+}
+
+// manageEntity handles add, edit, enable, disable and delete of the admin shell.
+func (h *InteractiveHandler) manageEntity(line string) {
+	args, err := shlex.Split(line, true)
+	if err != nil {
+		h.writeManageError(err)
+		return
+	}
+	if len(args) < 2 {
+		h.writeManageUsage()
+		return
+	}
+	action := args[0]
+	table := strings.ToUpper(args[1])
+	if _, ok := manageFields[table]; !ok {
+		h.writeManageError(fmt.Errorf("unknown type %s", args[1]))
+		return
+	}
+	switch action {
+	case "add":
+		err = h.addEntity(table, args[2:])
+	case "edit", "enable", "disable", "delete":
+		if len(args) < 3 {
+			h.writeManageUsage()
+			return
+		}
+		id := args[2]
+		switch action {
+		case "edit":
+			err = h.editEntity(table, id, args[3:])
+		case "enable", "disable":
+			err = h.setEntityActive(table, id, action == "enable")
+		case "delete":
+			err = h.deleteEntity(table, id)
+		}
+	}
+	if err != nil {
+		// the line may contain secrets, so only the entity is logged
+		target := table
+		if action != "add" {
+			target += " " + args[2]
+		}
+		log.Error.Printf("Admin %s %s %s failed, %s", h.user.Username, action, target, err)
+		h.writeManageError(err)
+		return
+	}
+	msg := common.WrapperString("Submit", common.Green)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) writeManageUsage() {
+	msg := strings.ReplaceAll(manageUsage, "\n", common.CharNewLine)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) writeManageError(err error) {
+	msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+	common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+}
+
+func (h *InteractiveHandler) parseFields(table string, args []string) (map[string]string, error) {
+	fields := make(map[string]string, len(args))
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid argument %s, the format is key=value", arg)
+		}
+		key := strings.ToLower(kv[0])
+		if !isManageField(table, key) {
+			return nil, fmt.Errorf("unknown key %s of %s", kv[0], table)
+		}
+		fields[key] = kv[1]
+	}
+	for _, key := range []string{"password", "privatekey"} {
+		if fields[key] != "-" {
+			continue
+		}
+		v, err := h.readSecret(key)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = v
+	}
+	if fields["patterns"] == "-" {
+		v, err := h.readPatterns()
+		if err != nil {
+			return nil, err
+		}
+		fields["patterns"] = v
+	}
+	return fields, nil
+}
+
+func isManageField(table, key string) bool {
+	for _, v := range manageFields[table] {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
+// readSecret reads the password, or the private key line by line until an empty line.
+func (h *InteractiveHandler) readSecret(key string) (string, error) {
+	if key == "password" {
+		pass, err := h.term.ReadPassword("Password: ")
+		if err != nil {
+			return "", err
+		}
+		confirm, err := h.term.ReadPassword("Confirm password: ")
+		if err != nil {
+			return "", err
+		}
+		if pass != confirm {
+			return "", errors.New("passwords do not match")
+		}
+		return pass, nil
+	}
+	common.IgnoreErrWriteString(h.sess, "Paste the private key, end with an empty line:"+common.CharNewLine)
+	lines := make([]string, 0, 30)
+	for {
+		line, err := h.term.ReadPassword("")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// readPatterns reads the regular expressions until an empty line, they are joined with newlines.
+func (h *InteractiveHandler) readPatterns() (string, error) {
+	common.IgnoreErrWriteString(h.sess, "Enter a regular expression per line, end with an empty line:"+common.CharNewLine)
+	h.term.SetPrompt("> ")
+	defer h.term.SetPrompt("Opt> ")
+	lines := make([]string, 0, 5)
+	for {
+		line, err := h.term.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func parseList(v string) []string {
+	res := make([]string, 0, 5)
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// parseExpire parses the expiration date, 0 means never expire
+func parseExpire(v string) (int64, error) {
+	switch strings.ToLower(v) {
+	case "", "0", "never":
+		return 0, nil
+	}
+	for _, layout := range []string{common.LogFormat, "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, v, time.Local)
+		if err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid expiration %s, the format is 2006-01-02 or never", v)
+}
+
+func (h *InteractiveHandler) addEntity(table string, args []string) error {
+	fields, err := h.parseFields(table, args)
+	if err != nil {
+		return err
+	}
+	admin := h.user.Username
+	switch table {
+	case "USER":
+		user := model.User{Role: model.RoleUser, IsActive: true}
+		if err = applyUserFields(&user, fields); err != nil {
+			return err
+		}
+		return h.core.AddUser(&user, fields["password"], parseList(fields["keys"]), admin)
+	case "ASSET":
+		asset := model.Asset{IsActive: true}
+		if err = applyAssetFields(&asset, fields); err != nil {
+			return err
+		}
+		return h.core.AddAsset(&asset, admin)
+	case "NODE":
+		node := model.Node{}
+		if err = applyNodeFields(&node, fields); err != nil {
+			return err
+		}
+		return h.core.AddNode(&node, admin)
+	case "SYSUSER":
+		sys := model.SystemUser{}
+		if err = applySystemUserFields(&sys, fields); err != nil {
+			return err
+		}
+		return h.core.AddSystemUser(&sys, admin)
+	case "ASSETUSER":
+		au := model.AssetUserInfo{}
+		if err = applyAssetUserFields(&au, fields); err != nil {
+			return err
+		}
+		return h.core.AddAssetUserInfo(&au, admin)
+	case "CMDFILTER":
+		f := model.CommandFilter{IsActive: true}
+		if err = applyCommandFilterFields(&f, fields); err != nil {
+			return err
+		}
+		return h.core.AddCommandFilter(&f, admin)
+	case "GATEWAY":
+		g := model.Gateway{IsActive: true}
+		if err = applyGatewayFields(&g, fields); err != nil {
+			return err
+		}
+		return h.core.AddGateway(&g, admin)
+	case "REVIEWFLOW":
+		f := model.ReviewFlow{IsActive: true}
+		if err = applyReviewFlowFields(&f, fields); err != nil {
+			return err
+		}
+		return h.core.AddReviewFlow(&f, admin)
+	}
+	return nil
+}
+
+func (h *InteractiveHandler) editEntity(table string, id string, args []string) error {
+	fields, err := h.parseFields(table, args)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return errors.New("nothing to edit")
+	}
+	admin := h.user.Username
+	switch table {
+	case "USER":
+		user, err := h.core.GetUserById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyUserFields(&user, fields); err != nil {
+			return err
+		}
+		if err = h.core.UpdateUser(&user, admin); err != nil {
+			return err
+		}
+		if v, ok := fields["password"]; ok {
+			if err = h.core.SetUserPassword(id, v, admin); err != nil {
+				return err
+			}
+		}
+		if v, ok := fields["keys"]; ok {
+			return h.core.SetUserAuthorizedKeys(id, parseList(v), admin)
+		}
+	case "ASSET":
+		asset, err := h.core.GetAssetById(id)
+		if err != nil {
+			return err
+		}
+		if asset.ID == "" {
+			return fmt.Errorf("asset %s not found", id)
+		}
+		if err = applyAssetFields(&asset, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateAsset(&asset, admin)
+	case "NODE":
+		node, err := h.core.GetNodeById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyNodeFields(&node, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateNode(&node, admin)
+	case "SYSUSER":
+		sys, err := h.core.GetSystemUserById(id)
+		if err != nil {
+			return err
+		}
+		if err = applySystemUserFields(&sys, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateSystemUser(&sys, admin)
+	case "ASSETUSER":
+		au, err := h.core.GetAssetUserInfoById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyAssetUserFields(&au, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateAssetUserInfo(&au, admin)
+	case "CMDFILTER":
+		f, err := h.core.GetCommandFilterById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyCommandFilterFields(&f, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateCommandFilter(&f, admin)
+	case "GATEWAY":
+		g, err := h.core.GetGatewayById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyGatewayFields(&g, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateGateway(&g, admin)
+	case "REVIEWFLOW":
+		f, err := h.core.GetReviewFlowById(id)
+		if err != nil {
+			return err
+		}
+		if err = applyReviewFlowFields(&f, fields); err != nil {
+			return err
+		}
+		return h.core.UpdateReviewFlow(&f, admin)
+	}
+	return nil
+}
+
+func (h *InteractiveHandler) setEntityActive(table string, id string, active bool) error {
+	admin := h.user.Username
+	switch table {
+	case "USER":
+		return h.core.SetUserActive(id, active, admin)
+	case "ASSET":
+		return h.core.SetAssetActive(id, active, admin)
+	case "ASSETUSER":
+		if active {
+			return errors.New("edit the grant with a new expiration to enable it")
+		}
+		return h.core.DisableAssetUserInfo(id, admin)
+	case "CMDFILTER":
+		return h.core.SetCommandFilterActive(id, active, admin)
+	case "GATEWAY":
+		return h.core.SetGatewayActive(id, active, admin)
+	case "REVIEWFLOW":
+		return h.core.SetReviewFlowActive(id, active, admin)
+	}
+	return fmt.Errorf("%s can not be enabled or disabled", table)
+}
+
+func (h *InteractiveHandler) deleteEntity(table string, id string) error {
+	admin := h.user.Username
+	switch table {
+	case "USER":
+		return h.core.DeleteUser(id, admin)
+	case "ASSET":
+		return h.core.DeleteAsset(id, admin)
+	case "NODE":
+		return h.core.DeleteNode(id, admin)
+	case "SYSUSER":
+		return h.core.DeleteSystemUser(id, admin)
+	case "ASSETUSER":
+		return h.core.DeleteAssetUserInfo(id, admin)
+	case "CMDFILTER":
+		return h.core.DeleteCommandFilter(id, admin)
+	case "GATEWAY":
+		return h.core.DeleteGateway(id, admin)
+	case "REVIEWFLOW":
+		return h.core.DeleteReviewFlow(id, admin)
+	}
+	return nil
+}
+
+func applyUserFields(user *model.User, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "username":
+			user.Username = v
+		case "role":
+			user.Role = strings.ToLower(v)
+		case "expire":
+			user.ExpireAt, err = parseExpire(v)
+		case "otp":
+			user.OTPLevel, err = strconv.Atoi(v)
+		case "active":
+			user.IsActive, err = strconv.ParseBool(v)
+		case "nodes":
+			user.NodeIDs = parseList(v)
+		case "whitelist":
+			user.AddrWhiteList = parseList(v)
+		case "replay":
+			user.ReplayKeepDays, err = strconv.Atoi(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyAssetFields(asset *model.Asset, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "name":
+			asset.Name = v
+		case "hostname":
+			asset.Hostname = v
+		case "ip":
+			asset.IP = v
+		case "os":
+			asset.Os = v
+		case "comment":
+			asset.Comment = v
+		case "protocols":
+			asset.Protocols = parseList(v)
+		case "platform":
+			asset.Platform = v
+		case "active":
+			asset.IsActive, err = strconv.ParseBool(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyNodeFields(node *model.Node, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "key":
+			node.Key = v
+		case "name":
+			node.Name = v
+		case "assets":
+			node.AssetIDs = parseList(v)
+		case "replay":
+			node.ReplayKeepDays, err = strconv.Atoi(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applySystemUserFields(sys *model.SystemUser, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "username":
+			sys.Username = v
+		case "priority":
+			sys.Priority, err = strconv.Atoi(v)
+		case "protocol":
+			sys.Protocol = strings.ToLower(v)
+		case "comment":
+			sys.Comment = v
+		case "password":
+			sys.Password = v
+		case "privatekey":
+			sys.PrivateKey = v
+		case "shell":
+			sys.Shell = v
+		case "sudo":
+			sys.Sudo = v
+		case "rotate":
+			sys.RotateDays, err = strconv.Atoi(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyAssetUserFields(au *model.AssetUserInfo, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "user":
+			au.UserID = v
+		case "asset":
+			au.AssetID = v
+		case "sysusers":
+			au.SysUserID = parseList(v)
+		case "expire":
+			au.ExpireAt, err = parseExpire(v)
+		case "confirm":
+			au.NeedConfirm, err = strconv.ParseBool(v)
+		case "vscode":
+			au.EnableVscode, err = strconv.ParseBool(v)
+		case "sftp":
+			au.EnableSFTP, err = strconv.ParseBool(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyCommandFilterFields(f *model.CommandFilter, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "name":
+			f.Name = v
+		case "action":
+			f.Action = strings.ToLower(v)
+		case "patterns":
+			f.Patterns = strings.Split(v, "\n")
+		case "users":
+			f.UserIDs = parseList(v)
+		case "nodes":
+			f.NodeIDs = parseList(v)
+		case "sysusers":
+			f.SysUserIDs = parseList(v)
+		case "active":
+			f.IsActive, err = strconv.ParseBool(v)
+		case "comment":
+			f.Comment = v
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyGatewayFields(g *model.Gateway, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "name":
+			g.Name = v
+		case "ip":
+			g.IP = v
+		case "port":
+			g.Port, err = strconv.Atoi(v)
+		case "username":
+			g.Username = v
+		case "password":
+			g.Password = v
+		case "privatekey":
+			g.PrivateKey = v
+		case "priority":
+			g.Priority, err = strconv.Atoi(v)
+		case "assets":
+			g.AssetIDs = parseList(v)
+		case "nodes":
+			g.NodeIDs = parseList(v)
+		case "via":
+			g.ViaIDs = parseList(v)
+		case "active":
+			g.IsActive, err = strconv.ParseBool(v)
+		case "comment":
+			g.Comment = v
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+func applyReviewFlowFields(f *model.ReviewFlow, fields map[string]string) error {
+	var err error
+	for k, v := range fields {
+		switch k {
+		case "name":
+			f.Name = v
+		case "steps":
+			f.Steps, err = core.ParseReviewSteps(v)
+		case "assets":
+			f.AssetIDs = parseList(v)
+		case "nodes":
+			f.NodeIDs = parseList(v)
+		case "active":
+			f.IsActive, err = strconv.ParseBool(v)
+		case "comment":
+			f.Comment = v
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// ticketNotifier writes the tickets waiting for the reviewer into the admin shell. The notices are
+// held while a command is running, and written when the shell waits for the next command.
+type ticketNotifier struct {
+	h *InteractiveHandler
+
+	lock    sync.Mutex
+	idle    bool
+	pending []string
+
+	stop chan struct{}
+}
+
+func newTicketNotifier(h *InteractiveHandler) *ticketNotifier {
+	n := &ticketNotifier{h: h, stop: make(chan struct{})}
+	if !model.HasPermission(h.user.Role, model.PermReviewTicket) {
+		return n
+	}
+	events, cancel := h.core.Subscribe(core.EventTicketPending)
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case <-n.stop:
+				return
+			case e := <-events:
+				if n.isReviewer(e.Ticket) {
+					n.notify(ticketNotice(e.Ticket))
+				}
+			}
+		}
+	}()
+	return n
+}
+
+func (n *ticketNotifier) isReviewer(t *model.LoginTicket) bool {
+	username := n.h.user.Username
+	if t.State != model.TicketOpen || t.Username == username {
+		return false
+	}
+	if len(t.Steps) == 0 {
+		return true
+	}
+	for _, r := range t.Steps[t.Step].Reviewers {
+		if r == username {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *ticketNotifier) notify(msg string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if !n.idle {
+		n.pending = append(n.pending, msg)
+		return
+	}
+	_, _ = n.h.term.Write([]byte(msg + common.CharNewLine))
+}
+
+// setIdle writes the held notices when the shell becomes idle
+func (n *ticketNotifier) setIdle(idle bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.idle = idle
+	if !idle {
+		return
+	}
+	for _, msg := range n.pending {
+		_, _ = n.h.term.Write([]byte(msg + common.CharNewLine))
+	}
+	n.pending = nil
+}
+
+func (n *ticketNotifier) Close() {
+	close(n.stop)
+}
+
+func ticketNotice(t *model.LoginTicket) string {
+	action := "login"
+	if t.Command != "" {
+		action = fmt.Sprintf("command %q", t.Command)
+	}
+	msg := fmt.Sprintf("New ticket %s: %s requests %s on %s@%s", t.TicketId, t.Username, action,
+		t.SysUsername, t.AssetName)
+	if len(t.Steps) > 1 {
+		msg += fmt.Sprintf(", step %d/%d", t.Step+1, len(t.Steps))
+	}
+	if t.Reason != "" {
+		msg += fmt.Sprintf(", reason: %s", t.Reason)
+	}
+	if t.ChangeID != "" {
+		msg += fmt.Sprintf(", change: %s", t.ChangeID)
+	}
+	return common.WrapperString(msg, common.Green)
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/proxy"
+)
+
+// shareSession monitors or joins a live session, and returns to the menu when it's done.
+func (h *InteractiveHandler) shareSession(sessionID string, writable bool) {
+	err := proxy.ShareSession(sessionID, h.sess, h.user.Username, writable)
+	if err != nil {
+		log.Error.Printf("User %s share session %s failed, %s", h.user.Username, sessionID, err)
+		msg := common.WrapperString(fmt.Sprintf("Error: %s", err), common.Red)
+		common.IgnoreErrWriteString(h.sess, msg+common.CharNewLine)
+	}
+}
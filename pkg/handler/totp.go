@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+const (
+	totpIssuer       = "GoJump"
+	maxEnrollTryTime = 3
+)
+
+// EnrollTOTP shows a new authenticator secret to the user and stores it
+// once the user proves the authenticator works by entering a valid code.
+func EnrollTOTP(sess io.ReadWriter, c *core.Core, user *model.User) bool {
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		log.Error.Printf("generate totp secret failed: %s", err)
+		return false
+	}
+	uri := common.TOTPURI(totpIssuer, user.Username, secret)
+	title := common.WrapperTitle("Enroll TOTP authenticator")
+	common.IgnoreErrWriteString(sess, common.CharClear+title+common.CharNewLine+common.CharNewLine)
+	if qrCode, err := common.QRCodeString(uri); err == nil {
+		common.IgnoreErrWriteString(sess, qrCode+common.CharNewLine)
+	} else {
+		log.Error.Printf("generate qr code failed: %s", err)
+	}
+	common.IgnoreErrWriteString(sess, "Scan the QR code or add the URI to your authenticator app:"+common.CharNewLine)
+	common.IgnoreErrWriteString(sess, uri+common.CharNewLine)
+	common.IgnoreErrWriteString(sess, "Secret: "+secret+common.CharNewLine+common.CharNewLine)
+
+	term := common.NewTerminal(sess, "Verification code: ")
+	for i := 0; i < maxEnrollTryTime; i++ {
+		code, err := term.ReadLine()
+		if err != nil {
+			return false
+		}
+		if err = c.EnrollTOTP(user, secret, code); err != nil {
+			log.Info.Printf("User %s enroll totp failed: %s", user.Username, err)
+			common.IgnoreErrWriteString(sess, common.WrapperString("Invalid verification code", common.Red)+common.CharNewLine)
+			continue
+		}
+		msg := "TOTP authenticator enrolled, verification code is required from the next login"
+		common.IgnoreErrWriteString(sess, common.WrapperString(msg, common.Green)+common.CharNewLine)
+		return true
+	}
+	return false
+}
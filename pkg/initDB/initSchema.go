@@ -9,7 +9,9 @@ import (
 
 func InitSchema(db *genji.DB) {
 	schemas := []string{"TERMINALCONF", "USER", "ASSET", "NODE",
-		"USERSECRET", "SYSTEMUSER", "ASSETUSERINFO", "USERLOG", "LOGINTICKET"}
+		"USERSECRET", "SYSTEMUSER", "ASSETUSERINFO", "USERLOG", "LOGINTICKET",
+		"ASSETHOSTKEY", "APITOKEN", "CMDFILTER", "CMDLOG", "GATEWAY",
+		"ASSETSECRET", "ROTATIONLOG", "ASSETHEALTH", "REVIEWFLOW"}
 
 	var err error
 	for _, v := range schemas {
@@ -0,0 +1,12 @@
+package model
+
+// APIToken authenticates the RESTful api as an admin user, only the sha256 digest of the token is stored.
+type APIToken struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	Name       string `json:"name"`
+	Digest     string `json:"-"`
+	ExpireAt   int64  `json:"expire_at"`
+	CreateDate string `json:"create_date"`
+	LastUsed   string `json:"last_used"`
+}
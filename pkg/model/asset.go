@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
@@ -24,13 +25,14 @@ type Asset struct {
 }
 
 type AssetUserInfo struct {
-	ID           string
-	UserID       string
-	AssetID      string
-	ExpireAt     int64
-	SysUserID    []string
-	EnableVscode bool
-	NeedConfirm  bool
+	ID           string   `json:"id"`
+	UserID       string   `json:"user_id"`
+	AssetID      string   `json:"asset_id"`
+	ExpireAt     int64    `json:"expire_at"`
+	SysUserID    []string `json:"system_user_ids"`
+	EnableVscode bool     `json:"enable_vscode"`
+	EnableSFTP   bool     `json:"enable_sftp"`
+	NeedConfirm  bool     `json:"need_confirm"`
 }
 
 func (a *Asset) String() string {
@@ -51,6 +53,35 @@ func (a *Asset) ProtocolPort(protocol string) int {
 	return 0
 }
 
+// ParseProtocolPort parses the protocol item in format protocol/port, such as ssh/22
+func ParseProtocolPort(item string) (string, int, error) {
+	proAndPort := strings.Split(item, "/")
+	if len(proAndPort) != 2 || proAndPort[0] == "" {
+		return "", 0, fmt.Errorf("invalid protocol %s, the format is protocol/port", item)
+	}
+	port, err := strconv.Atoi(proAndPort[1])
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port of protocol %s", item)
+	}
+	return strings.ToLower(proAndPort[0]), port, nil
+}
+
+func ValidateProtocols(protocols []string) error {
+	if len(protocols) == 0 {
+		return errors.New("at least one protocol is required")
+	}
+	for _, item := range protocols {
+		p, _, err := ParseProtocolPort(item)
+		if err != nil {
+			return err
+		}
+		if p != ProtocolSSH {
+			return fmt.Errorf("unsupported protocol %s", p)
+		}
+	}
+	return nil
+}
+
 func (a *Asset) IsSupportProtocol(protocol string) bool {
 	for _, item := range a.Protocols {
 		if strings.Contains(strings.ToLower(item), strings.ToLower(protocol)) {
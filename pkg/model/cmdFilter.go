@@ -0,0 +1,38 @@
+package model
+
+const (
+	FilterDeny    = "deny"
+	FilterConfirm = "confirm"
+	FilterWarn    = "warn"
+)
+
+// CommandFilter applies to the sessions of the users, the assets in the nodes and the system users,
+// it applies to all sessions if none of them is set.
+type CommandFilter struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Action     string   `json:"action"`
+	Patterns   []string `json:"patterns"`
+	UserIDs    []string `json:"user_ids"`
+	NodeIDs    []string `json:"node_ids"`
+	SysUserIDs []string `json:"system_user_ids"`
+	IsActive   bool     `json:"is_active"`
+	Comment    string   `json:"comment"`
+}
+
+// FilterActionLevel is the risk level of the action, the higher one wins when several filters match
+func FilterActionLevel(action string) int {
+	switch action {
+	case FilterDeny:
+		return RiskDeny
+	case FilterConfirm:
+		return RiskConfirm
+	case FilterWarn:
+		return RiskWarn
+	}
+	return RiskNormal
+}
+
+func (f *CommandFilter) IsGlobal() bool {
+	return len(f.UserIDs) == 0 && len(f.NodeIDs) == 0 && len(f.SysUserIDs) == 0
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Gateway is a SSH server which reaches the assets in an isolated network, the assets are bound to it
+// directly or by the nodes. A gateway may be reached through other gateways in turn, which makes a multi-hop route.
+type Gateway struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	IP         string   `json:"ip"`
+	Port       int      `json:"port"`
+	Username   string   `json:"username"`
+	Password   string   `json:"-"`
+	PrivateKey string   `json:"-"`
+	Priority   int      `json:"priority"`
+	AssetIDs   []string `json:"asset_ids"`
+	NodeIDs    []string `json:"node_ids"`
+	ViaIDs     []string `json:"via_gateway_ids"`
+	IsActive   bool     `json:"is_active"`
+	Comment    string   `json:"comment"`
+}
+
+func (g *Gateway) String() string {
+	return fmt.Sprintf("%s(%s:%d)", g.Name, g.IP, g.Port)
+}
+
+// GatewayRoute is a gateway with the gateways to reach it, which are tried in order.
+type GatewayRoute struct {
+	Gateway Gateway
+	Via     []GatewayRoute
+}
+
+// SortGatewayByPriority sorts the gateways by priority, the one with a lower priority is tried first.
+func SortGatewayByPriority(gateways []Gateway) {
+	sort.SliceStable(gateways, func(i, j int) bool {
+		return gateways[i].Priority < gateways[j].Priority
+	})
+}
@@ -0,0 +1,31 @@
+package model
+
+const (
+	HealthUnknown    = "unknown"
+	HealthOK         = "ok"
+	HealthDown       = "down"
+	HealthAuthFailed = "auth failed"
+)
+
+// AssetHealth is the latest result of checking the SSH port and the system users of an asset
+type AssetHealth struct {
+	AssetID   string `json:"asset_id"`
+	Reachable bool   `json:"reachable"`
+	AuthOK    bool   `json:"auth_ok"`
+	// Millisecond to connect the SSH port
+	Latency   int64  `json:"latency"`
+	CheckDate string `json:"check_date"`
+	Message   string `json:"message"`
+}
+
+func (h *AssetHealth) Status() string {
+	switch {
+	case h.CheckDate == "":
+		return HealthUnknown
+	case !h.Reachable:
+		return HealthDown
+	case !h.AuthOK:
+		return HealthAuthFailed
+	}
+	return HealthOK
+}
@@ -0,0 +1,12 @@
+package model
+
+type AssetHostKey struct {
+	AssetID            string
+	Address            string
+	PublicKey          string
+	Fingerprint        string
+	PendingKey         string
+	PendingFingerprint string
+	CreateDate         string
+	UpdateDate         string
+}
@@ -1,8 +1,39 @@
 package model
 
 type UserLog struct {
-	Datetime string
-	Type     string
-	User     string
-	Log      string
+	Datetime string `json:"datetime"`
+	Type     string `json:"type"`
+	User     string `json:"user"`
+	Log      string `json:"log"`
+}
+
+const (
+	RiskNormal = iota
+	RiskWarn
+	RiskConfirm
+	RiskDeny
+)
+
+// CommandLog is a command which the user runs in a proxied session
+type CommandLog struct {
+	SessionID  string `json:"session_id"`
+	User       string `json:"user"`
+	Asset      string `json:"asset"`
+	AssetID    string `json:"asset_id"`
+	SystemUser string `json:"system_user"`
+	Datetime   string `json:"datetime"`
+	Command    string `json:"command"`
+	RiskLevel  int    `json:"risk_level"`
+}
+
+func RiskLevelName(level int) string {
+	switch level {
+	case RiskWarn:
+		return "warn"
+	case RiskConfirm:
+		return "confirm"
+	case RiskDeny:
+		return "deny"
+	}
+	return "normal"
 }
@@ -9,10 +9,12 @@ import (
 type NodeList []Node
 
 type Node struct {
-	ID       string `json:"id"`
-	Key      string `json:"key"`
-	Name     string `json:"name"`
-	AssetIDs []string
+	ID       string   `json:"id"`
+	Key      string   `json:"key"`
+	Name     string   `json:"name"`
+	AssetIDs []string `json:"asset_ids"`
+	// days to keep the replays of the assets, 0 follows REPLAY_KEEP_DAYS, -1 keeps them forever
+	ReplayKeepDays int `json:"replay_keep_days"`
 }
 
 type nodeSortBy func(node1, node2 *Node) bool
@@ -69,6 +71,28 @@ func keySort(node1, node2 *Node) bool {
 	return true
 }
 
+// ValidNodeKey reports whether the key is numbers separated by colons, such as 1:3:0
+func ValidNodeKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range strings.Split(key, ":") {
+		if _, err := strconv.ParseUint(k, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// ParentNodeKey returns the key of parent node, or empty string for the root node.
+func ParentNodeKey(key string) string {
+	r := strings.LastIndex(key, ":")
+	if r < 0 {
+		return ""
+	}
+	return key[:r]
+}
+
 func SortNodesByKey(nodes []Node) {
 	nodeSortBy(keySort).Sort(nodes)
 }
@@ -0,0 +1,19 @@
+package model
+
+// ReviewStep is passed when Required of the reviewers approve
+type ReviewStep struct {
+	ReviewerIDs []string `json:"reviewer_ids"`
+	Required    int      `json:"required"`
+}
+
+// ReviewFlow reviews the tickets of the assets, and the assets in the nodes, step by step.
+// The tickets without a flow are reviewed by any one of the reviewers.
+type ReviewFlow struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Steps    []ReviewStep `json:"steps"`
+	AssetIDs []string     `json:"asset_ids"`
+	NodeIDs  []string     `json:"node_ids"`
+	IsActive bool         `json:"is_active"`
+	Comment  string       `json:"comment"`
+}
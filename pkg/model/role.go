@@ -0,0 +1,51 @@
+package model
+
+// Permissions of the admin shell and the api
+const (
+	PermReadUser     = "user:read"
+	PermWriteUser    = "user:write"
+	PermReadAsset    = "asset:read"
+	PermWriteAsset   = "asset:write"
+	PermReadTicket   = "ticket:read"
+	PermReviewTicket = "ticket:review"
+	// read the logs, the commands and the replays
+	PermAudit = "audit"
+	// list, monitor, join and kill live sessions
+	PermSession = "session"
+	// api tokens, secrets and config
+	PermSystem = "system"
+)
+
+var rolePermissions = map[string][]string{
+	RoleAdmin: {PermReadUser, PermWriteUser, PermReadAsset, PermWriteAsset, PermReadTicket, PermReviewTicket,
+		PermAudit, PermSession, PermSystem},
+	RoleUserAdmin:  {PermReadUser, PermWriteUser, PermReadAsset},
+	RoleAssetAdmin: {PermReadUser, PermReadAsset, PermWriteAsset},
+	RoleReviewer:   {PermReadTicket, PermReviewTicket},
+	RoleAuditor:    {PermAudit},
+	RoleUser:       {},
+}
+
+// Roles returns all roles, the super admin first
+func Roles() []string {
+	return []string{RoleAdmin, RoleUserAdmin, RoleAssetAdmin, RoleReviewer, RoleAuditor, RoleUser}
+}
+
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdminRole reports whether the role has any permission of the admin shell
+func IsAdminRole(role string) bool {
+	return len(rolePermissions[role]) > 0
+}
@@ -0,0 +1,25 @@
+package model
+
+// AssetSecret is the secret of a system user on an asset, which differs from the secret
+// of the system user after a rotation.
+type AssetSecret struct {
+	SysUserID  string `json:"system_user_id"`
+	AssetID    string `json:"asset_id"`
+	Password   string `json:"-"`
+	PrivateKey string `json:"-"`
+	// the new password while it is being applied, it's kept if the asset may be left with it
+	PendingPassword string `json:"-"`
+	UpdateDate      string `json:"update_date"`
+}
+
+// RotationLog is the result of rotating the secret of a system user on an asset
+type RotationLog struct {
+	Datetime    string `json:"datetime"`
+	SysUserID   string `json:"system_user_id"`
+	SysUsername string `json:"system_username"`
+	AssetID     string `json:"asset_id"`
+	Asset       string `json:"asset"`
+	Operator    string `json:"operator"`
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+}
@@ -14,12 +14,21 @@ type SystemUser struct {
 	Comment    string `json:"comment"`
 	Password   string `json:"-"`
 	PrivateKey string `json:"-"`
+	Shell      string `json:"shell"`
+	Sudo       string `json:"sudo"`
+	RotateDays int    `json:"rotate_days"`
+	RotatedAt  int64  `json:"rotated_at"`
 }
 
 func (s *SystemUser) String() string {
 	return fmt.Sprint(s.Username)
 }
 
+// IsRotateDue reports whether the secrets of the system user are due to rotate at now
+func (s *SystemUser) IsRotateDue(now int64) bool {
+	return s.RotateDays > 0 && now >= s.RotatedAt+int64(s.RotateDays)*86400
+}
+
 func (s *SystemUser) IsProtocol(p string) bool {
 	return strings.EqualFold(s.Protocol, p)
 }
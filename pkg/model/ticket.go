@@ -1,8 +1,10 @@
 package model
 
 type TicketState struct {
-	Approver string `json:"approver,omitempty"`
-	State    string `json:"state"`
+	Approver string       `json:"approver,omitempty"`
+	State    string       `json:"state"`
+	Step     int          `json:"step"`
+	Steps    []TicketStep `json:"steps,omitempty"`
 }
 
 const (
@@ -10,21 +12,56 @@ const (
 	TicketApproved = "approved"
 	TicketRejected = "rejected"
 	TicketClosed   = "closed"
+	TicketExpired  = "expired"
 )
 
 type AssetLoginTicketInfo struct {
-	TicketId    string   `json:"ticket_id"`
-	NeedConfirm bool     `json:"need_confirm"`
-	Reviewers   []string `json:"reviewers"`
+	TicketId    string       `json:"ticket_id"`
+	NeedConfirm bool         `json:"need_confirm"`
+	Reviewers   []string     `json:"reviewers"`
+	Steps       []TicketStep `json:"steps,omitempty"`
+	// the unix time when the pending ticket expires, 0 never expires
+	ExpireAt int64 `json:"expire_at"`
+	// the unix time until when the user logins by the approved ticket without a new one
+	ValidUntil int64 `json:"valid_until,omitempty"`
+}
+
+type TicketApproval struct {
+	Approver string `json:"approver"`
+	Date     string `json:"date"`
+	// the seconds of the time window granted by the approver
+	Window int64 `json:"window,omitempty"`
+}
+
+// TicketStep is the step of the review flow when the ticket is created, the reviewers are usernames
+type TicketStep struct {
+	Reviewers []string         `json:"reviewers"`
+	Required  int              `json:"required"`
+	Approvals []TicketApproval `json:"approvals"`
+}
+
+func (s *TicketStep) IsApproved() bool {
+	return len(s.Approvals) >= s.Required
 }
 
 type LoginTicket struct {
-	TicketId        string
-	State           string
-	Approver        string
-	ApplicationDate string
-	ApproveDate     string
-	Username        string
-	AssetName       string
-	SysUsername     string
+	TicketId        string `json:"ticket_id"`
+	State           string `json:"state"`
+	Approver        string `json:"approver"`
+	ApplicationDate string `json:"application_date"`
+	ApproveDate     string `json:"approve_date"`
+	Username        string `json:"username"`
+	AssetName       string `json:"asset_name"`
+	SysUsername     string `json:"system_username"`
+	Command         string `json:"command,omitempty"`
+	// the steps of the review flow, the tickets created before the flows have none
+	Steps []TicketStep `json:"steps,omitempty"`
+	// the index of the step under review
+	Step     int    `json:"step"`
+	Reason   string `json:"reason,omitempty"`
+	ChangeID string `json:"change_id,omitempty"`
+	// the unix time when the pending ticket expires, 0 never expires
+	ExpireAt int64 `json:"expire_at"`
+	// the login tickets approved with a time window are reused until the unix time
+	ValidUntil int64 `json:"valid_until,omitempty"`
 }
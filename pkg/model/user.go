@@ -2,16 +2,37 @@ package model
 
 import "fmt"
 
+const (
+	OTPLevelNone = iota
+	// one-time password generated by admin instead of the password
+	OTPLevelOnce
+	// time-based one-time password after the password or public key
+	OTPLevelTOTP
+)
+
+// Roles of users, see rolePermissions for the permissions of each role
+const (
+	// the super admin
+	RoleAdmin      = "admin"
+	RoleUserAdmin  = "user_admin"
+	RoleAssetAdmin = "asset_admin"
+	RoleReviewer   = "reviewer"
+	RoleAuditor    = "auditor"
+	RoleUser       = "user"
+)
+
 // USER TABLE
 type User struct {
-	ID            string `json:"id"`
-	Username      string `json:"name"`
-	Role          string `json:"role"`
-	ExpireAt      int64
-	OTPLevel      int  `json:"otp_level"`
-	IsActive      bool `json:"is_active"`
-	NodeIDs       []string
-	AddrWhiteList []string
+	ID            string   `json:"id"`
+	Username      string   `json:"name"`
+	Role          string   `json:"role"`
+	ExpireAt      int64    `json:"expire_at"`
+	OTPLevel      int      `json:"otp_level"`
+	IsActive      bool     `json:"is_active"`
+	NodeIDs       []string `json:"node_ids"`
+	AddrWhiteList []string `json:"addr_white_list"`
+	// days to keep the replays of the user, 0 follows the nodes or REPLAY_KEEP_DAYS, -1 keeps them forever
+	ReplayKeepDays int `json:"replay_keep_days"`
 }
 
 func (u *User) String() string {
@@ -23,4 +44,7 @@ type UserSecret struct {
 	Password       string
 	PrivateKey     string
 	AuthorizedKeys []string
+	TOTPSecret     string
+	// the time step of the last accepted TOTP code, a code can only be used once
+	TOTPCounter int64
 }
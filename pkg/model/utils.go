@@ -9,4 +9,13 @@ const (
 	UserlogType
 	LoginTicketType
 	UserSecretType
+	AssetHostKeyType
+	APITokenType
+	CommandFilterType
+	CommandLogType
+	GatewayType
+	AssetSecretType
+	RotationLogType
+	AssetHealthType
+	ReviewFlowType
 )
@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+
+	// the rule of all the security events
+	allEvents = "*"
+
+	queueSize   = 100
+	sendTimeout = 10 * time.Second
+)
+
+// retryInterval is the wait before the first retry, it's shortened by the tests
+var retryInterval = 2 * time.Second
+
+// Notifier sends the event to a channel outside of the process
+type Notifier interface {
+	Channel() string
+	Send(p *Payload) error
+}
+
+// Payload is the JSON body of the webhook and the content of the email. The ID is kept
+// across the retries, so the receivers can drop the duplicates.
+type Payload struct {
+	ID      string    `json:"id"`
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	Asset   string    `json:"asset,omitempty"`
+	Message string    `json:"message"`
+	Ticket  *Ticket   `json:"ticket,omitempty"`
+}
+
+type Ticket struct {
+	ID         string `json:"id"`
+	SystemUser string `json:"system_user"`
+	Command    string `json:"command,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	ChangeID   string `json:"change_id,omitempty"`
+	ExpireAt   int64  `json:"expire_at,omitempty"`
+}
+
+func newPayload(e core.Event) *Payload {
+	p := &Payload{
+		ID:      uuid.NewV4().String(),
+		Event:   e.Type,
+		Time:    e.Time,
+		User:    e.User,
+		Asset:   e.Asset,
+		Message: e.Message,
+	}
+	if t := e.Ticket; t != nil {
+		p.Ticket = &Ticket{
+			ID:         t.TicketId,
+			SystemUser: t.SysUsername,
+			Command:    t.Command,
+			Reason:     t.Reason,
+			ChangeID:   t.ChangeID,
+			ExpireAt:   t.ExpireAt,
+		}
+	}
+	return p
+}
+
+// permanentError is the failure which is not retried, such as a request refused by the receiver
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// newNotifiers returns the notifiers of the channels which are configured
+func newNotifiers(conf config.Config) (map[string]Notifier, error) {
+	res := make(map[string]Notifier, 2)
+	if conf.NotifyWebhookURL != "" {
+		w, err := NewWebhook(WebhookConfig{URL: conf.NotifyWebhookURL, Secret: conf.NotifyWebhookSecret})
+		if err != nil {
+			return nil, err
+		}
+		res[ChannelWebhook] = w
+	}
+	if conf.NotifySMTPAddr != "" {
+		m, err := NewMailer(SMTPConfig{
+			Addr:     conf.NotifySMTPAddr,
+			User:     conf.NotifySMTPUser,
+			Password: conf.NotifySMTPPassword,
+			From:     conf.NotifySMTPFrom,
+			To:       conf.NotifySMTPTo,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res[ChannelEmail] = m
+	}
+	return res, nil
+}
+
+// parseRules returns the channels of the events, the channels of * are added to every security event
+func parseRules(rules map[string][]string, notifiers map[string]Notifier) (map[string][]string, error) {
+	events := core.SecurityEvents()
+	res := make(map[string][]string, len(events))
+	for event, channels := range rules {
+		targets := []string{event}
+		if event == allEvents {
+			targets = events
+		} else if !containString(events, event) {
+			return nil, fmt.Errorf("unknown event %s", event)
+		}
+		for _, ch := range channels {
+			if _, ok := notifiers[ch]; !ok {
+				return nil, fmt.Errorf("channel %s of the event %s is not configured", ch, event)
+			}
+			for _, t := range targets {
+				if !containString(res[t], ch) {
+					res[t] = append(res[t], ch)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// Run sends the security events to the channels by NOTIFY_RULES, each channel has a queue so a slow
+// receiver doesn't delay the others. It returns at once if no rule is set.
+func Run(c *core.Core) {
+	conf := config.GetConf()
+	if len(conf.NotifyRules) == 0 {
+		return
+	}
+	notifiers, err := newNotifiers(conf)
+	if err != nil {
+		log.Error.Printf("Start notification failed: %s", err)
+		return
+	}
+	routes, err := parseRules(conf.NotifyRules, notifiers)
+	if err != nil {
+		log.Error.Printf("Invalid NOTIFY_RULES: %s", err)
+		return
+	}
+	types := make([]string, 0, len(routes))
+	queues := make(map[string]chan *Payload, len(notifiers))
+	for event, channels := range routes {
+		types = append(types, event)
+		for _, ch := range channels {
+			if _, ok := queues[ch]; ok {
+				continue
+			}
+			queue := make(chan *Payload, queueSize)
+			queues[ch] = queue
+			go sendLoop(notifiers[ch], queue, conf.NotifyRetry)
+		}
+	}
+	sort.Strings(types)
+	log.Info.Printf("Send the events %v to the notification channels", types)
+	events, cancel := c.Subscribe(types...)
+	defer cancel()
+	for e := range events {
+		p := newPayload(e)
+		for _, ch := range routes[e.Type] {
+			select {
+			case queues[ch] <- p:
+			default:
+				log.Error.Printf("Drop the %s notification of the event %s, the queue is full", ch, e.Type)
+			}
+		}
+	}
+}
+
+func sendLoop(n Notifier, queue <-chan *Payload, retry int) {
+	for p := range queue {
+		send(n, p, retry)
+	}
+}
+
+// send retries the failed delivery with the doubled interval
+func send(n Notifier, p *Payload, retry int) {
+	wait := retryInterval
+	for i := 0; ; i++ {
+		err := n.Send(p)
+		if err == nil {
+			log.Debug.Printf("Send the event %s(%s) to %s", p.Event, p.ID, n.Channel())
+			return
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || i >= retry {
+			log.Error.Printf("Send the event %s(%s) to %s failed: %s", p.Event, p.ID, n.Channel(), err)
+			return
+		}
+		log.Warning.Printf("Send the event %s(%s) to %s failed: %s, retry in %s", p.Event, p.ID,
+			n.Channel(), err, wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func containString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+)
+
+type SMTPConfig struct {
+	// host:port, STARTTLS is used if the server supports it
+	Addr     string
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// Mailer sends the events in plain text emails
+type Mailer struct {
+	conf SMTPConfig
+	host string
+}
+
+func NewMailer(conf SMTPConfig) (*Mailer, error) {
+	host, _, err := net.SplitHostPort(conf.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address %s", conf.Addr)
+	}
+	if conf.From == "" || len(conf.To) == 0 {
+		return nil, errors.New("the sender and the recipients of emails are required")
+	}
+	return &Mailer{conf: conf, host: host}, nil
+}
+
+func (m *Mailer) Channel() string {
+	return ChannelEmail
+}
+
+func (m *Mailer) Send(p *Payload) error {
+	err := m.send(p)
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return &permanentError{err}
+	}
+	return err
+}
+
+func (m *Mailer) send(p *Payload) error {
+	conn, err := net.DialTimeout("tcp", m.conf.Addr, sendTimeout)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(sendTimeout))
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.conf.User != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.conf.User, m.conf.Password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(m.conf.From); err != nil {
+		return err
+	}
+	for _, to := range m.conf.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(m.message(p)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+var headerReplacer = strings.NewReplacer("\r", "", "\n", " ")
+
+func (m *Mailer) message(p *Payload) []byte {
+	subject := fmt.Sprintf("[gojump] %s", p.Event)
+	if p.User != "" {
+		subject += " " + p.User
+	}
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headerReplacer.Replace(v))
+	}
+	header("From", m.conf.From)
+	header("To", strings.Join(m.conf.To, ", "))
+	header("Subject", subject)
+	header("Date", p.Time.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@gojump>", p.ID))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	buf.WriteString("\r\n")
+	line := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, headerReplacer.Replace(v))
+		}
+	}
+	line("Event", p.Event)
+	line("Time", p.Time.Format(common.LogFormat))
+	line("User", p.User)
+	line("Asset", p.Asset)
+	line("Message", p.Message)
+	if t := p.Ticket; t != nil {
+		line("Ticket", t.ID)
+		line("System user", t.SystemUser)
+		line("Command", t.Command)
+		line("Reason", t.Reason)
+		line("Change ID", t.ChangeID)
+		if t.ExpireAt > 0 {
+			line("Expire at", time.Unix(t.ExpireAt, 0).Format(common.LogFormat))
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts the mails without TLS or auth, the replies of the commands can be replaced
+type fakeSMTP struct {
+	ln      net.Listener
+	replies map[string]string
+
+	lock     sync.Mutex
+	conns    int
+	messages [][]byte
+}
+
+func newFakeSMTP(t *testing.T, replies map[string]string) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, replies: replies}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	s.lock.Lock()
+	s.conns++
+	s.lock.Unlock()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		if reply, ok := s.replies[cmd]; ok {
+			_ = tp.PrintfLine("%s", reply)
+			continue
+		}
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-fake")
+			_ = tp.PrintfLine("250 8BITMIME")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			msg, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.messages = append(s.messages, msg)
+			s.lock.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeSMTP) stats() (int, [][]byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.conns, s.messages
+}
+
+func newTestMailer(t *testing.T, addr string) *Mailer {
+	m, err := NewMailer(SMTPConfig{
+		Addr: addr,
+		From: "gojump@example.com",
+		To:   []string{"ops@example.com", "sec@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMailerMessage(t *testing.T) {
+	srv := newFakeSMTP(t, nil)
+	m := newTestMailer(t, srv.addr())
+	p := testPayload()
+	p.Message = "line one\r\nline two"
+	if err := m.Send(p); err != nil {
+		t.Fatal(err)
+	}
+	_, messages := srv.stats()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages are received, want 1", len(messages))
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(messages[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"From":         "gojump@example.com",
+		"To":           "ops@example.com, sec@example.com",
+		"Subject":      "[gojump] login_blocked rick",
+		"Message-Id":   "<" + p.ID + "@gojump>",
+		"Mime-Version": "1.0",
+		"Content-Type": "text/plain; charset=UTF-8",
+	}
+	for k, want := range headers {
+		if got := msg.Header.Get(k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !date.Equal(p.Time) {
+		t.Errorf("date = %s, want %s", date, p.Time)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the line endings are read as \n by the server
+	for _, want := range []string{"Event: login_blocked\n", "User: rick\n", "Asset: localhost1\n",
+		"Message: line one line two\n"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body %q doesn't contain %q", body, want)
+		}
+	}
+}
+
+func TestMailerPermanentError(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	srv := newFakeSMTP(t, map[string]string{"RCPT": "550 5.1.1 no such user"})
+	m := newTestMailer(t, srv.addr())
+	err := m.Send(testPayload())
+	var perm *permanentError
+	if !errors.As(err, &perm) {
+		t.Fatalf("error = %v, want permanent", err)
+	}
+	send(m, testPayload(), 3)
+	if conns, messages := srv.stats(); conns != 2 || len(messages) != 0 {
+		t.Errorf("connections = %d, messages = %d, want 2 and 0", conns, len(messages))
+	}
+}
+
+func TestMailerTemporaryError(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	srv := newFakeSMTP(t, map[string]string{"MAIL": "451 4.3.0 try again later"})
+	m := newTestMailer(t, srv.addr())
+	err := m.Send(testPayload())
+	var perm *permanentError
+	if err == nil || errors.As(err, &perm) {
+		t.Fatalf("error = %v, want temporary", err)
+	}
+	send(m, testPayload(), 2)
+	if conns, _ := srv.stats(); conns != 4 {
+		t.Errorf("connections = %d, want 4", conns)
+	}
+}
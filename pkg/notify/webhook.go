@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	HeaderEvent     = "X-Gojump-Event"
+	HeaderDelivery  = "X-Gojump-Delivery"
+	HeaderSignature = "X-Gojump-Signature"
+)
+
+type WebhookConfig struct {
+	URL string
+	// the body is signed if the secret is set
+	Secret string
+}
+
+// Webhook posts the events in JSON. The signature header is sha256= with the hex HMAC-SHA256 of the body.
+type Webhook struct {
+	conf   WebhookConfig
+	client *http.Client
+}
+
+func NewWebhook(conf WebhookConfig) (*Webhook, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %s", conf.URL)
+	}
+	return &Webhook{conf: conf, client: &http.Client{Timeout: sendTimeout}}, nil
+}
+
+func (w *Webhook) Channel() string {
+	return ChannelWebhook
+}
+
+func (w *Webhook) Send(p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return &permanentError{err}
+	}
+	req, err := http.NewRequest(http.MethodPost, w.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gojump")
+	req.Header.Set(HeaderEvent, p.Event)
+	req.Header.Set(HeaderDelivery, p.ID)
+	if w.conf.Secret != "" {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(w.conf.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responds %s", resp.Status)
+	}
+	return &permanentError{errors.New("webhook responds " + resp.Status)}
+}
+
+// Sign returns the hex HMAC-SHA256 of the body, which the receivers compare with the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
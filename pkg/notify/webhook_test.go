@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPayload() *Payload {
+	return &Payload{
+		ID:      "7d2e4c1a-0d1f-4b8e-9a55-3f0c2b6d8e01",
+		Event:   "login_blocked",
+		Time:    time.Date(2026, 10, 17, 10, 20, 30, 0, time.UTC),
+		User:    "rick",
+		Asset:   "localhost1",
+		Message: "too many failed logins",
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{URL: srv.URL, Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := testPayload()
+	if err = w.Send(p); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if got, want := header.Get(HeaderSignature), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if got := header.Get(HeaderEvent); got != p.Event {
+		t.Errorf("event header = %q, want %q", got, p.Event)
+	}
+	if got := header.Get(HeaderDelivery); got != p.ID {
+		t.Errorf("delivery header = %q, want %q", got, p.ID)
+	}
+	var res Payload
+	if err = json.Unmarshal(body, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != p.ID || res.User != p.User || res.Message != p.Message {
+		t.Errorf("body = %+v, want %+v", res, *p)
+	}
+
+	// the body is not signed without the secret
+	w, err = NewWebhook(WebhookConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Send(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(HeaderSignature); got != "" {
+		t.Errorf("signature = %q without secret", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int
+		retry    int
+		requests int32
+	}{
+		{"ok", []int{http.StatusNoContent}, 3, 1},
+		{"server error", []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK}, 3, 3},
+		{"too many requests", []int{http.StatusTooManyRequests, http.StatusOK}, 3, 2},
+		{"retries exhausted", []int{http.StatusServiceUnavailable}, 2, 3},
+		{"bad request", []int{http.StatusBadRequest}, 3, 1},
+		{"not found", []int{http.StatusNotFound}, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&requests, 1)) - 1
+				if i >= len(tt.statuses) {
+					i = len(tt.statuses) - 1
+				}
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer srv.Close()
+
+			w, err := NewWebhook(WebhookConfig{URL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			send(w, testPayload(), tt.retry)
+			if got := atomic.LoadInt32(&requests); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestWebhookPermanentError(t *testing.T) {
+	for status, permanent := range map[int]bool{
+		http.StatusBadRequest:          true,
+		http.StatusUnauthorized:        true,
+		http.StatusTooManyRequests:     false,
+		http.StatusInternalServerError: false,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		w, err := NewWebhook(WebhookConfig{URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Send(testPayload())
+		srv.Close()
+		var perm *permanentError
+		if err == nil || errors.As(err, &perm) != permanent {
+			t.Errorf("status %d: error = %v, want permanent %t", status, err, permanent)
+		}
+	}
+}
+
+func TestNewWebhookInvalidURL(t *testing.T) {
+	for _, u := range []string{"", "example.com/hook", "ftp://example.com/hook", "http://"} {
+		if _, err := NewWebhook(WebhookConfig{URL: u}); err == nil {
+			t.Errorf("url %q is accepted", u)
+		}
+	}
+}
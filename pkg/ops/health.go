@@ -0,0 +1,123 @@
+package ops
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/srvconn"
+)
+
+const (
+	healthCheckWorkers = 10
+	// the host keys pinned by the checks are recorded on behalf of it
+	healthChecker = "checker"
+)
+
+// CheckAsset connects the SSH port of the asset through its gateways, then logs in as each system
+// user granted on it. The result is stored as the health of the asset.
+func CheckAsset(c *core.Core, asset *model.Asset) model.AssetHealth {
+	h := model.AssetHealth{AssetID: asset.ID}
+	h.Message = checkAsset(c, asset, &h)
+	if err := c.SaveAssetHealth(&h); err != nil {
+		log.Error.Printf("Save health of asset %s failed: %s", asset.String(), err)
+	}
+	return h
+}
+
+func checkAsset(c *core.Core, asset *model.Asset, h *model.AssetHealth) string {
+	gateways, err := AssetGateways(c, healthChecker, asset)
+	if err != nil {
+		return err.Error()
+	}
+	addr := net.JoinHostPort(asset.IP, strconv.Itoa(asset.ProtocolPort(model.ProtocolSSH)))
+	start := time.Now()
+	conn, err := srvconn.DialGateway(addr, config.GlobalConfig.SSHTimeout, gateways...)
+	if err != nil {
+		return err.Error()
+	}
+	h.Latency = time.Since(start).Milliseconds()
+	h.Reachable = true
+	_ = conn.Close()
+
+	sysUsers, err := c.GetAssetSystemUsers(asset.ID)
+	if err != nil {
+		return err.Error()
+	}
+	failed := make([]string, 0, len(sysUsers))
+	for i := range sysUsers {
+		if err = c.ApplyAssetSecret(asset.ID, &sysUsers[i]); err == nil {
+			var client *srvconn.SSHClient
+			if client, err = DialAsset(c, healthChecker, asset, &sysUsers[i]); err == nil {
+				_ = client.Close()
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", sysUsers[i].Username, err))
+		}
+	}
+	h.AuthOK = len(failed) == 0
+	if len(sysUsers) == 0 {
+		return "no system user is granted"
+	}
+	return strings.Join(failed, "; ")
+}
+
+// CheckAssets checks the assets concurrently
+func CheckAssets(c *core.Core, assets []model.Asset) []model.AssetHealth {
+	res := make([]model.AssetHealth, len(assets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < healthCheckWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res[i] = CheckAsset(c, &assets[i])
+			}
+		}()
+	}
+	for i := range assets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return res
+}
+
+// RunHealthCheck checks the active assets every ASSET_CHECK_INTERVAL minutes
+func RunHealthCheck(c *core.Core) {
+	interval := config.GlobalConfig.AssetCheckInterval
+	if interval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(interval) * time.Minute)
+		assets, err := c.GetAllAssets()
+		if err != nil {
+			log.Error.Printf("Get assets to check failed: %s", err)
+			continue
+		}
+		active := make([]model.Asset, 0, len(assets))
+		for _, a := range assets {
+			if a.IsActive {
+				active = append(active, a)
+			}
+		}
+		healths := CheckAssets(c, active)
+		down := 0
+		for i := range healths {
+			if healths[i].Status() != model.HealthOK {
+				down++
+			}
+		}
+		log.Info.Printf("Check %d assets, %d are unhealthy", len(healths), down)
+	}
+}
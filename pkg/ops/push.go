@@ -0,0 +1,140 @@
+package ops
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const defaultPushShell = "/bin/bash"
+
+// the account names accepted by useradd, which are safe in the name of the sudoers file
+var pushUsernamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+// PushResult is the result of pushing the system user to an asset
+type PushResult struct {
+	Asset model.Asset
+	Err   error
+}
+
+// PushSystemUser creates the account of the system user on the assets by the privileged system user
+// adminSysUserID. It sets the shell, authorizes the public key of the private key, or sets the password
+// if there is no private key, as the password is the passphrase of the key. The sudoers entry of Sudo
+// is written, or removed if Sudo is empty.
+func PushSystemUser(c *core.Core, sysUserID string, adminSysUserID string, assets []model.Asset,
+	operator string) ([]PushResult, error) {
+	sys, err := c.GetSystemUserById(sysUserID)
+	if err != nil {
+		return nil, err
+	}
+	if !pushUsernamePattern.MatchString(sys.Username) {
+		return nil, fmt.Errorf("invalid account name %s", sys.Username)
+	}
+	privileged, err := c.GetSystemUserById(adminSysUserID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PushResult, 0, len(assets))
+	failed := 0
+	for i := range assets {
+		err = pushAsset(c, &sys, &privileged, &assets[i], operator)
+		if err != nil {
+			failed++
+			log.Error.Printf("Push system user %s to %s failed: %s", sys.Username, assets[i].String(), err)
+		} else {
+			log.Info.Printf("Push system user %s to %s", sys.Username, assets[i].String())
+		}
+		res = append(res, PushResult{Asset: assets[i], Err: err})
+	}
+	c.InsertLog("push", operator, fmt.Sprintf("push system user %s(%s) by %s(%s), %d succeeded, %d failed",
+		sys.Username, sys.ID, privileged.Username, privileged.ID, len(assets)-failed, failed))
+	return res, nil
+}
+
+func pushAsset(c *core.Core, sys *model.SystemUser, privileged *model.SystemUser, asset *model.Asset,
+	operator string) error {
+	// the secrets rotated on the asset are pushed
+	target := *sys
+	if err := c.ApplyAssetSecret(asset.ID, &target); err != nil {
+		return err
+	}
+	script, err := pushScript(&target)
+	if err != nil {
+		return err
+	}
+	loginUser := *privileged
+	if err = c.ApplyAssetSecret(asset.ID, &loginUser); err != nil {
+		return err
+	}
+	client, err := DialAsset(c, operator, asset, &loginUser)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	command := "sh -s"
+	if loginUser.Username != "root" {
+		command = "sudo -n sh -s"
+	}
+	_, err = runCommand(client, command, script)
+	return err
+}
+
+// pushScript returns the shell script to create the account, which is passed by stdin
+// so that the password is not in the command line.
+func pushScript(sys *model.SystemUser) (string, error) {
+	password, err := common.DecryptSecret(sys.Password)
+	if err != nil {
+		return "", err
+	}
+	privateKey, err := common.DecryptSecret(sys.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	shell := sys.Shell
+	if shell == "" {
+		shell = defaultPushShell
+	}
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	fmt.Fprintf(&b, "u=%s\n", shellQuote(sys.Username))
+	fmt.Fprintf(&b, "if id \"$u\" >/dev/null 2>&1; then usermod -s %[1]s \"$u\"; else useradd -m -s %[1]s \"$u\"; fi\n",
+		shellQuote(shell))
+	if password != "" && privateKey == "" {
+		fmt.Fprintf(&b, "echo %s | chpasswd\n", shellQuote(sys.Username+":"+password))
+	}
+	if privateKey != "" {
+		signer, err := gossh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(password))
+		if err != nil {
+			if signer, err = gossh.ParsePrivateKey([]byte(privateKey)); err != nil {
+				return "", fmt.Errorf("parse private key failed: %s", err)
+			}
+		}
+		pub := signer.PublicKey()
+		b.WriteString("h=$(getent passwd \"$u\" | cut -d: -f6)\n")
+		b.WriteString("mkdir -p \"$h/.ssh\" && touch \"$h/.ssh/authorized_keys\"\n")
+		fmt.Fprintf(&b, "grep -qF %s \"$h/.ssh/authorized_keys\" || echo %s >> \"$h/.ssh/authorized_keys\"\n",
+			shellQuote(keyBlob(pub)), shellQuote(fmt.Sprintf("%s %s gojump", pub.Type(), keyBlob(pub))))
+		b.WriteString("chmod 700 \"$h/.ssh\" && chmod 600 \"$h/.ssh/authorized_keys\"\n")
+		b.WriteString("chown -R \"$u\" \"$h/.ssh\"\n")
+	}
+	sudoers := "/etc/sudoers.d/gojump-" + strings.TrimSuffix(sys.Username, "$")
+	if sys.Sudo == "" {
+		fmt.Fprintf(&b, "rm -f %s\n", sudoers)
+		return b.String(), nil
+	}
+	fmt.Fprintf(&b, "echo %s > %s.tmp\n", shellQuote(fmt.Sprintf("%s ALL=(ALL) NOPASSWD: %s", sys.Username, sys.Sudo)),
+		sudoers)
+	fmt.Fprintf(&b, "chmod 440 %[1]s.tmp\nif visudo -cf %[1]s.tmp >/dev/null; then mv %[1]s.tmp %[1]s; else rm -f %[1]s.tmp; echo invalid sudo entry >&2; exit 1; fi\n",
+		sudoers)
+	return b.String(), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,253 @@
+package ops
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/srvconn"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	rotatePasswordLen    = 24
+	rotatePasswordLetter = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+	rotationCheckInterval = time.Hour
+
+	// the authorized keys file is rewritten without the lines of the key
+	removeKeyCommand = `f=~/.ssh/authorized_keys; grep -vF '%s' "$f" > "$f.gojump"; cat "$f.gojump" > "$f" && rm -f "$f.gojump"`
+	addKeyCommand    = `umask 077 && mkdir -p ~/.ssh && echo '%s' >> ~/.ssh/authorized_keys`
+)
+
+// rotating holds the IDs of the system users in rotation, so that a system user is rotated once at a time
+var rotating sync.Map
+
+// RotateSystemUser rotates the secret of the system user on every active asset it is granted on.
+// The private key is rotated if the system user has one, or else the password. The new secret is
+// stored for an asset only after it logs in to the asset, the failed assets keep the old secret.
+// It returns the numbers of the succeeded and the failed assets.
+func RotateSystemUser(c *core.Core, sysUserID string, operator string) (int, int, error) {
+	if _, ok := rotating.LoadOrStore(sysUserID, true); ok {
+		return 0, 0, fmt.Errorf("system user %s is in rotation", sysUserID)
+	}
+	defer rotating.Delete(sysUserID)
+	sys, err := c.GetSystemUserById(sysUserID)
+	if err != nil {
+		return 0, 0, err
+	}
+	assets, err := c.GetRotationAssets(sys.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+	succeeded, failed := 0, 0
+	for i := range assets {
+		l := model.RotationLog{
+			SysUserID:   sys.ID,
+			SysUsername: sys.Username,
+			AssetID:     assets[i].ID,
+			Asset:       assets[i].String(),
+			Operator:    operator,
+		}
+		msg, err := rotateAsset(c, &sys, &assets[i], operator)
+		if err != nil {
+			failed++
+			l.Message = err.Error()
+			log.Error.Printf("Rotate secret of system user %s on %s failed: %s", sys.Username, assets[i].String(), err)
+		} else {
+			succeeded++
+			l.Success = true
+			l.Message = msg
+			log.Info.Printf("Rotate secret of system user %s on %s", sys.Username, assets[i].String())
+		}
+		c.InsertRotationLog(&l)
+	}
+	if err = c.FinishRotation(&sys, operator, succeeded, failed); err != nil {
+		return succeeded, failed, err
+	}
+	return succeeded, failed, nil
+}
+
+// RunRotation rotates the secrets of the system users when they are due
+func RunRotation(c *core.Core) {
+	for {
+		time.Sleep(rotationCheckInterval)
+		sys, err := c.GetRotateDueSystemUsers(time.Now())
+		if err != nil {
+			log.Error.Printf("Get system users to rotate failed: %s", err)
+			continue
+		}
+		for _, v := range sys {
+			succeeded, failed, err := RotateSystemUser(c, v.ID, "schedule")
+			if err != nil {
+				log.Error.Printf("Rotate secret of system user %s failed: %s", v.Username, err)
+				continue
+			}
+			log.Info.Printf("Rotate secret of system user %s, %d succeeded, %d failed", v.Username, succeeded, failed)
+		}
+	}
+}
+
+// rotateAsset applies a new secret on the asset and verifies it, the old secret is restored
+// if the new one fails to login. It returns the warning which does not fail the rotation.
+func rotateAsset(c *core.Core, sys *model.SystemUser, asset *model.Asset, operator string) (string, error) {
+	cur := *sys
+	if err := c.ApplyAssetSecret(asset.ID, &cur); err != nil {
+		return "", err
+	}
+	password, err := common.DecryptSecret(cur.Password)
+	if err != nil {
+		return "", err
+	}
+	privateKey, err := common.DecryptSecret(cur.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	client, err := DialAsset(c, operator, asset, &cur)
+	if err != nil {
+		// the asset may be left with the password of a failed rotation
+		pending, err1 := c.GetPendingAssetSecret(sys.ID, asset.ID)
+		if err1 != nil || pending == "" {
+			return "", err
+		}
+		next := cur
+		next.Password = pending
+		if client, err = DialAsset(c, operator, asset, &next); err != nil {
+			return "", err
+		}
+		log.Warning.Printf("System user %s logs in %s by the pending password", sys.Username, asset.String())
+		if err = c.SaveAssetSecret(sys.ID, asset.ID, pending, privateKey); err != nil {
+			_ = client.Close()
+			return "", fmt.Errorf("store pending password failed: %s", err)
+		}
+		password = pending
+	}
+	defer client.Close()
+	if privateKey != "" {
+		return rotatePrivateKey(c, client, &cur, asset, operator, password, privateKey)
+	}
+	return "", rotatePassword(c, client, &cur, asset, operator, password)
+}
+
+func rotatePassword(c *core.Core, client *srvconn.SSHClient, cur *model.SystemUser, asset *model.Asset,
+	operator string, oldPassword string) error {
+	newPassword, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	if err = c.SetPendingAssetSecret(cur, asset.ID, newPassword); err != nil {
+		return fmt.Errorf("store pending password failed: %s", err)
+	}
+	if err = changePassword(client, cur.Username, newPassword); err != nil {
+		clearPendingSecret(c, cur, asset)
+		return fmt.Errorf("change password failed: %s", err)
+	}
+	next := *cur
+	next.Password = newPassword
+	if err = verifySecret(c, operator, asset, &next); err != nil {
+		if err1 := changePassword(client, cur.Username, oldPassword); err1 != nil {
+			return fmt.Errorf("verify new password failed: %s, restore old password failed: %s, %s",
+				err, err1, pendingSecretMsg)
+		}
+		clearPendingSecret(c, cur, asset)
+		return fmt.Errorf("verify new password failed: %s", err)
+	}
+	if err = c.SaveAssetSecret(cur.ID, asset.ID, newPassword, ""); err != nil {
+		return fmt.Errorf("store new password failed: %s, %s", err, pendingSecretMsg)
+	}
+	return nil
+}
+
+const pendingSecretMsg = "the new password is kept as pending and tried by the next rotation"
+
+func clearPendingSecret(c *core.Core, sys *model.SystemUser, asset *model.Asset) {
+	if err := c.ClearPendingAssetSecret(sys.ID, asset.ID); err != nil {
+		log.Error.Printf("Clear pending password of system user %s on %s failed: %s", sys.Username, asset.String(), err)
+	}
+}
+
+// changePassword runs chpasswd, by sudo if the system user is not root
+func changePassword(client *srvconn.SSHClient, username string, password string) error {
+	command := "chpasswd"
+	if username != "root" {
+		command = "sudo -n chpasswd"
+	}
+	_, err := runCommand(client, command, fmt.Sprintf("%s:%s\n", username, password))
+	return err
+}
+
+// rotatePrivateKey authorizes a new ed25519 key, and removes the old key after the new one logs in.
+// The password is kept as it is.
+func rotatePrivateKey(c *core.Core, client *srvconn.SSHClient, cur *model.SystemUser, asset *model.Asset,
+	operator string, password string, privateKey string) (string, error) {
+	newKey := common.GenerateEd25519Pem()
+	signer, err := gossh.ParsePrivateKey([]byte(newKey))
+	if err != nil {
+		return "", err
+	}
+	newPub := signer.PublicKey()
+	line := fmt.Sprintf("%s %s gojump", newPub.Type(), keyBlob(newPub))
+	if _, err = runCommand(client, fmt.Sprintf(addKeyCommand, line), ""); err != nil {
+		return "", fmt.Errorf("authorize new key failed: %s", err)
+	}
+	// only the new key logs in while it is verified
+	next := *cur
+	next.Password = ""
+	next.PrivateKey = newKey
+	if err = verifySecret(c, operator, asset, &next); err != nil {
+		if _, err1 := runCommand(client, fmt.Sprintf(removeKeyCommand, keyBlob(newPub)), ""); err1 != nil {
+			return "", fmt.Errorf("verify new key failed: %s, remove new key failed: %s", err, err1)
+		}
+		return "", fmt.Errorf("verify new key failed: %s", err)
+	}
+	if err = c.SaveAssetSecret(cur.ID, asset.ID, password, newKey); err != nil {
+		return "", fmt.Errorf("store new key failed: %s", err)
+	}
+	oldSigner, err := gossh.ParsePrivateKeyWithPassphrase([]byte(privateKey), []byte(password))
+	if err != nil {
+		oldSigner, err = gossh.ParsePrivateKey([]byte(privateKey))
+	}
+	if err != nil {
+		return fmt.Sprintf("old key is not removed: %s", err), nil
+	}
+	if _, err = runCommand(client, fmt.Sprintf(removeKeyCommand, keyBlob(oldSigner.PublicKey())), ""); err != nil {
+		return fmt.Sprintf("old key is not removed: %s", err), nil
+	}
+	return "", nil
+}
+
+func verifySecret(c *core.Core, operator string, asset *model.Asset, sysUser *model.SystemUser) error {
+	client, err := DialAsset(c, operator, asset, sysUser)
+	if err != nil {
+		return err
+	}
+	_, err = runCommand(client, "true", "")
+	_ = client.Close()
+	return err
+}
+
+// keyBlob returns the base64 part of the authorized key line, which matches the key only
+func keyBlob(key gossh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key.Marshal())
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, rotatePasswordLen)
+	size := big.NewInt(int64(len(rotatePasswordLetter)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", errors.New("generate random password failed")
+		}
+		b[i] = rotatePasswordLetter[n.Int64()]
+	}
+	return string(b), nil
+}
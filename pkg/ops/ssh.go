@@ -0,0 +1,62 @@
+// Package ops runs the operations on the assets over SSH, on behalf of the admins or the schedules.
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/srvconn"
+)
+
+// DialAsset logs in to the asset as the system user through the gateways of the asset,
+// the host keys are pinned on behalf of username.
+func DialAsset(c *core.Core, username string, asset *model.Asset, sysUser *model.SystemUser) (*srvconn.SSHClient, error) {
+	gateways, err := AssetGateways(c, username, asset)
+	if err != nil {
+		return nil, err
+	}
+	sshAuthOpts, err := srvconn.BuildSSHClientOptions(asset, sysUser, gateways...)
+	if err != nil {
+		return nil, err
+	}
+	sshAuthOpts = append(sshAuthOpts, srvconn.SSHClientHostKeyCallback(
+		c.AssetHostKeyCallback(asset, username)))
+	sshClient, err := srvconn.NewSSHClient(sshAuthOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("get SSH Client failed: %s", err)
+	}
+	return sshClient, nil
+}
+
+// AssetGateways returns the options of the gateways to reach the asset
+func AssetGateways(c *core.Core, username string, asset *model.Asset) ([]srvconn.SSHClientOptions, error) {
+	routes, err := c.GetAssetGatewayRoutes(asset.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get gateways of asset err: %s", err)
+	}
+	return srvconn.BuildGatewayOptions(routes, c.GatewayHostKeyCallback(username))
+}
+
+// runCommand runs the command with the input, the output is returned in the error if it fails
+func runCommand(client *srvconn.SSHClient, command string, input string) (string, error) {
+	sess, err := client.AcquireSession()
+	if err != nil {
+		return "", fmt.Errorf("get SSH session failed: %s", err)
+	}
+	defer sess.Close()
+	defer client.ReleaseSession(sess)
+	var out bytes.Buffer
+	sess.Stdin = strings.NewReader(input)
+	sess.Stdout = &out
+	sess.Stderr = &out
+	if err = sess.Run(command); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// ChannelSession is a proxied channel without terminal, such as exec, SFTP, SCP and ProxyJump.
+// It's listed in the live sessions and can be killed, but not monitored or joined.
+type ChannelSession struct {
+	ID string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	core *core.Core
+	info *model.Session
+
+	terminateAdmin atomic.Value
+
+	lastActiveTime int64 // unix nano
+}
+
+// StartChannelSession adds the channel to the live sessions, its context is done when the parent is done
+// or it is killed. End must be called when the channel is closed.
+func StartChannelSession(parent context.Context, c *core.Core, info model.Session) *ChannelSession {
+	info.DateStart = time.Now()
+	ctx, cancel := context.WithCancel(parent)
+	s := &ChannelSession{
+		ID:     info.ID,
+		ctx:    ctx,
+		cancel: cancel,
+		core:   c,
+		info:   &info,
+	}
+	if err := c.CreateSession(info); err != nil {
+		log.Error.Printf("Session[%s] create session err: %s", s.ID[:8], err)
+	}
+	sessManager.Add(s.ID, s)
+	return s
+}
+
+// End removes the channel from the live sessions
+func (s *ChannelSession) End() {
+	sessManager.Delete(s.ID)
+	s.core.RemoveSession(s.ID)
+	s.cancel()
+}
+
+func (s *ChannelSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *ChannelSession) Terminate(username string) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+		s.terminateAdmin.Store(username)
+	}
+	s.cancel()
+	log.Info.Printf("Session[%s] receive terminate task from admin %s", s.ID[:8], username)
+}
+
+// TerminateAdmin returns the admin who killed the session, or empty if it's not killed
+func (s *ChannelSession) TerminateAdmin() string {
+	admin, _ := s.terminateAdmin.Load().(string)
+	return admin
+}
+
+func (s *ChannelSession) SessionID() string {
+	return s.ID
+}
+
+// IdleTime returns how long no data is written by the writers of ActiveWriter
+func (s *ChannelSession) IdleTime() time.Duration {
+	last := atomic.LoadInt64(&s.lastActiveTime)
+	if last == 0 {
+		return time.Since(s.info.DateStart)
+	}
+	return time.Since(time.Unix(0, last))
+}
+
+// ActiveWriter wraps w to update the last active time of the session
+func (s *ChannelSession) ActiveWriter(w io.Writer) io.Writer {
+	return &activeWriter{w: w, s: s}
+}
+
+func (s *ChannelSession) sessionInfo() *model.Session {
+	return s.info
+}
+
+func (s *ChannelSession) observerCount() int {
+	return 0
+}
+
+type activeWriter struct {
+	w io.Writer
+	s *ChannelSession
+}
+
+func (a *activeWriter) Write(p []byte) (int, error) {
+	atomic.StoreInt64(&a.s.lastActiveTime, time.Now().UnixNano())
+	return a.w.Write(p)
+}
@@ -0,0 +1,361 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/handewo/gojump/pkg/auth"
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/srvconn"
+)
+
+const (
+	// the Enter is held until the echo of the command arrives, or without rules the command is
+	// recorded when the line of its echo ends
+	echoWaitTimeout = 500 * time.Millisecond
+	echoSettleTime  = 30 * time.Millisecond
+
+	maskedCommand = "(typed without echo)"
+)
+
+type commandRule struct {
+	filter   model.CommandFilter
+	patterns []*regexp.Regexp
+}
+
+func (r *commandRule) match(cmds ...string) bool {
+	for _, re := range r.patterns {
+		for _, cmd := range cmds {
+			if cmd != "" && re.MatchString(cmd) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type confirmResult struct {
+	status   auth.Status
+	approver string
+}
+
+// commandGuard records every command of the session, and checks it against the command filters.
+// It tracks the echo of the input as well, so the replay masks the text typed without echo.
+type commandGuard struct {
+	rules  []commandRule
+	parser commandParser
+	echo   inputEcho
+
+	held     []byte
+	deadline time.Time
+	// without rules the Enter is sent at once, the output after the line of the echo and the input
+	// typed ahead wait until the command is recorded
+	sent      bool
+	echoEnded bool
+	after     []byte
+	queued    []byte
+
+	timer      *time.Timer
+	lastInput  time.Time
+	lastOutput time.Time
+
+	command    string
+	cancel     context.CancelFunc
+	confirmRes chan confirmResult
+}
+
+func (s *Server) newCommandGuard() (*commandGuard, error) {
+	filters, err := s.core.GetSessionCommandFilters(s.connOpts.user.ID, s.connOpts.asset.ID,
+		s.connOpts.systemUser.ID)
+	if err != nil {
+		return nil, err
+	}
+	g := &commandGuard{
+		rules:      make([]commandRule, 0, len(filters)),
+		confirmRes: make(chan confirmResult, 1),
+	}
+	for _, f := range filters {
+		r := commandRule{filter: f}
+		for _, p := range f.Patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s of command filter %s: %w", p, f.ID, err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+		g.rules = append(g.rules, r)
+	}
+	return g, nil
+}
+
+// match returns the filter with the strictest action
+func (g *commandGuard) match(cmds ...string) *model.CommandFilter {
+	var res *model.CommandFilter
+	for i := range g.rules {
+		r := &g.rules[i]
+		if res != nil && model.FilterActionLevel(r.filter.Action) <= model.FilterActionLevel(res.Action) {
+			continue
+		}
+		if r.match(cmds...) {
+			res = &r.filter
+		}
+	}
+	return res
+}
+
+func (g *commandGuard) waitEcho(d time.Duration) {
+	g.stopWaiting()
+	g.timer = time.NewTimer(d)
+}
+
+func (g *commandGuard) stopWaiting() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+func (g *commandGuard) echoDone() <-chan time.Time {
+	if g.timer == nil {
+		return nil
+	}
+	return g.timer.C
+}
+
+// input returns the input to record, which is known to be echoed or not
+func (g *commandGuard) input(p []byte) []inputEvent {
+	return g.echo.input(newInputEvent(time.Now(), p))
+}
+
+// output returns the input to record, which the output tells echoed or not
+func (g *commandGuard) output(p []byte) []inputEvent {
+	switch {
+	case g.echoEnded:
+		g.after = append(g.after, p...)
+	case g.sent:
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			g.parser.feedOutput(p[:i])
+			g.after = append(g.after, p[i:]...)
+			g.echoEnded = true
+			g.waitEcho(0)
+		} else {
+			g.parser.feedOutput(p)
+		}
+	default:
+		g.parser.feedOutput(p)
+	}
+	g.lastOutput = time.Now()
+	if g.held != nil && g.cancel == nil {
+		d := echoSettleTime
+		if remain := time.Until(g.deadline); remain < d {
+			d = remain
+		}
+		g.waitEcho(d)
+	}
+	return g.echo.output(p)
+}
+
+// flushInput returns the input left without any output after it, which is masked
+func (g *commandGuard) flushInput() []inputEvent {
+	return g.echo.flush()
+}
+
+func (g *commandGuard) close() {
+	g.stopWaiting()
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// filterInput sends the input to the server, except that it is held from an Enter until the
+// command is checked. Without rules only the input typed ahead of the Enter is held.
+func (s *SwitchSession) filterInput(g *commandGuard, p []byte, srvConn srvconn.ServerConnection) {
+	if g.cancel != nil {
+		// Ctrl+C cancels the ticket, other input is dropped while waiting
+		if bytes.IndexByte(p, 0x03) >= 0 {
+			g.cancel()
+		}
+		return
+	}
+	if g.held != nil {
+		g.held = append(g.held, p...)
+		return
+	}
+	if g.sent {
+		g.queued = append(g.queued, p...)
+		return
+	}
+	i := g.parser.feedInput(p)
+	if i < 0 {
+		s.writeServer(srvConn, p)
+		g.lastInput = time.Now()
+		return
+	}
+	if len(g.rules) == 0 {
+		s.writeServer(srvConn, p[:i+1])
+		g.lastInput = time.Now()
+		g.sent = true
+		g.queued = append([]byte(nil), p[i+1:]...)
+		g.waitEcho(echoWaitTimeout)
+		return
+	}
+	if i > 0 {
+		s.writeServer(srvConn, p[:i])
+		g.lastInput = time.Now()
+	}
+	g.held = append([]byte(nil), p[i:]...)
+	g.deadline = time.Now().Add(echoWaitTimeout)
+	if g.lastOutput.After(g.lastInput) {
+		g.waitEcho(0)
+		return
+	}
+	g.waitEcho(echoWaitTimeout)
+}
+
+func (s *SwitchSession) writeServer(srvConn srvconn.ServerConnection, p []byte) {
+	if _, err := srvConn.Write(p); err != nil {
+		log.Error.Printf("Session[%s] srvConn write err: %s", s.ID[:8], err)
+	}
+}
+
+// releaseInput sends the held Enter, and filters the input after it
+func (s *SwitchSession) releaseInput(g *commandGuard, srvConn srvconn.ServerConnection) {
+	held := g.held
+	g.held = nil
+	g.parser.reset()
+	s.writeServer(srvConn, held[:1])
+	if len(held) > 1 {
+		s.filterInput(g, held[1:], srvConn)
+	}
+}
+
+// dropInput drops the held input and the command line on the server
+func (s *SwitchSession) dropInput(g *commandGuard, srvConn srvconn.ServerConnection) {
+	g.held = nil
+	g.parser.reset()
+	s.writeServer(srvConn, []byte{0x03})
+}
+
+func (s *SwitchSession) checkCommand(g *commandGuard, userConn UserConnection, srvConn srvconn.ServerConnection) {
+	g.stopWaiting()
+	if g.sent {
+		s.recordSentCommand(g, srvConn)
+		return
+	}
+	echo, input := g.parser.command()
+	f := g.match(echo, input)
+	if f == nil {
+		if echo != "" {
+			s.recordCommand(echo, model.RiskNormal)
+		}
+		s.releaseInput(g, srvConn)
+		return
+	}
+	// without echo it may be a password, which must not be logged
+	cmd := echo
+	if cmd == "" {
+		cmd = maskedCommand
+	}
+	s.recordCommand(cmd, model.FilterActionLevel(f.Action))
+	info := s.p.sessionInfo
+	s.p.core.LogFilteredCommand(f, info.User, info.Asset, info.SystemUser, cmd)
+	log.Info.Printf("Session[%s] command filter %s %s command", s.ID[:8], f.ID, f.Action)
+	switch {
+	case f.Action == model.FilterWarn:
+		msg := fmt.Sprintf("Warning: command `%s` matches the filter %s, it has been recorded", cmd, f.Name)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine+common.WrapperWarn(msg))
+		s.releaseInput(g, srvConn)
+	case f.Action == model.FilterConfirm && echo != "":
+		msg := fmt.Sprintf("Command `%s` needs to be confirmed by the reviewers, press Ctrl+C to cancel", cmd)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine+common.WrapperWarn(msg))
+		s.requestCommandConfirm(g, cmd)
+	default:
+		msg := fmt.Sprintf("Command `%s` is forbidden by the filter %s", cmd, f.Name)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine+common.WrapperWarn(msg))
+		s.dropInput(g, srvConn)
+	}
+}
+
+// recordSentCommand records the command whose Enter is sent, then parses the output after its echo
+// and filters the input typed ahead
+func (s *SwitchSession) recordSentCommand(g *commandGuard, srvConn srvconn.ServerConnection) {
+	if echo, _ := g.parser.command(); echo != "" {
+		s.recordCommand(echo, model.RiskNormal)
+	}
+	g.parser.reset()
+	after, queued := g.after, g.queued
+	g.sent, g.echoEnded, g.after, g.queued = false, false, nil, nil
+	g.parser.feedOutput(after)
+	if len(queued) > 0 {
+		s.filterInput(g, queued, srvConn)
+	}
+}
+
+func (s *SwitchSession) recordCommand(cmd string, level int) {
+	info := s.p.sessionInfo
+	s.p.core.InsertCommandLog(&model.CommandLog{
+		SessionID:  s.ID,
+		User:       info.User,
+		Asset:      info.Asset,
+		AssetID:    info.AssetID,
+		SystemUser: info.SystemUser,
+		Command:    cmd,
+		RiskLevel:  level,
+	})
+}
+
+func (s *SwitchSession) requestCommandConfirm(g *commandGuard, cmd string) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	g.cancel = cancel
+	g.command = cmd
+	opts := []auth.ConfirmOption{
+		auth.ConfirmWithUser(s.p.connOpts.user),
+		auth.ConfirmWithSystemUser(s.p.connOpts.systemUser),
+		auth.ConfirmWithAssetID(s.p.connOpts.asset.ID),
+		auth.ConfirmWithAssetName(s.p.connOpts.asset.Name),
+	}
+	go func() {
+		srv := auth.NewLoginConfirm(s.p.core, opts...)
+		res := confirmResult{status: auth.StatusReject}
+		if err := srv.RequestCommandConfirm(cmd); err != nil {
+			log.Error.Printf("Session[%s] request command confirm err: %s", s.ID[:8], err)
+		} else {
+			res.status = srv.WaitLoginConfirm(ctx)
+			res.approver = srv.GetApprover()
+		}
+		g.confirmRes <- res
+	}()
+}
+
+func (s *SwitchSession) finishCommandConfirm(g *commandGuard, res confirmResult, userConn UserConnection,
+	srvConn srvconn.ServerConnection) {
+	g.cancel()
+	g.cancel = nil
+	info := s.p.sessionInfo
+	var msg string
+	switch res.status {
+	case auth.StatusApprove:
+		msg = fmt.Sprintf("%s approved", res.approver)
+		s.p.core.InsertLog("command", info.User, fmt.Sprintf("command `%s` on %s is approved by %s",
+			g.command, info.Asset, res.approver))
+		common.IgnoreErrWriteString(userConn, common.WrapperString(msg, common.Green)+common.CharNewLine)
+		s.releaseInput(g, srvConn)
+		return
+	case auth.StatusReject:
+		msg = "Rejected"
+		if res.approver != "" {
+			msg = fmt.Sprintf("%s rejected", res.approver)
+		}
+	case auth.StatusExpire:
+		msg = "Ticket expired"
+	default:
+		msg = "Cancel confirm"
+	}
+	common.IgnoreErrWriteString(userConn, common.WrapperString(msg, common.Red)+common.CharNewLine)
+	s.dropInput(g, srvConn)
+}
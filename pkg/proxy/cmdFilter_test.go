@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// fakeServerConn keeps the writes to the server
+type fakeServerConn struct {
+	writes []string
+}
+
+func (c *fakeServerConn) Read(p []byte) (int, error) { return 0, nil }
+
+func (c *fakeServerConn) Write(p []byte) (int, error) {
+	c.writes = append(c.writes, string(p))
+	return len(p), nil
+}
+
+func (c *fakeServerConn) Close() error                       { return nil }
+func (c *fakeServerConn) SetWinSize(width, height int) error { return nil }
+func (c *fakeServerConn) KeepAlive() error                   { return nil }
+
+func newTestGuard() *commandGuard {
+	return &commandGuard{
+		rules: []commandRule{{
+			filter:   model.CommandFilter{ID: "1", Name: "rm", Action: model.FilterDeny},
+			patterns: []*regexp.Regexp{regexp.MustCompile(`^rm\b`)},
+		}},
+		confirmRes: make(chan confirmResult, 1),
+	}
+}
+
+func TestFilterInputHold(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []echoStep
+		writes []string
+		held   string
+	}{
+		{
+			name:   "typed before the enter",
+			steps:  []echoStep{{out: "$ "}, {in: "ls"}, {out: "ls"}, {in: "\r"}},
+			writes: []string{"ls"},
+			held:   "\r",
+		},
+		{
+			name:   "input with the enter",
+			steps:  []echoStep{{out: "$ "}, {in: "ls\r"}},
+			writes: []string{"ls"},
+			held:   "\r",
+		},
+		{
+			name:   "input queued behind the enter",
+			steps:  []echoStep{{out: "$ "}, {in: "ls\rpw"}, {in: "d\r"}},
+			writes: []string{"ls"},
+			held:   "\rpwd\r",
+		},
+		{
+			name:   "enter without a command",
+			steps:  []echoStep{{out: "$ "}, {in: "\r"}},
+			writes: []string{"\r"},
+		},
+		{
+			name:   "full screen program",
+			steps:  []echoStep{{out: "\x1b[?1049h"}, {in: "ihello\x1b:wq\r"}},
+			writes: []string{"ihello\x1b:wq\r"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SwitchSession{ID: "00000000-test"}
+			g := newTestGuard()
+			defer g.close()
+			conn := &fakeServerConn{}
+			for _, st := range tt.steps {
+				if st.in != "" {
+					s.filterInput(g, []byte(st.in), conn)
+					continue
+				}
+				g.output([]byte(st.out))
+			}
+			if !reflect.DeepEqual(conn.writes, tt.writes) {
+				t.Errorf("writes = %q, want %q", conn.writes, tt.writes)
+			}
+			if string(g.held) != tt.held {
+				t.Errorf("held = %q, want %q", g.held, tt.held)
+			}
+			if (g.held != nil) != (g.echoDone() != nil) {
+				t.Errorf("held = %q, but waiting for the echo is %t", g.held, g.echoDone() != nil)
+			}
+		})
+	}
+}
+
+func TestReleaseInput(t *testing.T) {
+	s := &SwitchSession{ID: "00000000-test"}
+	g := newTestGuard()
+	defer g.close()
+	conn := &fakeServerConn{}
+	g.output([]byte("$ "))
+	s.filterInput(g, []byte("ls\rpwd\rid"), conn)
+	g.output([]byte("ls"))
+	if echo, input := g.parser.command(); echo != "ls" || input != "ls" {
+		t.Fatalf("command = %q, %q, want ls", echo, input)
+	}
+
+	// the input after the enter is filtered as the next command
+	s.releaseInput(g, conn)
+	if want := []string{"ls", "\r", "pwd"}; !reflect.DeepEqual(conn.writes, want) {
+		t.Fatalf("writes = %q, want %q", conn.writes, want)
+	}
+	if string(g.held) != "\rid" {
+		t.Fatalf("held = %q, want %q", g.held, "\rid")
+	}
+	// the prompt is in the echo of the input typed ahead, which is matched by the input as well
+	g.output([]byte("\r\nfile\r\n$ pwd"))
+	if _, input := g.parser.command(); input != "pwd" {
+		t.Fatalf("input = %q, want pwd", input)
+	}
+
+	s.releaseInput(g, conn)
+	if want := []string{"ls", "\r", "pwd", "\r", "id"}; !reflect.DeepEqual(conn.writes, want) {
+		t.Fatalf("writes = %q, want %q", conn.writes, want)
+	}
+	if g.held != nil {
+		t.Fatalf("held = %q after the release", g.held)
+	}
+}
+
+func TestDropInput(t *testing.T) {
+	s := &SwitchSession{ID: "00000000-test"}
+	g := newTestGuard()
+	defer g.close()
+	conn := &fakeServerConn{}
+	g.output([]byte("$ "))
+	s.filterInput(g, []byte("rm -rf /\rls\r"), conn)
+	g.output([]byte("rm -rf /"))
+	if f := g.match(g.parser.command()); f == nil || f.ID != "1" {
+		t.Fatalf("filter = %v, want 1", f)
+	}
+
+	// the command line is cleared on the server, and the input queued behind it is dropped
+	s.dropInput(g, conn)
+	if want := []string{"rm -rf /", "\x03"}; !reflect.DeepEqual(conn.writes, want) {
+		t.Fatalf("writes = %q, want %q", conn.writes, want)
+	}
+	if g.held != nil {
+		t.Fatalf("held = %q after the drop", g.held)
+	}
+	s.filterInput(g, []byte("l"), conn)
+	if want := []string{"rm -rf /", "\x03", "l"}; !reflect.DeepEqual(conn.writes, want) {
+		t.Fatalf("writes = %q, want %q", conn.writes, want)
+	}
+}
+
+func TestFilterInputWithoutRules(t *testing.T) {
+	s := &SwitchSession{ID: "00000000-test"}
+	g := &commandGuard{confirmRes: make(chan confirmResult, 1)}
+	defer g.close()
+	conn := &fakeServerConn{}
+	g.output([]byte("$ "))
+
+	// the enter is sent at once, the input typed ahead of it waits for the command to be recorded
+	s.filterInput(g, []byte("ls\rpw"), conn)
+	s.filterInput(g, []byte("d\r"), conn)
+	if want := []string{"ls\r"}; !reflect.DeepEqual(conn.writes, want) {
+		t.Fatalf("writes = %q, want %q", conn.writes, want)
+	}
+	if g.held != nil || string(g.queued) != "pwd\r" {
+		t.Fatalf("held = %q, queued = %q, want the queued pwd", g.held, g.queued)
+	}
+
+	// the command is taken when the line of its echo ends
+	g.output([]byte("ls\r"))
+	if g.echoEnded {
+		t.Fatal("the echo ends before the new line")
+	}
+	g.output([]byte("\nfile\r\n$ "))
+	if !g.echoEnded || string(g.after) != "\nfile\r\n$ " {
+		t.Fatalf("echo ended = %t, after = %q", g.echoEnded, g.after)
+	}
+	if echo, _ := g.parser.command(); echo != "ls" {
+		t.Fatalf("echo = %q, want ls", echo)
+	}
+	select {
+	case <-g.echoDone():
+	case <-time.After(time.Second):
+		t.Fatal("the command is not recorded at the end of the echo")
+	}
+}
@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	stateNormal = iota
+	stateEsc
+	stateCSI
+	stateOSC
+	stateSS3
+)
+
+// commandParser rebuilds the command line which the user is typing. The echo of the server is
+// replayed on a single line terminal, so that the line editing and completion are taken into
+// account, and the input of the user is kept as well for the commands without echo.
+type commandParser struct {
+	inputting bool
+	altScreen bool
+
+	// the last line of the output before the user starts typing
+	prompt []rune
+	line   []rune
+	cursor int
+	input  []byte
+
+	outState  int
+	outParams []rune
+	pending   []byte
+	inState   int
+}
+
+func (c *commandParser) reset() {
+	c.inputting = false
+	c.prompt = c.prompt[:0]
+	c.line = c.line[:0]
+	c.cursor = 0
+	c.input = c.input[:0]
+}
+
+// feedInput returns the index of the Enter which ends a command, or -1.
+// The bytes from the Enter are not consumed.
+func (c *commandParser) feedInput(p []byte) int {
+	for i, b := range p {
+		switch c.inState {
+		case stateEsc:
+			switch b {
+			case '[':
+				c.inState = stateCSI
+			case 'O':
+				c.inState = stateSS3
+			default:
+				c.inState = stateNormal
+			}
+			continue
+		case stateCSI:
+			if b >= 0x40 && b <= 0x7e {
+				c.inState = stateNormal
+			}
+			continue
+		case stateSS3:
+			c.inState = stateNormal
+			continue
+		}
+		switch b {
+		case '\r', '\n':
+			if c.inputting && !c.altScreen {
+				return i
+			}
+			// the keys of a full screen program are not a command
+			c.reset()
+			continue
+		case 0x1b:
+			c.inState = stateEsc
+		case 0x03: // Ctrl+C
+			c.reset()
+			continue
+		case 0x7f, 0x08:
+			_, size := utf8.DecodeLastRune(c.input)
+			c.input = c.input[:len(c.input)-size]
+		case 0x15: // Ctrl+U
+			c.input = c.input[:0]
+		case 0x17: // Ctrl+W
+			s := strings.TrimRight(string(c.input), " ")
+			c.input = c.input[:strings.LastIndex(s, " ")+1]
+		default:
+			if b >= 0x20 {
+				c.input = append(c.input, b)
+			}
+		}
+		if !c.inputting {
+			c.inputting = true
+			c.line = c.line[:0]
+			c.cursor = 0
+		}
+	}
+	return -1
+}
+
+func (c *commandParser) feedOutput(p []byte) {
+	data := p
+	if len(c.pending) > 0 {
+		data = append(c.pending, p...)
+		c.pending = nil
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && !utf8.FullRune(data) {
+			c.pending = append([]byte(nil), data...)
+			return
+		}
+		data = data[size:]
+		c.feedRune(r)
+	}
+}
+
+func (c *commandParser) feedRune(r rune) {
+	switch c.outState {
+	case stateEsc:
+		switch r {
+		case '[':
+			c.outState = stateCSI
+			c.outParams = c.outParams[:0]
+		case ']':
+			c.outState = stateOSC
+		default:
+			c.outState = stateNormal
+		}
+		return
+	case stateCSI:
+		if r >= 0x40 && r <= 0x7e {
+			c.outState = stateNormal
+			c.csi(r, string(c.outParams))
+		} else {
+			c.outParams = append(c.outParams, r)
+		}
+		return
+	case stateOSC:
+		switch r {
+		case 0x07:
+			c.outState = stateNormal
+		case 0x1b:
+			c.outState = stateEsc
+		}
+		return
+	}
+	if r == 0x1b {
+		c.outState = stateEsc
+		return
+	}
+	if !c.inputting {
+		switch {
+		case r == '\r' || r == '\n':
+			c.prompt = c.prompt[:0]
+		case r == 0x08:
+			if len(c.prompt) > 0 {
+				c.prompt = c.prompt[:len(c.prompt)-1]
+			}
+		case r >= 0x20 && r != 0x7f:
+			c.prompt = append(c.prompt, r)
+		}
+		return
+	}
+	switch {
+	case r == '\r':
+		c.cursor = 0
+	case r == 0x08:
+		if c.cursor > 0 {
+			c.cursor--
+		}
+	case r >= 0x20 && r != 0x7f:
+		if c.cursor < len(c.line) {
+			c.line[c.cursor] = r
+		} else {
+			c.line = append(c.line, r)
+		}
+		c.cursor++
+	}
+}
+
+func (c *commandParser) csi(final rune, params string) {
+	if strings.HasPrefix(params, "?") && (final == 'h' || final == 'l') {
+		for _, mode := range strings.Split(params[1:], ";") {
+			switch mode {
+			case "47", "1047", "1049":
+				c.altScreen = final == 'h'
+				c.reset()
+			}
+		}
+		return
+	}
+	if !c.inputting {
+		return
+	}
+	n, err := strconv.Atoi(params)
+	if err != nil {
+		n = 0
+	}
+	count := n
+	if count < 1 {
+		count = 1
+	}
+	switch final {
+	case 'K':
+		switch n {
+		case 0:
+			c.line = c.line[:c.cursor]
+		case 1:
+			for i := 0; i < c.cursor && i < len(c.line); i++ {
+				c.line[i] = ' '
+			}
+		case 2:
+			c.line = c.line[:0]
+		}
+	case 'J':
+		if n == 0 || n == 2 {
+			c.line = c.line[:c.cursor]
+		}
+	case 'H':
+		c.cursor = 0
+	case 'D':
+		c.cursor -= count
+		if c.cursor < 0 {
+			c.cursor = 0
+		}
+	case 'C':
+		c.cursor += count
+		for len(c.line) < c.cursor {
+			c.line = append(c.line, ' ')
+		}
+	case 'P':
+		if c.cursor < len(c.line) {
+			end := c.cursor + count
+			if end > len(c.line) {
+				end = len(c.line)
+			}
+			c.line = append(c.line[:c.cursor], c.line[end:]...)
+		}
+	case '@':
+		if c.cursor <= len(c.line) {
+			blank := []rune(strings.Repeat(" ", count))
+			c.line = append(c.line[:c.cursor], append(blank, c.line[c.cursor:]...)...)
+		}
+	}
+	if c.cursor > len(c.line) {
+		c.cursor = len(c.line)
+	}
+}
+
+// command returns the command rebuilt from the echo, and the one from the input of the user
+func (c *commandParser) command() (string, string) {
+	// the prompt is in the line when it is redrawn
+	line := strings.TrimPrefix(string(c.line), string(c.prompt))
+	return strings.TrimSpace(line), strings.TrimSpace(string(c.input))
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import "testing"
+
+func TestCommandParser(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []echoStep
+		// the index of the Enter in the last input
+		enter int
+		echo  string
+		input string
+	}{
+		{
+			name:  "typed command",
+			steps: []echoStep{{out: "$ "}, {in: "ls -l"}, {out: "ls -l"}, {in: "\r"}},
+			enter: 0,
+			echo:  "ls -l",
+			input: "ls -l",
+		},
+		{
+			name:  "backspace",
+			steps: []echoStep{{out: "$ "}, {in: "lss"}, {out: "lss"}, {in: "\x7f"}, {out: "\b\x1b[K"}, {in: "\r"}},
+			enter: 0,
+			echo:  "ls",
+			input: "ls",
+		},
+		{
+			name: "insert in the middle",
+			steps: []echoStep{{out: "$ "}, {in: "ls"}, {out: "ls"}, {in: "\x1b[D"}, {out: "\b"},
+				{in: "a"}, {out: "\x1b[1@a"}, {in: "\r"}},
+			enter: 0,
+			echo:  "las",
+			input: "lsa",
+		},
+		{
+			name:  "history recall",
+			steps: []echoStep{{out: "$ "}, {in: "\x1b[A"}, {out: "cat /etc/passwd"}, {in: "\r"}},
+			enter: 0,
+			echo:  "cat /etc/passwd",
+			input: "",
+		},
+		{
+			name: "history redrawn with the prompt",
+			steps: []echoStep{{out: "$ "}, {in: "ls"}, {out: "ls"}, {in: "\x1b[A"},
+				{out: "\r$ cat /etc/shadow\x1b[K"}, {in: "\r"}},
+			enter: 0,
+			echo:  "cat /etc/shadow",
+			input: "ls",
+		},
+		{
+			name:  "tab completion",
+			steps: []echoStep{{out: "$ "}, {in: "cat /etc/pas"}, {out: "cat /etc/pas"}, {in: "\t"}, {out: "swd "}, {in: "\r"}},
+			enter: 0,
+			echo:  "cat /etc/passwd",
+			input: "cat /etc/pas",
+		},
+		{
+			name: "ctrl+u",
+			steps: []echoStep{{out: "$ "}, {in: "rm -rf /"}, {out: "rm -rf /"}, {in: "\x15"},
+				{out: "\b\b\b\b\b\b\b\b\x1b[K"}, {in: "ls"}, {out: "ls"}, {in: "\r"}},
+			enter: 0,
+			echo:  "ls",
+			input: "ls",
+		},
+		{
+			name: "ctrl+w",
+			steps: []echoStep{{out: "$ "}, {in: "ls /tmp"}, {out: "ls /tmp"}, {in: "\x17"}, {out: "\b\b\b\b\x1b[K"},
+				{in: "/var"}, {out: "/var"}, {in: "\r"}},
+			enter: 0,
+			echo:  "ls /var",
+			input: "ls /var",
+		},
+		{
+			name:  "enter in the middle of the input",
+			steps: []echoStep{{out: "$ "}, {in: "ls\rpwd\r"}},
+			enter: 2,
+			echo:  "",
+			input: "ls",
+		},
+		{
+			name:  "without echo",
+			steps: []echoStep{{out: "Password: "}, {in: "secret"}, {in: "\r"}},
+			enter: 0,
+			echo:  "",
+			input: "secret",
+		},
+		{
+			name:  "alternate screen",
+			steps: []echoStep{{out: "$ "}, {in: "vi\r"}, {out: "\x1b[?1049h"}, {in: "ihello\x1b:wq\r"}},
+			enter: -1,
+		},
+		{
+			name: "after the alternate screen",
+			steps: []echoStep{{out: "\x1b[?1049h"}, {in: ":wq\r"}, {out: "\x1b[?1049l$ "}, {in: "id"}, {out: "id"},
+				{in: "\r"}},
+			enter: 0,
+			echo:  "id",
+			input: "id",
+		},
+		{
+			name:  "ctrl+c",
+			steps: []echoStep{{out: "$ "}, {in: "rm"}, {out: "rm"}, {in: "\x03"}, {out: "^C\r\n$ "}, {in: "\r"}},
+			enter: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c commandParser
+			enter := -1
+			for _, s := range tt.steps {
+				if s.in != "" {
+					// the command is ended by the first Enter, as it's held by the guard
+					if enter = c.feedInput([]byte(s.in)); enter >= 0 && s.in[enter+1:] != "" {
+						break
+					}
+					continue
+				}
+				c.feedOutput([]byte(s.out))
+			}
+			if enter != tt.enter {
+				t.Fatalf("enter = %d, want %d", enter, tt.enter)
+			}
+			if enter < 0 {
+				return
+			}
+			echo, input := c.command()
+			if echo != tt.echo || input != tt.input {
+				t.Errorf("command = %q, %q, want %q, %q", echo, input, tt.echo, tt.input)
+			}
+		})
+	}
+}
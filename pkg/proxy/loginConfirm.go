@@ -8,7 +8,9 @@ import (
 
 	"github.com/handewo/gojump/pkg/auth"
 	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
 	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
 )
 
 func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn UserConnection) bool {
@@ -22,13 +24,40 @@ func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn Us
 		return false
 	}
 	if !ok {
+		if id := srv.GetTicketId(); id != "" {
+			until := time.Unix(srv.GetValidUntil(), 0).Format(common.LogFormat)
+			log.Info.Printf("Conn[%s] login by ticket %s until %s", userConn.ID()[:8], id, until)
+			msg := fmt.Sprintf("Login by the ticket %s approved until %s", id, until)
+			common.IgnoreErrWriteString(userConn, common.WrapperString(msg, common.Green))
+			common.IgnoreErrWriteString(userConn, common.CharNewLine)
+			return true
+		}
 		log.Debug.Printf("Conn[%s] no need login confirm", userConn.ID()[:8])
 		return true
 	}
 
-	ctx, cancelFunc := context.WithCancel(userConn.Context())
 	term := common.NewTerminal(userConn, "")
 	defer userConn.Close()
+	common.IgnoreErrWriteString(userConn, "Need confirm to login, enter q to exit.")
+	common.IgnoreErrWriteString(userConn, common.CharNewLine)
+	reason, ok := readTicketField(term, "Reason: ", true)
+	if !ok {
+		return false
+	}
+	changeID, ok := readTicketField(term, "Change or incident ID (optional): ", false)
+	if !ok {
+		return false
+	}
+	term.SetPrompt("")
+	if err = srv.RequestLoginConfirm(reason, changeID); err != nil {
+		log.Error.Printf("Conn[%s] request login confirm err: %s", userConn.ID()[:8], err)
+		msg := common.WrapperString(fmt.Sprintf("Request login confirm failed: %s", err), common.Red)
+		common.IgnoreErrWriteString(userConn, msg)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine)
+		return false
+	}
+
+	ctx, cancelFunc := context.WithCancel(userConn.Context())
 	go func() {
 		defer cancelFunc()
 		for {
@@ -45,13 +74,24 @@ func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn Us
 		}
 	}()
 	reviewers := srv.GetReviewers()
-	titleMsg := "Need confirm to login"
+	steps := srv.GetSteps()
+	titleMsg := fmt.Sprintf("Ticket %s", srv.GetTicketId())
+	if expireAt := srv.GetExpireAt(); expireAt > 0 {
+		titleMsg += fmt.Sprintf(" expires at %s", time.Unix(expireAt, 0).Format(common.LogFormat))
+	}
 	reviewersMsg := fmt.Sprintf("Ticket Reviewers: %s", strings.Join(reviewers, ", "))
 	waitMsg := "Please waiting for the reviewers to confirm, enter q to exit. "
 	common.IgnoreErrWriteString(userConn, titleMsg)
 	common.IgnoreErrWriteString(userConn, common.CharNewLine)
-	common.IgnoreErrWriteString(userConn, reviewersMsg)
-	common.IgnoreErrWriteString(userConn, common.CharNewLine)
+	if len(steps) == 0 {
+		common.IgnoreErrWriteString(userConn, reviewersMsg)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine)
+	}
+	for i, step := range steps {
+		stepMsg := fmt.Sprintf("Step %d: %d of %s", i+1, step.Required, strings.Join(step.Reviewers, ", "))
+		common.IgnoreErrWriteString(userConn, stepMsg)
+		common.IgnoreErrWriteString(userConn, common.CharNewLine)
+	}
 	common.IgnoreErrWriteString(userConn, common.CharNewLine)
 	go func() {
 		delay := 0
@@ -61,7 +101,7 @@ func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn Us
 				return
 			default:
 				delayS := fmt.Sprintf("%ds", delay)
-				data := strings.Repeat("\x08", len(delayS)+len(waitMsg)) + waitMsg + delayS
+				data := "\r" + reviewProgress(srv, steps) + waitMsg + delayS + "\x1b[K"
 				common.IgnoreErrWriteString(userConn, data)
 				time.Sleep(time.Second)
 				delay += 1
@@ -84,6 +124,8 @@ func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn Us
 		statusMsg = common.WrapperString(fmt.Sprintf(formatMsg, processor), common.Red)
 	case auth.StatusCancel:
 		statusMsg = common.WrapperString("Cancel confirm", common.Red)
+	case auth.StatusExpire:
+		statusMsg = common.WrapperString("Ticket expired", common.Red)
 	}
 	log.Info.Printf("Conn[%s] Login Confirm result: %s", userConn.ID()[:8], statusMsg)
 	common.IgnoreErrWriteString(userConn, common.CharNewLine)
@@ -91,3 +133,34 @@ func (s *Server) validateLoginConfirm(srv *auth.LoginConfirmService, userConn Us
 	common.IgnoreErrWriteString(userConn, common.CharNewLine)
 	return success
 }
+
+// reviewProgress shows the approvals of the current step, such as "Step 1/2 approved 1 of 2 (alice). "
+func reviewProgress(srv *auth.LoginConfirmService, steps []model.TicketStep) string {
+	t := model.LoginTicket{Steps: steps}
+	if state, ok := srv.GetState(); ok && len(state.Steps) == len(steps) {
+		t.Steps, t.Step = state.Steps, state.Step
+	}
+	msg := core.TicketProgress(&t)
+	if msg == "" {
+		return ""
+	}
+	return strings.ToUpper(msg[:1]) + msg[1:] + ". "
+}
+
+// readTicketField reads the field of the ticket, it returns false if the user quits
+func readTicketField(term *common.Terminal, prompt string, required bool) (string, bool) {
+	term.SetPrompt(prompt)
+	for {
+		line, err := term.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "q" || line == "quit":
+			return "", false
+		case line != "" || !required:
+			return line, true
+		}
+	}
+}
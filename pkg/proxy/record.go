@@ -1,15 +1,18 @@
 package proxy
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/config"
 	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/storage"
 )
 
 const (
@@ -17,8 +20,39 @@ const (
 
 	replayFilenameSuffix   = ".cast"
 	replayGzFilenameSuffix = ".gz"
+	// the replay is compressed into the part file, which is renamed once it's complete
+	replayPartFilenameSuffix = ".part"
+
+	maskedInputChar = '*'
+
+	replayUploadRetries  = 5
+	replayUploadInterval = time.Hour
+)
+
+var (
+	replayStorage     storage.ReplayStorage
+	replayStorageOnce sync.Once
+
+	// the targets being uploaded
+	uploadingReplays sync.Map
 )
 
+// getReplayStorage returns the storage of the config, the replays stay in the replay folder if
+// the storage is invalid.
+func getReplayStorage() storage.ReplayStorage {
+	replayStorageOnce.Do(func() {
+		conf := config.GetConf()
+		st, err := storage.NewReplayStorage(conf)
+		if err != nil {
+			log.Error.Printf("Replay storage %s is invalid, keep replays in %s: %s",
+				conf.ReplayStorage, conf.ReplayFolderPath, err)
+			st = storage.NewLocalStorage(conf.ReplayFolderPath)
+		}
+		replayStorage = st
+	})
+	return replayStorage
+}
+
 func NewReplayRecord(sid, user, asset string, info *ReplyInfo) (*ReplyRecorder, error) {
 	recorder := &ReplyRecorder{
 		SessionID:      sid,
@@ -30,16 +64,23 @@ func NewReplayRecord(sid, user, asset string, info *ReplyInfo) (*ReplyRecorder,
 		log.Info.Print("replay recorder is disabled")
 		return recorder, nil
 	}
+	if isReplayVolumeFull() && config.GetConf().ReplayDiskFullAction == DiskFullDisableRecorder {
+		log.Warning.Printf("Session %s is not recorded, the replay volume is full", sid)
+		recorder.disableRecorer = true
+		return recorder, nil
+	}
 	today := info.TimeStamp.Format(dateTimeFormat)
 	replayRootDir := config.GetConf().ReplayFolderPath
 	sessionReplayDirPath := filepath.Join(replayRootDir, today)
 	err := common.EnsureDirExist(sessionReplayDirPath)
 	if err != nil {
 		log.Error.Printf("Create dir %s error: %s", sessionReplayDirPath, err)
+		setReplayVolumeFull(true, err.Error())
 		recorder.err = err
 		return recorder, err
 	}
-	filename := user + "_" + asset + "_" + info.TimeStamp.Format("150405") + "_" + sid[:8] + replayFilenameSuffix
+	filename := strings.Join([]string{safeFilename(user), safeFilename(asset), info.TimeStamp.Format("150405"), sid[:8]},
+		replayFieldSep) + replayFilenameSuffix
 	gzFilename := filename + replayGzFilenameSuffix
 	absFilePath := filepath.Join(sessionReplayDirPath, filename)
 	absGZFilePath := filepath.Join(sessionReplayDirPath, gzFilename)
@@ -50,6 +91,7 @@ func NewReplayRecord(sid, user, asset string, info *ReplyInfo) (*ReplyRecorder,
 	fd, err := os.Create(recorder.absFilePath)
 	if err != nil {
 		log.Error.Printf("Create replay file %s error: %s", recorder.absFilePath, err)
+		setReplayVolumeFull(true, err.Error())
 		recorder.err = err
 		return recorder, err
 	}
@@ -80,26 +122,186 @@ type ReplyRecorder struct {
 	disableRecorer bool
 }
 
+// isDisableRecorder reports whether the recorder is disabled, or it failed to create the replay file
 func (r *ReplyRecorder) isDisableRecorder() bool {
-	return r.disableRecorer
+	return r.disableRecorer || r.err != nil
 }
 
+func (r *ReplyRecorder) writeHeader() {
+	r.once.Do(func() {
+		if err := r.Writer.WriteHeader(); err != nil {
+			log.Error.Printf("Session %s write replay header failed: %s", r.SessionID, err)
+		}
+	})
+}
+
+// Record writes the output of the server
 func (r *ReplyRecorder) Record(p []byte) {
 	if r.isDisableRecorder() {
 		return
 	}
 	if len(p) > 0 {
-		r.once.Do(func() {
-			if err := r.Writer.WriteHeader(); err != nil {
-				log.Error.Printf("Session %s write replay header failed: %s", r.SessionID, err)
-			}
-		})
+		r.writeHeader()
 		if err := r.Writer.WriteRow(p); err != nil {
 			log.Error.Printf("Session %s write replay row failed: %s", r.SessionID, err)
 		}
 	}
 }
 
+// RecordInput writes the input of the user, the typed text which is not echoed is masked
+func (r *ReplyRecorder) RecordInput(events ...inputEvent) {
+	if r.isDisableRecorder() || len(events) == 0 {
+		return
+	}
+	r.writeHeader()
+	for i := range events {
+		ev := &events[i]
+		if err := r.Writer.WriteStdin(r.Writer.Elapsed(ev.time), ev.data()); err != nil {
+			log.Error.Printf("Session %s write replay input failed: %s", r.SessionID, err)
+		}
+	}
+}
+
+// inputEvent is the input of the user split into the characters
+type inputEvent struct {
+	time  time.Time
+	chars []inputChar
+}
+
+type inputChar struct {
+	b         []byte
+	printable bool
+	// the printable character is echoed by the server
+	echoed bool
+}
+
+func newInputEvent(t time.Time, p []byte) inputEvent {
+	ev := inputEvent{time: t}
+	scanInput(p, func(b []byte, printable bool) {
+		ev.chars = append(ev.chars, inputChar{b: append([]byte(nil), b...), printable: printable})
+	})
+	return ev
+}
+
+// data returns the input where each printable character not echoed is replaced by *
+func (ev *inputEvent) data() []byte {
+	res := make([]byte, 0, len(ev.chars))
+	for _, c := range ev.chars {
+		if c.printable && !c.echoed {
+			res = append(res, maskedInputChar)
+			continue
+		}
+		res = append(res, c.b...)
+	}
+	return res
+}
+
+func (ev *inputEvent) hasPrintable() bool {
+	for _, c := range ev.chars {
+		if c.printable {
+			return true
+		}
+	}
+	return false
+}
+
+// inputEcho tells which typed characters are echoed by the server. A character is echoed only if
+// the output starts with it byte for byte, as the immediate reply to it, and the output which
+// follows a control key is taken as the reply to the key. Any other input is masked, as the
+// terminal may be in no-echo mode, such as at a password prompt.
+type inputEcho struct {
+	pending []inputEvent
+	// the next character of pending[0] to match, and the bytes of it matched by the last output
+	next    int
+	partial int
+}
+
+// input adds the input of the user, and returns it at once if it has no typed text to match
+func (e *inputEcho) input(ev inputEvent) []inputEvent {
+	if len(e.pending) == 0 && !ev.hasPrintable() {
+		return []inputEvent{ev}
+	}
+	e.pending = append(e.pending, ev)
+	return nil
+}
+
+// output matches the output of the server with the pending input, and returns the input which is
+// matched or masked. The input is kept if the output ends before it, the echo may be split.
+func (e *inputEcho) output(p []byte) []inputEvent {
+	var res []inputEvent
+	for len(e.pending) > 0 {
+		ev := &e.pending[0]
+		for e.next < len(ev.chars) {
+			if len(p) == 0 {
+				return res
+			}
+			c := &ev.chars[e.next]
+			if !c.printable {
+				// the reply to the key is unknown, such as the line redrawn after Ctrl+U
+				e.next++
+				p = nil
+				continue
+			}
+			want := c.b[e.partial:]
+			if !bytes.HasPrefix(p, want) {
+				if len(p) < len(want) && bytes.HasPrefix(want, p) {
+					e.partial += len(p)
+					return res
+				}
+				return append(res, e.flush()...)
+			}
+			c.echoed = true
+			p = p[len(want):]
+			e.next++
+			e.partial = 0
+		}
+		res = append(res, *ev)
+		e.pending = e.pending[1:]
+		e.next = 0
+	}
+	return res
+}
+
+// flush returns the pending input, the characters which are not matched yet are masked
+func (e *inputEcho) flush() []inputEvent {
+	res := e.pending
+	e.pending = nil
+	e.next = 0
+	e.partial = 0
+	return res
+}
+
+// scanInput splits the input into characters, the control keys and the bytes of the escape
+// sequences are not printable.
+func scanInput(p []byte, fn func(b []byte, printable bool)) {
+	state := stateNormal
+	for len(p) > 0 {
+		r, size := utf8.DecodeRune(p)
+		b := p[:size]
+		p = p[size:]
+		switch state {
+		case stateEsc:
+			state = stateNormal
+			if r == '[' || r == 'O' {
+				state = stateCSI
+			}
+			fn(b, false)
+			continue
+		case stateCSI:
+			// the sequences of the keys end with a letter or ~
+			if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || r == '~' {
+				state = stateNormal
+			}
+			fn(b, false)
+			continue
+		}
+		if r == 0x1b {
+			state = stateEsc
+		}
+		fn(b, r >= 0x20 && r != 0x7f)
+	}
+}
+
 func (r *ReplyRecorder) End() {
 	if r.isDisableRecorder() {
 		return
@@ -120,9 +322,76 @@ func (r *ReplyRecorder) compressReplay() {
 	}
 	if !common.FileExists(r.absGzipFilePath) {
 		log.Debug.Print("Compress replay file: ", r.absFilePath)
-		_ = common.GzipCompressFile(r.absFilePath, r.absGzipFilePath)
+		partPath := r.absGzipFilePath + replayPartFilenameSuffix
+		if err := common.GzipCompressFile(r.absFilePath, partPath); err != nil {
+			log.Error.Printf("Compress replay %s failed: %s", r.absFilePath, err)
+			_ = os.Remove(partPath)
+			return
+		}
+		if err := os.Rename(partPath, r.absGzipFilePath); err != nil {
+			log.Error.Printf("Rename compressed replay %s failed: %s", partPath, err)
+			_ = os.Remove(partPath)
+			return
+		}
 		_ = os.Remove(r.absFilePath)
 	}
+	uploadReplay(r.Target, r.absGzipFilePath)
+}
+
+// uploadReplay uploads the compressed replay with retries, and removes the local file after the
+// upload is confirmed. The replay stays locally if all tries fail, and is uploaded by RunReplayUpload.
+func uploadReplay(target, path string) {
+	st := getReplayStorage()
+	if st.TypeName() == storage.TypeLocal {
+		return
+	}
+	if _, ok := uploadingReplays.LoadOrStore(target, struct{}{}); ok {
+		return
+	}
+	defer uploadingReplays.Delete(target)
+	// the replay listed by RunReplayUpload may be uploaded and removed since
+	if !common.FileExists(path) {
+		return
+	}
+	var err error
+	for i := 0; i < replayUploadRetries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<i) * time.Second)
+		}
+		if err = st.Upload(target, path); err == nil {
+			break
+		}
+		log.Error.Printf("Upload replay %s to %s failed: %s", target, st.TypeName(), err)
+	}
+	if err != nil {
+		log.Error.Printf("Upload replay %s failed after %d tries, keep it in %s", target, replayUploadRetries, path)
+		return
+	}
+	if err = os.Remove(path); err != nil {
+		log.Error.Printf("Remove uploaded replay %s failed: %s", path, err)
+	}
+	log.Info.Printf("Upload replay %s to %s", target, st.TypeName())
+}
+
+// RunReplayUpload uploads the compressed replays left in the replay folder, such as the ones
+// failed to upload or recorded before the storage is configured.
+func RunReplayUpload() {
+	for {
+		if st := getReplayStorage(); st.TypeName() != storage.TypeLocal {
+			root := config.GetConf().ReplayFolderPath
+			objects, err := storage.NewLocalStorage(root).List()
+			if err != nil {
+				log.Error.Printf("List local replays failed: %s", err)
+			}
+			for _, v := range objects {
+				// the raw and the part files are still being recorded or compressed
+				if strings.HasSuffix(v.Target, replayFilenameSuffix+replayGzFilenameSuffix) {
+					uploadReplay(v.Target, filepath.Join(root, filepath.FromSlash(v.Target)))
+				}
+			}
+		}
+		time.Sleep(replayUploadInterval)
+	}
 }
 
 type ReplyInfo struct {
@@ -130,3 +399,19 @@ type ReplyInfo struct {
 	Height    int
 	TimeStamp time.Time
 }
+
+// safeFilename replaces the characters of the name which are not allowed in the names of users and assets,
+// the ones created before the names are validated may contain them.
+func safeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, name)
+	if strings.HasPrefix(name, ".") {
+		name = "-" + name[1:]
+	}
+	return name
+}
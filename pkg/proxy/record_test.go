@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+type echoStep struct {
+	// the input of the user if it is set, or else the output of the server
+	in  string
+	out string
+}
+
+func TestInputEcho(t *testing.T) {
+	in := func(s string) echoStep { return echoStep{in: s} }
+	out := func(s string) echoStep { return echoStep{out: s} }
+	tests := []struct {
+		name  string
+		steps []echoStep
+		want  []string
+	}{
+		{
+			name:  "echoed command",
+			steps: []echoStep{in("l"), out("l"), in("s"), out("s"), in("\r"), out("\r\nfile\r\n$ ")},
+			want:  []string{"l", "s", "\r"},
+		},
+		{
+			name: "password prompt",
+			steps: []echoStep{out("Password: "), in("s"), in("e"), in("c"), in("\r"),
+				out("\r\n"), out("Last login: today\r\n$ ")},
+			want: []string{"*", "*", "*", "\r"},
+		},
+		{
+			name:  "password equal to the username in the next prompt",
+			steps: []echoStep{out("Password: "), in("rick"), in("\r"), out("\r\nrick@host:~$ ")},
+			want:  []string{"****", "\r"},
+		},
+		{
+			name:  "password in the next output",
+			steps: []echoStep{in("welcome"), in("\r"), out("\r\nwelcome to the host\r\n")},
+			want:  []string{"*******", "\r"},
+		},
+		{
+			name:  "password at the start of output which is not the reply",
+			steps: []echoStep{in("top"), in("\r"), out("\r\n"), out("top secret\r\n")},
+			want:  []string{"***", "\r"},
+		},
+		{
+			name:  "pasted password",
+			steps: []echoStep{in("s3cret\r"), out("\r\n$ ")},
+			want:  []string{"******\r"},
+		},
+		{
+			name:  "split echo",
+			steps: []echoStep{in("abc"), out("a"), out("bc"), in("\r"), out("\r\n")},
+			want:  []string{"abc", "\r"},
+		},
+		{
+			name:  "split character",
+			steps: []echoStep{in("é"), out("\xc3"), out("\xa9")},
+			want:  []string{"é"},
+		},
+		{
+			name:  "partly echoed",
+			steps: []echoStep{in("abcd"), out("ab"), out("\r\n")},
+			want:  []string{"ab**"},
+		},
+		{
+			name: "ctrl+u with echo",
+			steps: []echoStep{in("ls"), out("ls"), in("\x15"), out("\r\x1b[K$ "), in("pwd"), out("pwd"),
+				in("\r"), out("\r\n/root\r\n")},
+			want: []string{"ls", "\x15", "pwd", "\r"},
+		},
+		{
+			name:  "ctrl+u pasted with echo",
+			steps: []echoStep{in("ab\x15cd"), out("ab"), out("\r\x1b[K$ "), out("cd")},
+			want:  []string{"ab\x15cd"},
+		},
+		{
+			name:  "ctrl+u without echo",
+			steps: []echoStep{out("Password: "), in("wrong"), in("\x15"), in("secret"), in("\r"), out("\r\n")},
+			want:  []string{"*****", "\x15", "******", "\r"},
+		},
+		{
+			name:  "arrow keys",
+			steps: []echoStep{in("\x1b[A"), out("ls"), in("x"), out("x")},
+			want:  []string{"\x1b[A", "x"},
+		},
+		{
+			name:  "no output after the input",
+			steps: []echoStep{in("secret")},
+			want:  []string{"******"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g commandGuard
+			var got []string
+			record := func(events []inputEvent) {
+				for i := range events {
+					got = append(got, string(events[i].data()))
+				}
+			}
+			for _, s := range tt.steps {
+				if s.in != "" {
+					record(g.input([]byte(s.in)))
+					continue
+				}
+				record(g.output([]byte(s.out)))
+			}
+			record(g.flushInput())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("input = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/storage"
+)
+
+var (
+	ErrReplayNotFound = errors.New("replay not found")
+	ErrInvalidReplay  = errors.New("invalid replay name")
+	ErrReplayTooLarge = errors.New("replay is too large to play")
+
+	// the events are kept in memory to seek back, so the larger replays are refused,
+	// it applies to the downloaded and the decompressed size
+	replayMaxPlaySize int64 = 256 << 20
+)
+
+const (
+	replaySeekSeconds = 5
+	replayMaxSpeed    = 16
+	replayMinSpeed    = 1.0 / 16
+
+	// the separator of the fields in the names of the replays, which is never in the names of users and assets.
+	// The replays recorded before are separated by _, which may be in the names as well.
+	replayFieldSep       = "~"
+	replayLegacyFieldSep = "_"
+
+	// restore the screen of the admin after the replay
+	replayResetScreen = "\x1b[?1049l\x1b[0m\x1b[?25h"
+	replayClearScreen = "\x1b[H\x1b[2J\x1b[3J"
+)
+
+// ReplayFile is a recording under the replay folder, the name is DATE/FILENAME
+type ReplayFile struct {
+	Name  string
+	User  string
+	Asset string
+	Date  time.Time
+	Size  int64
+
+	// all possible users and assets of a legacy name, the first one is User and Asset
+	owners []replayOwner
+}
+
+type replayOwner struct {
+	user  string
+	asset string
+}
+
+func (rf *ReplayFile) matchUser(user string) bool {
+	for _, o := range rf.owners {
+		if o.user == user {
+			return true
+		}
+	}
+	return false
+}
+
+func (rf *ReplayFile) matchAsset(asset string) bool {
+	for _, o := range rf.owners {
+		if o.asset == asset {
+			return true
+		}
+	}
+	return false
+}
+
+// ListReplays returns the recordings between from and to, the newest first. A legacy name which
+// can be split in several ways is matched by any of them, and split at the first _ in the result.
+// The replays in the replay folder are listed with the ones in the storage.
+func ListReplays(user, asset string, from, to time.Time) ([]ReplayFile, error) {
+	objects, err := storage.NewLocalStorage(config.GetConf().ReplayFolderPath).List()
+	if err != nil {
+		return nil, err
+	}
+	if st := getReplayStorage(); st.TypeName() != storage.TypeLocal {
+		remote, err := st.List()
+		if err != nil {
+			return nil, fmt.Errorf("list replays of %s: %s", st.TypeName(), err)
+		}
+		objects = append(objects, remote...)
+	}
+	res := make([]ReplayFile, 0, len(objects))
+	seen := make(map[string]bool, len(objects))
+	for _, v := range objects {
+		dir, filename := path.Split(v.Target)
+		day, err := time.ParseInLocation(dateTimeFormat, strings.TrimSuffix(dir, "/"), time.Local)
+		if err != nil || seen[v.Target] {
+			continue
+		}
+		rf, ok := parseReplayFilename(day, filename)
+		if !ok {
+			continue
+		}
+		if user != "" && !rf.matchUser(user) {
+			continue
+		}
+		if asset != "" && !rf.matchAsset(asset) {
+			continue
+		}
+		if (!from.IsZero() && rf.Date.Before(from)) || (!to.IsZero() && rf.Date.After(to)) {
+			continue
+		}
+		seen[v.Target] = true
+		rf.Name = v.Target
+		rf.Size = v.Size
+		res = append(res, rf)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Date.After(res[j].Date)
+	})
+	return res, nil
+}
+
+// parseReplayFilename parses USER~ASSET~HHMMSS~SID.cast[.gz], or the legacy USER_ASSET_HHMMSS_SID.cast[.gz]
+func parseReplayFilename(day time.Time, name string) (ReplayFile, bool) {
+	base := strings.TrimSuffix(name, replayGzFilenameSuffix)
+	if !strings.HasSuffix(base, replayFilenameSuffix) {
+		return ReplayFile{}, false
+	}
+	base = strings.TrimSuffix(base, replayFilenameSuffix)
+	var parts []string
+	var owners []replayOwner
+	if strings.Contains(base, replayFieldSep) {
+		if parts = strings.Split(base, replayFieldSep); len(parts) != 4 {
+			return ReplayFile{}, false
+		}
+		owners = []replayOwner{{parts[0], parts[1]}}
+	} else {
+		if parts = strings.Split(base, replayLegacyFieldSep); len(parts) < 4 {
+			return ReplayFile{}, false
+		}
+		for i := 1; i < len(parts)-2; i++ {
+			owners = append(owners, replayOwner{
+				user:  strings.Join(parts[:i], replayLegacyFieldSep),
+				asset: strings.Join(parts[i:len(parts)-2], replayLegacyFieldSep),
+			})
+		}
+	}
+	clock, err := time.Parse("150405", parts[len(parts)-2])
+	if err != nil {
+		return ReplayFile{}, false
+	}
+	date := day.Add(time.Duration(clock.Hour())*time.Hour +
+		time.Duration(clock.Minute())*time.Minute + time.Duration(clock.Second())*time.Second)
+	return ReplayFile{
+		User:   owners[0].user,
+		Asset:  owners[0].asset,
+		Date:   date,
+		owners: owners,
+	}, true
+}
+
+// openReplay reads the recording by its name in the list, a session still alive has no .gz yet
+func openReplay(name string) (*common.Header, []common.Event, error) {
+	if !strings.HasSuffix(name, replayFilenameSuffix) &&
+		!strings.HasSuffix(name, replayFilenameSuffix+replayGzFilenameSuffix) {
+		return nil, nil, ErrInvalidReplay
+	}
+	// the name must stay under the replay folder
+	name = path.Clean("/" + name)[1:]
+	var r io.Reader
+	f, err := os.Open(filepath.Join(config.GetConf().ReplayFolderPath, filepath.FromSlash(name)))
+	switch {
+	case err == nil:
+		defer f.Close()
+		if fi, err := f.Stat(); err == nil && fi.Size() > replayMaxPlaySize {
+			return nil, nil, ErrReplayTooLarge
+		}
+		r = f
+	case !os.IsNotExist(err):
+		return nil, nil, err
+	default:
+		// the replay is removed from the replay folder after it is uploaded
+		st := getReplayStorage()
+		if st.TypeName() == storage.TypeLocal {
+			return nil, nil, ErrReplayNotFound
+		}
+		var buf bytes.Buffer
+		if err = st.Download(name, &replayLimit{w: &buf}); err != nil {
+			return nil, nil, fmt.Errorf("download replay from %s: %s", st.TypeName(), err)
+		}
+		r = &buf
+	}
+	if strings.HasSuffix(name, replayGzFilenameSuffix) {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	lr := &replayLimit{r: r}
+	header, events, err := common.ReadRecording(lr)
+	if lr.n > replayMaxPlaySize {
+		return nil, nil, ErrReplayTooLarge
+	}
+	return header, events, err
+}
+
+// replayLimit fails the reads or the writes over replayMaxPlaySize
+type replayLimit struct {
+	r io.Reader
+	w io.Writer
+	n int64
+}
+
+func (l *replayLimit) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > replayMaxPlaySize {
+		return n, ErrReplayTooLarge
+	}
+	return n, err
+}
+
+func (l *replayLimit) Write(p []byte) (int, error) {
+	l.n += int64(len(p))
+	if l.n > replayMaxPlaySize {
+		return 0, ErrReplayTooLarge
+	}
+	return l.w.Write(p)
+}
+
+// PlayReplay plays the recording in the terminal of conn. Space pauses, the left and right keys
+// seek, the up and down keys change the speed, q or Ctrl+] stops the replay.
+func PlayReplay(name string, conn UserConnection) error {
+	header, events, err := openReplay(name)
+	if err != nil {
+		return err
+	}
+	output := make([]common.Event, 0, len(events))
+	for _, ev := range events {
+		if ev.Code == "o" {
+			output = append(output, ev)
+		}
+	}
+	var duration float64
+	if len(output) > 0 {
+		duration = output[len(output)-1].Time
+	}
+
+	win := conn.Pty().Window
+	msg := fmt.Sprintf("Replay %s, %s, %dx%d. Space to pause, Left/Right to seek %ds, Up/Down to change speed, q to quit",
+		name, time.Duration(duration*float64(time.Second)).Round(time.Second), header.Width, header.Height, replaySeekSeconds)
+	common.IgnoreErrWriteString(conn, common.WrapperString(msg, common.Green)+common.CharNewLine)
+	if win.Width < header.Width || win.Height < header.Height {
+		common.IgnoreErrWriteString(conn, common.WrapperWarn(fmt.Sprintf(
+			"The terminal %dx%d is smaller than the recording, try to resize it", win.Width, win.Height))+common.CharNewLine)
+	}
+	time.Sleep(time.Second)
+	// ask the terminal to use the size of the recording, and restore it at last
+	resize := func(w, h int) {
+		if w > 0 && h > 0 {
+			common.IgnoreErrWriteString(conn, fmt.Sprintf("\x1b[8;%d;%dt", h, w))
+		}
+	}
+	resize(header.Width, header.Height)
+	common.IgnoreErrWriteString(conn, replayClearScreen)
+	defer resize(win.Width, win.Height)
+
+	keys := make(chan []byte)
+	leave := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		defer close(leave)
+		buf := make([]byte, 64)
+		for {
+			nr, err := conn.Read(buf)
+			if nr > 0 {
+				select {
+				case keys <- append([]byte(nil), buf[:nr]...):
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		// reset the reader of the connection, the same as Bridge does
+		close(stop)
+		_ = conn.Close()
+		<-leave
+	}()
+
+	p := &replayPlayer{conn: conn, events: output, speed: 1}
+	err = p.play(keys, leave)
+	common.IgnoreErrWriteString(conn, replayResetScreen+common.CharNewLine)
+	if err == nil {
+		common.IgnoreErrWriteString(conn, common.WrapperString("The replay has ended", common.Green)+common.CharNewLine)
+	}
+	return err
+}
+
+type replayPlayer struct {
+	conn   UserConnection
+	events []common.Event
+
+	pos    int     // the next event to write
+	clock  float64 // the time of the recording played
+	speed  float64
+	paused bool
+}
+
+func (p *replayPlayer) play(keys <-chan []byte, leave <-chan struct{}) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for p.pos < len(p.events) {
+		var wait <-chan time.Time
+		start := time.Now()
+		if !p.paused {
+			d := time.Duration((p.events[p.pos].Time - p.clock) / p.speed * float64(time.Second))
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(d)
+			wait = timer.C
+		}
+		select {
+		case <-wait:
+			p.clock = p.events[p.pos].Time
+			if _, err := io.WriteString(p.conn, p.events[p.pos].Data); err != nil {
+				return err
+			}
+			p.pos++
+		case key := <-keys:
+			if !p.paused {
+				p.clock += time.Since(start).Seconds() * p.speed
+				if p.clock > p.events[p.pos].Time {
+					p.clock = p.events[p.pos].Time
+				}
+			}
+			if !p.handleKey(key) {
+				return nil
+			}
+		case <-leave:
+			return nil
+		case <-p.conn.Context().Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// handleKey returns false if the replay is stopped
+func (p *replayPlayer) handleKey(key []byte) bool {
+	switch {
+	case bytes.Equal(key, []byte{' '}):
+		p.paused = !p.paused
+	case bytes.Equal(key, []byte("\x1b[C")), bytes.Equal(key, []byte("\x1bOC")):
+		p.seek(p.clock + replaySeekSeconds)
+	case bytes.Equal(key, []byte("\x1b[D")), bytes.Equal(key, []byte("\x1bOD")):
+		p.seek(p.clock - replaySeekSeconds)
+	case bytes.Equal(key, []byte("\x1b[A")), bytes.Equal(key, []byte("\x1bOA")):
+		if p.speed < replayMaxSpeed {
+			p.speed *= 2
+		}
+	case bytes.Equal(key, []byte("\x1b[B")), bytes.Equal(key, []byte("\x1bOB")):
+		if p.speed > replayMinSpeed {
+			p.speed /= 2
+		}
+	case bytes.IndexByte(key, 'q') >= 0, bytes.IndexByte(key, detachKey) >= 0,
+		bytes.IndexByte(key, 0x03) >= 0:
+		return false
+	}
+	return true
+}
+
+// seek redraws the screen at the time, a backward seek replays the output from the start
+func (p *replayPlayer) seek(ts float64) {
+	if ts < 0 {
+		ts = 0
+	}
+	var buf bytes.Buffer
+	if ts < p.clock {
+		buf.WriteString(replayResetScreen + replayClearScreen)
+		p.pos = 0
+	}
+	for p.pos < len(p.events) && p.events[p.pos].Time <= ts {
+		buf.WriteString(p.events[p.pos].Data)
+		p.pos++
+	}
+	p.clock = ts
+	common.IgnoreErrWriteString(p.conn, buf.String())
+}
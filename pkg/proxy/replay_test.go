@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/handewo/gojump/pkg/config"
+)
+
+func TestOpenReplaySizeLimit(t *testing.T) {
+	defer func(n int64) { replayMaxPlaySize = n }(replayMaxPlaySize)
+	replayMaxPlaySize = 1024
+	defer func(c *config.Config) { config.GlobalConfig = c }(config.GlobalConfig)
+	dir := t.TempDir()
+	config.GlobalConfig = &config.Config{ReplayFolderPath: dir}
+
+	recording := func(events int) []byte {
+		var b strings.Builder
+		b.WriteString(`{"version": 2, "width": 80, "height": 24, "timestamp": 1760000000}` + "\n")
+		for i := 0; i < events; i++ {
+			b.WriteString(`[0.5, "o", "0123456789"]` + "\n")
+		}
+		return []byte(b.String())
+	}
+	gz := func(p []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(p)
+		_ = w.Close()
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name   string
+		data   []byte
+		events int
+		err    error
+	}{
+		{"small.cast", recording(3), 3, nil},
+		{"small.cast.gz", gz(recording(3)), 3, nil},
+		{"large.cast", recording(100), 0, ErrReplayTooLarge},
+		// the compressed file is under the limit, but not the recording
+		{"large.cast.gz", gz(recording(100)), 0, ErrReplayTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(filepath.Join(dir, tt.name), tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, events, err := openReplay(tt.name)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if len(events) != tt.events {
+				t.Errorf("%d events, want %d", len(events), tt.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/storage"
+)
+
+const (
+	DiskFullDisableRecorder = "disable_recorder"
+	DiskFullRefuse          = "refuse"
+
+	replayCleanInterval     = time.Hour
+	replayDiskCheckInterval = time.Minute
+	replayProbeFilename     = ".gojump-probe"
+)
+
+var ErrReplayVolumeFull = errors.New("the replay volume is full")
+
+var (
+	// replayVolumeFull is 1 if REPLAY_PATH is short of space or can not be written
+	replayVolumeFull int32
+
+	cleanReplaysLock sync.Mutex
+)
+
+func isReplayVolumeFull() bool {
+	return atomic.LoadInt32(&replayVolumeFull) == 1
+}
+
+func setReplayVolumeFull(full bool, reason string) bool {
+	var v int32
+	if full {
+		v = 1
+	}
+	if atomic.SwapInt32(&replayVolumeFull, v) == v {
+		return false
+	}
+	if full {
+		log.Error.Printf("Replay volume is full: %s, action: %s", reason, config.GetConf().ReplayDiskFullAction)
+	} else {
+		log.Info.Print("Replay volume is writable again")
+	}
+	return true
+}
+
+// checkReplayVolume returns ErrReplayVolumeFull if new sessions are refused when the volume is full
+func checkReplayVolume() error {
+	conf := config.GetConf()
+	if conf.DisableRecorder || conf.ReplayDiskFullAction != DiskFullRefuse {
+		return nil
+	}
+	if isReplayVolumeFull() {
+		return ErrReplayVolumeFull
+	}
+	return nil
+}
+
+// RunReplayJanitor removes the expired replays every hour, and checks the volume of the replays every minute
+func RunReplayJanitor(c *core.Core) {
+	go func() {
+		for {
+			if checkReplayDisk() {
+				cleanReplays(c)
+			}
+			time.Sleep(replayDiskCheckInterval)
+		}
+	}()
+	for {
+		cleanReplays(c)
+		time.Sleep(replayCleanInterval)
+	}
+}
+
+// checkReplayDisk warns if the volume is almost full, and returns true if it becomes full
+func checkReplayDisk() bool {
+	conf := config.GetConf()
+	if conf.DisableRecorder {
+		return false
+	}
+	root := conf.ReplayFolderPath
+	if err := common.EnsureDirExist(root); err != nil {
+		return setReplayVolumeFull(true, err.Error())
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(root, &st); err != nil {
+		log.Error.Printf("Stat replay volume %s failed: %s", root, err)
+	} else {
+		total := st.Blocks * uint64(st.Bsize)
+		free := st.Bavail * uint64(st.Bsize)
+		if total > 0 {
+			used := int((total - free) * 100 / total)
+			if conf.ReplayDiskWarnPercent > 0 && used >= conf.ReplayDiskWarnPercent {
+				log.Warning.Printf("Replay volume %s is %d%% used, %d MB free", root, used, free>>20)
+			}
+		}
+		if conf.ReplayDiskMinFree > 0 && free < uint64(conf.ReplayDiskMinFree)<<20 {
+			return setReplayVolumeFull(true, fmt.Sprintf("%d MB free", free>>20))
+		}
+	}
+	probe := filepath.Join(root, replayProbeFilename)
+	if err := os.WriteFile(probe, []byte("gojump"), 0600); err != nil {
+		return setReplayVolumeFull(true, err.Error())
+	}
+	_ = os.Remove(probe)
+	setReplayVolumeFull(false, "")
+	return false
+}
+
+// cleanReplays removes the replays over the days to keep, then the oldest ones over REPLAY_MAX_SIZE.
+// The replays kept forever by users or nodes are never removed. The limits are applied to REPLAY_PATH
+// as well if the replays are uploaded, where the ones failed to upload are left.
+func cleanReplays(c *core.Core) {
+	cleanReplaysLock.Lock()
+	defer cleanReplaysLock.Unlock()
+	conf := config.GetConf()
+	retention, err := c.GetReplayRetention()
+	if err != nil {
+		log.Error.Printf("Get replay retention failed: %s", err)
+		return
+	}
+	if conf.ReplayKeepDays <= 0 && conf.ReplayMaxSize <= 0 && !retention.HasLimit() {
+		return
+	}
+	st := getReplayStorage()
+	cleanStorageReplays(c, st, retention)
+	if st.TypeName() != storage.TypeLocal {
+		cleanStorageReplays(c, storage.NewLocalStorage(conf.ReplayFolderPath), retention)
+	}
+}
+
+func cleanStorageReplays(c *core.Core, st storage.ReplayStorage, retention *core.ReplayRetention) {
+	conf := config.GetConf()
+	// the local replays are left to upload if the storage is not the one they are recorded in,
+	// the ones being uploaded are skipped
+	leftover := st.TypeName() == storage.TypeLocal && getReplayStorage().TypeName() != storage.TypeLocal
+	objects, err := st.List()
+	if err != nil {
+		log.Error.Printf("List replays of %s failed: %s", st.TypeName(), err)
+		return
+	}
+	replays := make([]ReplayFile, 0, len(objects))
+	for _, v := range objects {
+		if !strings.HasSuffix(v.Target, replayFilenameSuffix+replayGzFilenameSuffix) {
+			continue
+		}
+		if _, ok := uploadingReplays.Load(v.Target); ok && leftover {
+			continue
+		}
+		dir, filename := path.Split(v.Target)
+		day, err := time.ParseInLocation(dateTimeFormat, strings.TrimSuffix(dir, "/"), time.Local)
+		if err != nil {
+			continue
+		}
+		rf, ok := parseReplayFilename(day, filename)
+		if !ok {
+			continue
+		}
+		rf.Name = v.Target
+		rf.Size = v.Size
+		replays = append(replays, rf)
+	}
+	sort.Slice(replays, func(i, j int) bool {
+		return replays[i].Date.Before(replays[j].Date)
+	})
+
+	now := time.Now()
+	var total, removedSize int64
+	removed := 0
+	kept := make([]ReplayFile, 0, len(replays))
+	for _, rf := range replays {
+		days := replayKeepDays(retention, &rf, conf.ReplayKeepDays)
+		if days > 0 && rf.Date.Before(now.AddDate(0, 0, -days)) {
+			if removeReplay(st, rf, conf.ReplayArchivePath) {
+				removed++
+				removedSize += rf.Size
+				continue
+			}
+		}
+		total += rf.Size
+		if days >= 0 {
+			kept = append(kept, rf)
+		}
+	}
+	if limit := conf.ReplayMaxSize << 20; limit > 0 {
+		for _, rf := range kept {
+			if total <= limit {
+				break
+			}
+			if removeReplay(st, rf, conf.ReplayArchivePath) {
+				removed++
+				removedSize += rf.Size
+				total -= rf.Size
+			}
+		}
+		if total > limit {
+			log.Warning.Printf("Replays are %d MB over REPLAY_MAX_SIZE, the rest are kept forever", (total-limit)>>20)
+		}
+	}
+	if removed == 0 {
+		return
+	}
+	action := "delete"
+	if conf.ReplayArchivePath != "" {
+		action = "archive"
+	}
+	where := st.TypeName()
+	if leftover {
+		where = "local folder " + conf.ReplayFolderPath
+	}
+	msg := fmt.Sprintf("%s %d replays of %s in %s", action, removed, common.FormatSize(removedSize), where)
+	log.Info.Print(msg)
+	c.InsertLog("replay", "janitor", msg)
+}
+
+// replayKeepDays returns the days to keep the replay. A legacy name which can be split in several ways
+// is kept the longest days of them, so the replays of the users kept forever are never removed.
+func replayKeepDays(r *core.ReplayRetention, rf *ReplayFile, def int) int {
+	res := 0
+	for i, o := range rf.owners {
+		days := r.KeepDays(o.user, o.asset, def)
+		switch {
+		case days < 0:
+			return -1
+		case days == 0:
+			res = 0
+		case i == 0 || (res > 0 && days > res):
+			res = days
+		}
+	}
+	return res
+}
+
+// removeReplay deletes the replay from the storage, it's moved to the archive folder first if archive is set
+func removeReplay(st storage.ReplayStorage, rf ReplayFile, archive string) bool {
+	if archive != "" {
+		if err := archiveReplay(st, rf.Name, archive); err != nil {
+			log.Error.Printf("Archive replay %s failed: %s", rf.Name, err)
+			return false
+		}
+	}
+	if err := st.Delete(rf.Name); err != nil {
+		log.Error.Printf("Delete replay %s from %s failed: %s", rf.Name, st.TypeName(), err)
+		return false
+	}
+	if st.TypeName() == storage.TypeLocal {
+		// remove the folder of the date if it is empty
+		_ = os.Remove(filepath.Join(config.GetConf().ReplayFolderPath, filepath.FromSlash(path.Dir(rf.Name))))
+	}
+	log.Debug.Printf("Remove replay %s recorded at %s", rf.Name, rf.Date.Format(common.LogFormat))
+	return true
+}
+
+func archiveReplay(st storage.ReplayStorage, target, archive string) error {
+	dst := filepath.Join(archive, filepath.FromSlash(target))
+	if err := common.EnsureDirExist(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = st.Download(target, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -147,10 +147,22 @@ func (s *Server) Proxy() {
 		common.IgnoreErrWriteString(s.UserConn, common.CharNewLine)
 		return
 	}
+	if err := checkReplayVolume(); err != nil {
+		log.Error.Printf("Conn[%s]: refuse session to %s, %s", s.UserConn.ID()[:8], s.connOpts.asset.Name, err)
+		common.IgnoreErrWriteString(s.UserConn, common.WrapperWarn("The session can not be recorded, please contact the administrator"))
+		common.IgnoreErrWriteString(s.UserConn, common.CharNewLine)
+		return
+	}
 	if !s.checkLoginConfirm() {
 		log.Info.Printf("Conn[%s]: check login confirm failed", s.UserConn.ID()[:8])
 		return
 	}
+	guard, err := s.newCommandGuard()
+	if err != nil {
+		log.Error.Printf("Conn[%s] load command filters err: %s", s.UserConn.ID()[:8], err)
+		common.IgnoreErrWriteString(s.UserConn, common.WrapperWarn("Load command filters failed"))
+		return
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	sw := SwitchSession{
 		ID:            s.ID,
@@ -159,6 +171,8 @@ func (s *Server) Proxy() {
 		ctx:           ctx,
 		cancel:        cancel,
 		p:             s,
+		share:         newSessionShare(),
+		guard:         guard,
 	}
 	if err := s.CreateSessionCallback(); err != nil {
 		msg := "Connect server failed"
@@ -192,6 +206,10 @@ func (s *Server) Proxy() {
 		log.Error.Printf("Conn[%s] update session %s err: %s", s.UserConn.ID()[:8], s.ID[:8], err2)
 	}
 	common.IgnoreErrWriteWindowTitle(s.UserConn, s.connOpts.TerminalTitle())
+	if s.terminalConf.EnableSessionShare {
+		msg := fmt.Sprintf("Session ID %s, others can join with it after your approval", s.ID)
+		common.IgnoreErrWriteString(s.UserConn, common.WrapperString(msg, common.Green)+common.CharNewLine)
+	}
 	if err = sw.Bridge(s.UserConn, srvCon); err != nil {
 		log.Error.Print(err)
 	}
@@ -216,7 +234,7 @@ func (s *Server) sendConnectErrorMsg(err error) {
 	common.IgnoreErrWriteString(s.UserConn, common.CharNewLine)
 	log.Error.Print(msg)
 	password := s.connOpts.systemUser.Password
-	if password != "" {
+	if password != "" && !common.IsEncryptedSecret(password) {
 		msg2 := fmt.Sprintf("Try password: %s", password[:2]+strings.Repeat("*", 8))
 		log.Info.Print(msg2)
 	}
@@ -316,11 +334,35 @@ func (s *Server) getServerConn(proxyAddr *net.TCPAddr) (srvconn.ServerConnection
 }
 
 func (s *Server) getSSHConn() (srvConn *srvconn.SSHConnection, err error) {
-	loginSystemUser := s.connOpts.systemUser
+	// the rotated secrets on the asset replace the ones of the system user
+	loginSystemUser := *s.connOpts.systemUser
+	if err = s.core.ApplyAssetSecret(s.connOpts.asset.ID, &loginSystemUser); err != nil {
+		log.Error.Printf("Get secret of system user %s err: %s", loginSystemUser.Username, err)
+		return nil, err
+	}
 	key := srvconn.MakeReuseSSHClientKey(s.connOpts.user.ID, s.connOpts.asset.ID, loginSystemUser.ID,
 		s.connOpts.asset.IP, loginSystemUser.Username)
-	sshAuthOpts := srvconn.BuildSSHClientOptions(s.connOpts.asset, loginSystemUser)
-	password := loginSystemUser.Password
+	routes, err := s.core.GetAssetGatewayRoutes(s.connOpts.asset.ID)
+	if err != nil {
+		log.Error.Printf("Get gateways of asset %s err: %s", s.connOpts.asset.Name, err)
+		return nil, err
+	}
+	gateways, err := srvconn.BuildGatewayOptions(routes, s.core.GatewayHostKeyCallback(s.connOpts.user.Username))
+	if err != nil {
+		log.Error.Printf("Build gateway options err: %s", err)
+		return nil, err
+	}
+	sshAuthOpts, err := srvconn.BuildSSHClientOptions(s.connOpts.asset, &loginSystemUser, gateways...)
+	if err != nil {
+		log.Error.Printf("Build ssh client options err: %s", err)
+		return nil, err
+	}
+	// the password answers the keyboard interactive questions
+	password, err := common.DecryptSecret(loginSystemUser.Password)
+	if err != nil {
+		log.Error.Printf("Decrypt password of system user %s err: %s", loginSystemUser.Username, err)
+		return nil, err
+	}
 	privateKey := loginSystemUser.PrivateKey
 	kb := srvconn.SSHClientKeyboardAuth(func(user, instruction string,
 		questions []string, echos []bool) (answers []string, err error) {
@@ -348,6 +390,8 @@ func (s *Server) getSSHConn() (srvConn *srvconn.SSHConnection, err error) {
 		return ans, nil
 	})
 	sshAuthOpts = append(sshAuthOpts, kb)
+	sshAuthOpts = append(sshAuthOpts, srvconn.SSHClientHostKeyCallback(
+		s.core.AssetHostKeyCallback(s.connOpts.asset, s.connOpts.user.Username)))
 	sshClient, err := srvconn.NewSSHClient(sshAuthOpts...)
 	if err != nil {
 		log.Error.Printf("Get new ssh client err: %s", err)
@@ -484,6 +528,9 @@ func (s *Server) ConvertErrorToReadableMsg(e error) string {
 	if strings.Contains(errMsg, "unable to authenticate") || strings.Contains(errMsg, "failed login") {
 		return "Authentication failed"
 	}
+	if strings.Contains(errMsg, core.ErrHostKeyMismatch.Error()) {
+		return "Host key verification failed"
+	}
 	if strings.Contains(errMsg, "connection refused") {
 		return "Connection refused"
 	}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/core"
+)
+
+// QueryAliveSessions returns the rows of alive sessions ordered by start time
+func QueryAliveSessions() []string {
+	sessions := make([]aliveSession, 0, 10)
+	for _, id := range GetAliveSessions() {
+		if sess, ok := sessManager.Get(id); ok {
+			sessions = append(sessions, sess)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].sessionInfo().DateStart.Before(sessions[j].sessionInfo().DateStart)
+	})
+
+	res := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		info := sess.sessionInfo()
+		s := fmt.Sprintf("%8s|%10s|%20s|%10s|%8s|%21s|%s|%9s|%d", sess.SessionID()[:8], info.User, info.Asset,
+			info.SystemUser, info.Protocol, info.RemoteAddr, info.DateStart.Format(common.LogFormat),
+			sess.IdleTime().Round(time.Second), sess.observerCount())
+		res = append(res, s)
+	}
+	return res
+}
+
+// KillSession terminates the alive session whose id starts with the prefix
+func KillSession(c *core.Core, sessionID string, admin string) error {
+	sess, err := findAliveSession(sessionID)
+	if err != nil {
+		return err
+	}
+	sess.Terminate(admin)
+	info := sess.sessionInfo()
+	msg := fmt.Sprintf("kill session %s of %s on %s", sess.SessionID()[:8], info.User, info.Asset)
+	c.InsertLog("admin", admin, msg)
+	c.Publish(core.Event{Type: core.EventSessionTerminated, User: info.User, Asset: info.Asset,
+		Message: fmt.Sprintf("%s %s", admin, msg)})
+	return nil
+}
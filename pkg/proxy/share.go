@@ -0,0 +1,325 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+)
+
+var (
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrSessionAmbiguous  = errors.New("session id matches more than one session")
+	ErrShareDisabled     = errors.New("session share is disabled")
+	ErrJoinRejected      = errors.New("the owner rejected the request")
+	ErrJoinFullID        = errors.New("the full session id is required to join")
+	ErrSessionNoTerminal = errors.New("the session has no terminal to share")
+)
+
+const (
+	// Ctrl+], the same as telnet
+	detachKey = 0x1d
+
+	joinConfirmTimeout = time.Minute
+	observerBufferSize = 256
+)
+
+// observer receives the output of a session, a co-driver also writes to the session
+type observer struct {
+	id       string
+	username string
+	writable bool
+	output   chan []byte
+}
+
+type joinRequest struct {
+	username string
+	deadline time.Time
+	result   chan bool
+
+	// the owner is typing the answer after Ctrl+]
+	answering bool
+	answer    []byte
+}
+
+func (r *joinRequest) prompt() string {
+	return fmt.Sprintf("%s requests to join this session as co-driver, press Ctrl+] and then answer y to accept",
+		r.username)
+}
+
+// feed reads the answer of the owner, which starts with Ctrl+] and ends with Enter, so the ordinary
+// typing is never taken as the answer. It returns the input which is not a part of the answer.
+func (r *joinRequest) feed(p []byte, w io.Writer) (rest []byte, done bool, accepted bool) {
+	rest = make([]byte, 0, len(p))
+	for i, b := range p {
+		if !r.answering {
+			if b == detachKey {
+				r.answering = true
+				r.answer = r.answer[:0]
+				common.IgnoreErrWriteString(w, common.CharNewLine+fmt.Sprintf("Accept %s as co-driver? (y/n): ", r.username))
+				continue
+			}
+			rest = append(rest, b)
+			continue
+		}
+		switch b {
+		case '\r', '\n':
+			answer := strings.ToLower(strings.TrimSpace(string(r.answer)))
+			common.IgnoreErrWriteString(w, common.CharNewLine)
+			return append(rest, p[i+1:]...), true, answer == "y" || answer == "yes"
+		case 0x03:
+			// Ctrl+C leaves the answer for later
+			r.answering = false
+			common.IgnoreErrWriteString(w, common.CharNewLine+common.WrapperWarn(r.prompt()))
+		case 0x7f, 0x08:
+			if len(r.answer) > 0 {
+				r.answer = r.answer[:len(r.answer)-1]
+				common.IgnoreErrWriteString(w, "\b \b")
+			}
+		default:
+			if b >= 0x20 && b < 0x7f && len(r.answer) < 8 {
+				r.answer = append(r.answer, b)
+				_, _ = w.Write([]byte{b})
+			}
+		}
+	}
+	return rest, false, false
+}
+
+type sessionShare struct {
+	sync.Mutex
+	observers map[string]*observer
+	closed    bool
+
+	input    chan []byte
+	requests chan *joinRequest
+	// closed when the session ends
+	done chan struct{}
+}
+
+func newSessionShare() *sessionShare {
+	return &sessionShare{
+		observers: make(map[string]*observer),
+		input:     make(chan []byte),
+		requests:  make(chan *joinRequest),
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *sessionShare) add(o *observer) bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return false
+	}
+	s.observers[o.id] = o
+	return true
+}
+
+func (s *sessionShare) remove(id string) {
+	s.Lock()
+	defer s.Unlock()
+	if o, ok := s.observers[id]; ok {
+		delete(s.observers, id)
+		close(o.output)
+	}
+}
+
+// broadcast never blocks the session, slow observers lose output
+func (s *sessionShare) broadcast(p []byte) {
+	s.Lock()
+	defer s.Unlock()
+	for _, o := range s.observers {
+		select {
+		case o.output <- p:
+		default:
+			log.Debug.Printf("Observer %s of session is too slow, drop output", o.username)
+		}
+	}
+}
+
+func (s *sessionShare) closeAll() {
+	s.Lock()
+	defer s.Unlock()
+	if !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	for id, o := range s.observers {
+		delete(s.observers, id)
+		close(o.output)
+	}
+}
+
+func (s *sessionShare) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.observers)
+}
+
+// requestJoin asks the owner of the session to accept the co-driver
+func (s *SwitchSession) requestJoin(username string) bool {
+	req := &joinRequest{
+		username: username,
+		deadline: time.Now().Add(joinConfirmTimeout),
+		result:   make(chan bool, 1),
+	}
+	select {
+	case s.share.requests <- req:
+	case <-s.share.done:
+		return false
+	case <-time.After(joinConfirmTimeout):
+		return false
+	}
+	select {
+	case ok := <-req.result:
+		return ok
+	case <-s.share.done:
+		return false
+	case <-time.After(time.Until(req.deadline)):
+		return false
+	}
+}
+
+func (s *SwitchSession) writeInput(p []byte) {
+	select {
+	case s.share.input <- p:
+	case <-s.share.done:
+	}
+}
+
+// findAliveSession returns the alive session whose id starts with the prefix
+func findAliveSession(prefix string) (aliveSession, error) {
+	if prefix == "" {
+		return nil, ErrSessionNotFound
+	}
+	var found aliveSession
+	for _, id := range GetAliveSessions() {
+		if !strings.HasPrefix(id, prefix) {
+			continue
+		}
+		if found != nil {
+			return nil, ErrSessionAmbiguous
+		}
+		found, _ = sessManager.Get(id)
+	}
+	if found == nil {
+		return nil, ErrSessionNotFound
+	}
+	return found, nil
+}
+
+// FindSession returns the alive session with terminal whose id starts with the prefix
+func FindSession(prefix string) (*SwitchSession, error) {
+	sess, err := findAliveSession(prefix)
+	if err != nil {
+		return nil, err
+	}
+	sw, ok := sess.(*SwitchSession)
+	if !ok {
+		return nil, ErrSessionNoTerminal
+	}
+	return sw, nil
+}
+
+// ShareSession attaches conn to the session until the session ends or Ctrl+] is pressed.
+// A writable observer is a co-driver, and it must be accepted by the owner of the session.
+func ShareSession(sessionID string, conn UserConnection, username string, writable bool) error {
+	sw, err := FindSession(sessionID)
+	if err != nil {
+		return err
+	}
+	conf, err := sw.p.core.GetTerminalConfig()
+	if err != nil {
+		return err
+	}
+	if !conf.EnableSessionShare {
+		return ErrShareDisabled
+	}
+	info := sw.p.sessionInfo
+	target := fmt.Sprintf("session %s of %s on %s", sw.ID[:8], info.User, info.Asset)
+	action := "monitor"
+	if writable {
+		if sessionID != sw.ID {
+			return ErrJoinFullID
+		}
+		action = "join"
+		common.IgnoreErrWriteString(conn, "Waiting for the owner to accept..."+common.CharNewLine)
+		if !sw.requestJoin(username) {
+			sw.p.core.InsertLog("share", username, fmt.Sprintf("rejected to join %s", target))
+			return ErrJoinRejected
+		}
+	}
+	o := &observer{
+		id:       common.UUID(),
+		username: username,
+		writable: writable,
+		output:   make(chan []byte, observerBufferSize),
+	}
+	if !sw.share.add(o) {
+		return ErrSessionNotFound
+	}
+	defer sw.share.remove(o.id)
+	sw.p.core.InsertLog("share", username, fmt.Sprintf("%s %s", action, target))
+	defer sw.p.core.InsertLog("share", username, fmt.Sprintf("leave %s", target))
+	log.Info.Printf("Session[%s] %s by %s", sw.ID[:8], action, username)
+
+	msg := fmt.Sprintf("Monitoring %s, press Ctrl+] to leave", target)
+	if writable {
+		msg = fmt.Sprintf("Joined %s as co-driver, press Ctrl+] to leave", target)
+	}
+	common.IgnoreErrWriteString(conn, common.WrapperString(msg, common.Green)+common.CharNewLine)
+
+	leave := make(chan struct{})
+	go func() {
+		defer close(leave)
+		buf := make([]byte, 1024)
+		for {
+			nr, err := conn.Read(buf)
+			if nr > 0 {
+				p := buf[:nr]
+				if i := bytes.IndexByte(p, detachKey); i >= 0 {
+					if writable && i > 0 {
+						sw.writeInput(p[:i])
+					}
+					return
+				}
+				if writable {
+					sw.writeInput(append([]byte(nil), p...))
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		// reset the reader of the connection, the same as Bridge does
+		_ = conn.Close()
+		<-leave
+	}()
+	for {
+		select {
+		case p, ok := <-o.output:
+			if !ok {
+				common.IgnoreErrWriteString(conn, common.CharNewLine+
+					common.WrapperWarn("The session has ended"))
+				return nil
+			}
+			if _, err := conn.Write(p); err != nil {
+				return err
+			}
+		case <-leave:
+			common.IgnoreErrWriteString(conn, common.CharNewLine)
+			return nil
+		case <-conn.Context().Done():
+			return nil
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
 	"github.com/handewo/gojump/pkg/srvconn"
 )
 
@@ -25,6 +26,11 @@ type SwitchSession struct {
 	p *Server
 
 	terminateAdmin atomic.Value // 终断会话的管理员名称
+
+	lastActiveTime int64 // unix nano, updated by Bridge
+
+	share *sessionShare
+	guard *commandGuard
 }
 
 func (s *SwitchSession) Terminate(username string) {
@@ -50,6 +56,27 @@ func (s *SwitchSession) SessionID() string {
 	return s.ID
 }
 
+func (s *SwitchSession) sessionInfo() *model.Session {
+	return s.p.sessionInfo
+}
+
+func (s *SwitchSession) observerCount() int {
+	return s.share.count()
+}
+
+func (s *SwitchSession) setLastActiveTime(t time.Time) {
+	atomic.StoreInt64(&s.lastActiveTime, t.UnixNano())
+}
+
+// IdleTime returns how long the session has no input or output
+func (s *SwitchSession) IdleTime() time.Duration {
+	last := atomic.LoadInt64(&s.lastActiveTime)
+	if last == 0 {
+		return time.Since(s.p.sessionInfo.DateStart)
+	}
+	return time.Since(time.Unix(0, last))
+}
+
 // Bridge 桥接两个链接
 func (s *SwitchSession) Bridge(userConn UserConnection, srvConn srvconn.ServerConnection) (err error) {
 
@@ -62,14 +89,19 @@ func (s *SwitchSession) Bridge(userConn UserConnection, srvConn srvconn.ServerCo
 
 	defer func() {
 		close(done)
+		s.share.closeAll()
+		s.guard.close()
 		_ = userConn.Close()
 		_ = srvConn.Close()
+		replayRecorder.RecordInput(s.guard.flushInput()...)
 		replayRecorder.End()
 	}()
+	var pendingJoin *joinRequest
 
 	winCh := userConn.WinCh()
 	maxIdleTime := time.Duration(s.MaxIdleTime) * time.Minute
 	lastActiveTime := time.Now()
+	s.setLastActiveTime(lastActiveTime)
 	tick := time.NewTicker(30 * time.Second)
 	defer tick.Stop()
 
@@ -138,12 +170,23 @@ func (s *SwitchSession) Bridge(userConn UserConnection, srvConn srvconn.ServerCo
 				log.Info.Printf("Session[%s] permission has expired, disconnect", s.ID[:8])
 				return
 			}
+			if pendingJoin != nil {
+				if now.After(pendingJoin.deadline) {
+					pendingJoin = nil
+					common.IgnoreErrWriteString(userConn, common.CharNewLine+
+						common.WrapperWarn("The join request has expired"))
+				} else if !pendingJoin.answering {
+					common.IgnoreErrWriteString(userConn, common.CharNewLine+
+						common.WrapperWarn(pendingJoin.prompt()))
+				}
+			}
 			continue
 			// 手动结束
 		case <-s.ctx.Done():
 			adminUser := s.loadTerminateAdmin()
 			msg := fmt.Sprintf("Terminated by admin %s", adminUser)
 			msg = common.WrapperWarn(msg)
+			common.IgnoreErrWriteString(userConn, common.CharNewLine+msg)
 			log.Info.Printf("Session[%s]: %s", s.ID[:8], msg)
 			return
 			// 监控窗口大小变化
@@ -159,18 +202,50 @@ func (s *SwitchSession) Bridge(userConn UserConnection, srvConn srvconn.ServerCo
 			if !ok {
 				return
 			}
+			replayRecorder.RecordInput(s.guard.output(p)...)
 			replayRecorder.Record(p)
 			if _, err := userConn.Write(p); err != nil {
 				log.Error.Printf("Session[%s] userConn write err: %s", s.ID[:8], err)
 			}
+			s.share.broadcast(p)
 			// 经过parse处理的user数据，发给server
 		case p, ok := <-userChan:
 			if !ok {
 				return
 			}
-			if _, err := srvConn.Write(p); err != nil {
-				log.Error.Printf("Session[%s] srvConn write err: %s", s.ID[:8], err)
+			if pendingJoin != nil {
+				var answered, accepted bool
+				p, answered, accepted = pendingJoin.feed(p, userConn)
+				if answered {
+					pendingJoin.result <- accepted
+					msg := fmt.Sprintf("Rejected %s", pendingJoin.username)
+					if accepted {
+						msg = fmt.Sprintf("%s joined this session", pendingJoin.username)
+					}
+					common.IgnoreErrWriteString(userConn, common.WrapperWarn(msg))
+					pendingJoin = nil
+				}
+				if len(p) == 0 {
+					continue
+				}
+			}
+			replayRecorder.RecordInput(s.guard.input(p)...)
+			s.filterInput(s.guard, p, srvConn)
+		case p := <-s.share.input:
+			replayRecorder.RecordInput(s.guard.input(p)...)
+			s.filterInput(s.guard, p, srvConn)
+		case <-s.guard.echoDone():
+			s.checkCommand(s.guard, userConn, srvConn)
+		case res := <-s.guard.confirmRes:
+			s.finishCommandConfirm(s.guard, res, userConn, srvConn)
+		case req := <-s.share.requests:
+			if pendingJoin != nil {
+				req.result <- false
+				continue
 			}
+			pendingJoin = req
+			common.IgnoreErrWriteString(userConn, common.CharNewLine+common.WrapperWarn(req.prompt()))
+			continue
 
 		case now := <-keepAliveTick.C:
 			if now.After(lastActiveTime.Add(keepAliveTime)) {
@@ -187,13 +262,27 @@ func (s *SwitchSession) Bridge(userConn UserConnection, srvConn srvconn.ServerCo
 			return
 		}
 		lastActiveTime = time.Now()
+		s.setLastActiveTime(lastActiveTime)
 	}
 }
 
 var sessManager = newSessionManager()
 
+// aliveSession is a live session listed by sessions and ended by kill
+type aliveSession interface {
+	SessionID() string
+	IdleTime() time.Duration
+	Terminate(username string)
+	sessionInfo() *model.Session
+	observerCount() int
+}
+
 func GetSessionById(id string) (s *SwitchSession, ok bool) {
-	s, ok = sessManager.Get(id)
+	sess, ok := sessManager.Get(id)
+	if !ok {
+		return nil, false
+	}
+	s, ok = sess.(*SwitchSession)
 	return
 }
 
@@ -211,21 +300,21 @@ func RemoveCommonSwitch(s *SwitchSession) {
 
 func newSessionManager() *sessionManager {
 	return &sessionManager{
-		data: make(map[string]*SwitchSession),
+		data: make(map[string]aliveSession),
 	}
 }
 
 type sessionManager struct {
-	data map[string]*SwitchSession
+	data map[string]aliveSession
 	sync.Mutex
 }
 
-func (s *sessionManager) Add(id string, sess *SwitchSession) {
+func (s *sessionManager) Add(id string, sess aliveSession) {
 	s.Lock()
 	defer s.Unlock()
 	s.data[id] = sess
 }
-func (s *sessionManager) Get(id string) (sess *SwitchSession, ok bool) {
+func (s *sessionManager) Get(id string) (sess aliveSession, ok bool) {
 	s.Lock()
 	defer s.Unlock()
 	sess, ok = s.data[id]
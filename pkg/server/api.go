@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+const (
+	apiPrefix = "/api/v1/"
+
+	apiDefaultLimit = 20
+	apiMaxLimit     = 1000
+	apiMaxBodySize  = 1 << 20
+)
+
+type apiUserKey struct{}
+
+var errAPIMethodNotAllowed = errors.New("method not allowed")
+
+// apiResource maps a table to the RESTful api, nil functions are not allowed.
+type apiResource struct {
+	// the permissions required to read and to write the resource
+	readPerm  string
+	writePerm string
+	list      func(r *http.Request) (interface{}, error)
+	get       func(id string) (interface{}, error)
+	create    func(body []byte, admin string) (interface{}, error)
+	update    func(id string, body []byte, admin string) (interface{}, error)
+	remove    func(id string, admin string) error
+}
+
+func (s *server) GetAPIAddr() string {
+	cf := config.GlobalConfig
+	return net.JoinHostPort(cf.BindHost, cf.APIPort)
+}
+
+func (s *server) initAPIServer() {
+	mux := http.NewServeMux()
+	mux.Handle(apiPrefix, s.apiAuth(http.HandlerFunc(s.apiRouter)))
+	s.apiSrv = &http.Server{
+		Addr:              s.GetAPIAddr(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func (s *server) ServeAPI() {
+	cf := config.GlobalConfig
+	log.Info.Printf("Start API server at %s", s.apiSrv.Addr)
+	var err error
+	if cf.APITLSCert != "" && cf.APITLSKey != "" {
+		err = s.apiSrv.ListenAndServeTLS(cf.APITLSCert, cf.APITLSKey)
+	} else {
+		log.Warning.Print("API server is running without TLS")
+		err = s.apiSrv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal.Print(err)
+	}
+}
+
+func (s *server) ShutdownAPI(ctx context.Context) {
+	if s.apiSrv == nil {
+		return
+	}
+	if err := s.apiSrv.Shutdown(ctx); err != nil {
+		log.Error.Printf("Shutdown API server failed: %s", err)
+	}
+}
+
+// apiAuth accepts "Authorization: Bearer TOKEN" of an active admin user
+func (s *server) apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if token == "" {
+			writeAPIError(w, http.StatusUnauthorized, core.ErrInvalidAPIToken)
+			return
+		}
+		user, err := s.core.AuthenticateAPIToken(token)
+		if err != nil {
+			log.Info.Printf("API request from %s rejected: %s", r.RemoteAddr, err)
+			writeAPIError(w, http.StatusUnauthorized, core.ErrInvalidAPIToken)
+			return
+		}
+		if len(user.AddrWhiteList) > 0 {
+			host, _, _ := net.SplitHostPort(r.RemoteAddr)
+			if !containAddr(user.AddrWhiteList, host) {
+				log.Info.Printf("API user %s's IP[%s] is blocked", user.Username, host)
+				writeAPIError(w, http.StatusForbidden, errors.New("address is not allowed"))
+				return
+			}
+		}
+		log.Debug.Printf("API user %s %s %s", user.Username, r.Method, r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiUserKey{}, user)))
+	})
+}
+
+func containAddr(addrs []string, addr string) bool {
+	for _, v := range addrs {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) apiResources() map[string]apiResource {
+	return map[string]apiResource{
+		"users":    s.apiUserResource(),
+		"assets":   s.apiAssetResource(),
+		"nodes":    s.apiNodeResource(),
+		"sysusers": s.apiSystemUserResource(),
+		"grants":   s.apiGrantResource(),
+		"filters":  s.apiCommandFilterResource(),
+		"gateways": s.apiGatewayResource(),
+		"logs": {readPerm: model.PermAudit, list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetUserLogs()
+		}},
+		"tickets": {readPerm: model.PermReadTicket, list: func(r *http.Request) (interface{}, error) {
+			tickets, err := s.core.GetLoginTickets()
+			if err != nil {
+				return nil, err
+			}
+			state := r.URL.Query().Get("state")
+			if state == "" {
+				return tickets, nil
+			}
+			res := make([]model.LoginTicket, 0, len(tickets))
+			for _, t := range tickets {
+				if t.State == state {
+					res = append(res, t)
+				}
+			}
+			return res, nil
+		}},
+		"sessions": {readPerm: model.PermSession, list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetSessions(), nil
+		}},
+	}
+}
+
+// apiRouter serves /api/v1/RESOURCE and /api/v1/RESOURCE/ID
+func (s *server) apiRouter(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(apiUserKey{}).(model.User)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	res, ok := s.apiResources()[parts[0]]
+	if !ok || len(parts) > 2 {
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	perm := res.readPerm
+	if r.Method != http.MethodGet {
+		perm = res.writePerm
+	}
+	if !model.HasPermission(user.Role, perm) {
+		log.Info.Printf("API user %s(%s) is denied to %s %s", user.Username, user.Role, r.Method, r.URL.Path)
+		writeAPIError(w, http.StatusForbidden, errors.New("permission denied"))
+		return
+	}
+	if len(parts) == 1 {
+		switch {
+		case r.Method == http.MethodGet && res.list != nil:
+			s.apiList(w, r, res)
+		case r.Method == http.MethodPost && res.create != nil:
+			body, err := readAPIBody(w, r)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err)
+				return
+			}
+			v, err := res.create(body, user.Username)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err)
+				return
+			}
+			writeAPIJSON(w, http.StatusCreated, v)
+		default:
+			writeAPIError(w, http.StatusMethodNotAllowed, errAPIMethodNotAllowed)
+		}
+		return
+	}
+
+	id := parts[1]
+	switch {
+	case r.Method == http.MethodGet && res.get != nil:
+		v, err := res.get(id)
+		if err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, v)
+	case (r.Method == http.MethodPut || r.Method == http.MethodPatch) && res.update != nil:
+		if _, err := res.get(id); err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		body, err := readAPIBody(w, r)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		v, err := res.update(id, body, user.Username)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, v)
+	case r.Method == http.MethodDelete && res.remove != nil:
+		if _, err := res.get(id); err != nil {
+			writeAPIError(w, apiErrorStatus(err), err)
+			return
+		}
+		if err := res.remove(id, user.Username); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, errAPIMethodNotAllowed)
+	}
+}
+
+// apiList paginates with limit and offset query parameters
+func (s *server) apiList(w http.ResponseWriter, r *http.Request, res apiResource) {
+	v, err := res.list(r)
+	if err != nil {
+		log.Error.Printf("API list %s failed: %s", r.URL.Path, err)
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rows, err := toAPIRows(v)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	q := r.URL.Query()
+	limit, err := parseAPIInt(q.Get("limit"), apiDefaultLimit)
+	if err != nil || limit <= 0 {
+		writeAPIError(w, http.StatusBadRequest, errors.New("invalid limit"))
+		return
+	}
+	if limit > apiMaxLimit {
+		limit = apiMaxLimit
+	}
+	offset, err := parseAPIInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeAPIError(w, http.StatusBadRequest, errors.New("invalid offset"))
+		return
+	}
+	resp := model.PaginationResponse{
+		Total: len(rows),
+		Data:  make([]map[string]interface{}, 0, limit),
+	}
+	if offset < len(rows) {
+		end := offset + limit
+		if end > len(rows) {
+			end = len(rows)
+		}
+		resp.Data = append(resp.Data, rows[offset:end]...)
+	}
+	if offset+limit < len(rows) {
+		resp.NextURL = apiPageURL(r, limit, offset+limit)
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		resp.PreviousURL = apiPageURL(r, limit, prev)
+	}
+	writeAPIJSON(w, http.StatusOK, resp)
+}
+
+func parseAPIInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func apiPageURL(r *http.Request, limit, offset int) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	q := r.URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	return fmt.Sprintf("%s://%s%s?%s", scheme, r.Host, r.URL.Path, q.Encode())
+}
+
+func toAPIRows(v interface{}) ([]map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0, 10)
+	err = json.Unmarshal(raw, &rows)
+	return rows, err
+}
+
+func readAPIBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxBodySize))
+}
+
+// decodeAPIBody decodes the body onto v, so that only the given fields are changed
+func decodeAPIBody(body []byte, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid body: %s", err)
+	}
+	return nil
+}
+
+func apiErrorStatus(err error) int {
+	if errors.Is(err, core.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error.Printf("Write API response failed: %s", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"detail": err.Error()})
+}
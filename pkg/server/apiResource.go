@@ -0,0 +1,320 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/model"
+)
+
+// apiUser carries the secrets which are not part of the user
+type apiUser struct {
+	*model.User
+	Password       *string   `json:"password"`
+	AuthorizedKeys *[]string `json:"authorized_keys"`
+}
+
+type apiSystemUser struct {
+	*model.SystemUser
+	Password   *string `json:"password"`
+	PrivateKey *string `json:"private_key"`
+}
+
+type apiGateway struct {
+	*model.Gateway
+	Password   *string `json:"password"`
+	PrivateKey *string `json:"private_key"`
+}
+
+func (s *server) apiUserResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadUser,
+		writePerm: model.PermWriteUser,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllUsers()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetUserById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			user := model.User{Role: model.RoleUser, IsActive: true}
+			req := apiUser{User: &user}
+			if err := decodeAPIBody(body, &req); err != nil {
+				return nil, err
+			}
+			var pass string
+			var keys []string
+			if req.Password != nil {
+				pass = *req.Password
+			}
+			if req.AuthorizedKeys != nil {
+				keys = *req.AuthorizedKeys
+			}
+			err := s.core.AddUser(&user, pass, keys, admin)
+			return user, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			user, err := s.core.GetUserById(id)
+			if err != nil {
+				return nil, err
+			}
+			req := apiUser{User: &user}
+			if err = decodeAPIBody(body, &req); err != nil {
+				return nil, err
+			}
+			user.ID = id
+			if err = s.core.UpdateUser(&user, admin); err != nil {
+				return nil, err
+			}
+			if req.Password != nil {
+				if err = s.core.SetUserPassword(id, *req.Password, admin); err != nil {
+					return nil, err
+				}
+			}
+			if req.AuthorizedKeys != nil {
+				if err = s.core.SetUserAuthorizedKeys(id, *req.AuthorizedKeys, admin); err != nil {
+					return nil, err
+				}
+			}
+			return user, nil
+		},
+		remove: s.core.DeleteUser,
+	}
+}
+
+func (s *server) apiAssetResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllAssets()
+		},
+		get: func(id string) (interface{}, error) {
+			asset, err := s.core.GetAssetById(id)
+			if err == nil && asset.ID == "" {
+				err = fmt.Errorf("asset %s %w", id, core.ErrNotFound)
+			}
+			return asset, err
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			asset := model.Asset{IsActive: true}
+			if err := decodeAPIBody(body, &asset); err != nil {
+				return nil, err
+			}
+			err := s.core.AddAsset(&asset, admin)
+			return asset, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			asset, err := s.core.GetAssetById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeAPIBody(body, &asset); err != nil {
+				return nil, err
+			}
+			asset.ID = id
+			err = s.core.UpdateAsset(&asset, admin)
+			return asset, err
+		},
+		remove: s.core.DeleteAsset,
+	}
+}
+
+func (s *server) apiNodeResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllNodes()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetNodeById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			node := model.Node{}
+			if err := decodeAPIBody(body, &node); err != nil {
+				return nil, err
+			}
+			err := s.core.AddNode(&node, admin)
+			return node, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			node, err := s.core.GetNodeById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeAPIBody(body, &node); err != nil {
+				return nil, err
+			}
+			node.ID = id
+			err = s.core.UpdateNode(&node, admin)
+			return node, err
+		},
+		remove: s.core.DeleteNode,
+	}
+}
+
+func (s *server) apiSystemUserResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllSystemUsers()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetSystemUserById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			sys := model.SystemUser{}
+			if err := decodeSystemUser(body, &sys); err != nil {
+				return nil, err
+			}
+			err := s.core.AddSystemUser(&sys, admin)
+			return sys, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			sys, err := s.core.GetSystemUserById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeSystemUser(body, &sys); err != nil {
+				return nil, err
+			}
+			sys.ID = id
+			err = s.core.UpdateSystemUser(&sys, admin)
+			return sys, err
+		},
+		remove: s.core.DeleteSystemUser,
+	}
+}
+
+func decodeSystemUser(body []byte, sys *model.SystemUser) error {
+	req := apiSystemUser{SystemUser: sys}
+	if err := decodeAPIBody(body, &req); err != nil {
+		return err
+	}
+	if req.Password != nil {
+		sys.Password = *req.Password
+	}
+	if req.PrivateKey != nil {
+		sys.PrivateKey = *req.PrivateKey
+	}
+	return nil
+}
+
+func (s *server) apiGrantResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllAssetUserInfos()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetAssetUserInfoById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			au := model.AssetUserInfo{}
+			if err := decodeAPIBody(body, &au); err != nil {
+				return nil, err
+			}
+			err := s.core.AddAssetUserInfo(&au, admin)
+			return au, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			au, err := s.core.GetAssetUserInfoById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeAPIBody(body, &au); err != nil {
+				return nil, err
+			}
+			au.ID = id
+			err = s.core.UpdateAssetUserInfo(&au, admin)
+			return au, err
+		},
+		remove: s.core.DeleteAssetUserInfo,
+	}
+}
+
+func (s *server) apiCommandFilterResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllCommandFilters()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetCommandFilterById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			f := model.CommandFilter{IsActive: true}
+			if err := decodeAPIBody(body, &f); err != nil {
+				return nil, err
+			}
+			err := s.core.AddCommandFilter(&f, admin)
+			return f, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			f, err := s.core.GetCommandFilterById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeAPIBody(body, &f); err != nil {
+				return nil, err
+			}
+			f.ID = id
+			err = s.core.UpdateCommandFilter(&f, admin)
+			return f, err
+		},
+		remove: s.core.DeleteCommandFilter,
+	}
+}
+
+func (s *server) apiGatewayResource() apiResource {
+	return apiResource{
+		readPerm:  model.PermReadAsset,
+		writePerm: model.PermWriteAsset,
+		list: func(r *http.Request) (interface{}, error) {
+			return s.core.GetAllGateways()
+		},
+		get: func(id string) (interface{}, error) {
+			return s.core.GetGatewayById(id)
+		},
+		create: func(body []byte, admin string) (interface{}, error) {
+			g := model.Gateway{IsActive: true}
+			if err := decodeGateway(body, &g); err != nil {
+				return nil, err
+			}
+			err := s.core.AddGateway(&g, admin)
+			return g, err
+		},
+		update: func(id string, body []byte, admin string) (interface{}, error) {
+			g, err := s.core.GetGatewayById(id)
+			if err != nil {
+				return nil, err
+			}
+			if err = decodeGateway(body, &g); err != nil {
+				return nil, err
+			}
+			g.ID = id
+			err = s.core.UpdateGateway(&g, admin)
+			return g, err
+		},
+		remove: s.core.DeleteGateway,
+	}
+}
+
+func decodeGateway(body []byte, g *model.Gateway) error {
+	req := apiGateway{Gateway: g}
+	if err := decodeAPIBody(body, &req); err != nil {
+		return err
+	}
+	if req.Password != nil {
+		g.Password = *req.Password
+	}
+	if req.PrivateKey != nil {
+		g.PrivateKey = *req.PrivateKey
+	}
+	return nil
+}
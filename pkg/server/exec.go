@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/handewo/gojump/pkg/auth"
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/ops"
+	"github.com/handewo/gojump/pkg/proxy"
+	"github.com/handewo/gojump/pkg/srvconn"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const exitStatusFailed = 255
+
+// proxyExec runs the command of the exec request on the asset of the direct login format,
+// stdout, stderr and the exit status are passed back unchanged.
+func (s *server) proxyExec(sess ssh.Session, user *model.User, directLogin map[string]string) error {
+	asset, sysUser, err := s.core.QueryDirectLoginInfo(user.ID, directLogin)
+	if err != nil {
+		return err
+	}
+	expireInfo, err := s.checkDirectLogin(sess.Context(), user, &asset, &sysUser)
+	if err != nil {
+		return err
+	}
+	command := sess.RawCommand()
+	sessionID := common.UUID()
+	if err = s.checkExecCommand(sess, sessionID, user, &asset, &sysUser, command); err != nil {
+		return err
+	}
+
+	sshClient, err := s.dialAsset(user, &asset, &sysUser)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	goSess, err := sshClient.AcquireSession()
+	if err != nil {
+		return fmt.Errorf("get SSH session failed: %s", err)
+	}
+	defer goSess.Close()
+	defer sshClient.ReleaseSession(goSess)
+	stdin, err := goSess.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("get SSH session StdinPipe failed: %s", err)
+	}
+	cs := s.startChannelSession(sess.Context(), sessionID, "exec", user, &asset, &sysUser)
+	defer cs.End()
+	goSess.Stdout = cs.ActiveWriter(sess)
+	goSess.Stderr = cs.ActiveWriter(sess.Stderr())
+	if err = goSess.Start(command); err != nil {
+		return fmt.Errorf("start command failed: %s", err)
+	}
+
+	// VS Code runs its server by exec, and forwards the ports of it
+	if config.GlobalConfig.EnableLocalPortForward {
+		if vscodePerm, _ := s.core.QueryAssetUserVscodePerm(user.ID, asset.ID); vscodePerm {
+			reqId, _ := sess.Context().Value(ctxID).(string)
+			vsReq := &vscodeReq{
+				reqId:      reqId,
+				user:       user,
+				client:     sshClient,
+				expireInfo: expireInfo,
+			}
+			s.addVSCodeReq(vsReq)
+			defer s.deleteVSCodeReq(vsReq)
+		}
+	}
+	target := fmt.Sprintf("%s as %s", asset.Name, sysUser.Username)
+	log.Info.Printf("Session[%s] User %s exec command on %s", sessionID[:8], user.Username, sshClient)
+
+	go func() {
+		_, _ = io.Copy(cs.ActiveWriter(stdin), sess)
+		_ = stdin.Close()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- goSess.Wait()
+	}()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case err = <-done:
+			status := 0
+			var exitErr *gossh.ExitError
+			switch {
+			case errors.As(err, &exitErr):
+				status = exitErr.ExitStatus()
+			case err != nil:
+				status = exitStatusFailed
+			}
+			s.core.InsertLog("exec", user.Username, fmt.Sprintf("exec `%s` on %s, exit status %d",
+				command, target, status))
+			_ = sess.Exit(status)
+			return nil
+		case <-cs.Context().Done():
+			if admin := cs.TerminateAdmin(); admin != "" {
+				log.Info.Printf("Session[%s] User %s end exec on %s as terminated by admin %s", sessionID[:8],
+					user.Username, sshClient, admin)
+				s.core.InsertLog("exec", user.Username, fmt.Sprintf("exec `%s` on %s, terminated by admin %s",
+					command, target, admin))
+				common.IgnoreErrWriteString(sess.Stderr(), fmt.Sprintf("Terminated by admin %s\n", admin))
+				_ = sess.Exit(exitStatusFailed)
+				return nil
+			}
+			log.Info.Printf("Session[%s] User %s end exec on %s as session done", sessionID[:8],
+				user.Username, sshClient)
+			s.core.InsertLog("exec", user.Username, fmt.Sprintf("exec `%s` on %s, interrupted", command, target))
+			return nil
+		case now := <-ticker.C:
+			if expireInfo.IsExpired(now) {
+				log.Info.Printf("Session[%s] User %s end exec on %s as permission has expired", sessionID[:8],
+					user.Username, sshClient)
+				s.core.InsertLog("exec", user.Username, fmt.Sprintf("exec `%s` on %s, permission expired",
+					command, target))
+				return nil
+			}
+		}
+	}
+}
+
+// checkExecCommand checks the command against the command filters, and records it
+func (s *server) checkExecCommand(sess ssh.Session, sessionID string, user *model.User, asset *model.Asset,
+	sysUser *model.SystemUser, command string) error {
+	f, err := s.core.MatchCommandFilter(user.ID, asset.ID, sysUser.ID, command)
+	if err != nil {
+		return fmt.Errorf("load command filters failed: %s", err)
+	}
+	level := model.RiskNormal
+	if f != nil {
+		level = model.FilterActionLevel(f.Action)
+	}
+	s.core.InsertCommandLog(&model.CommandLog{
+		SessionID:  sessionID,
+		User:       user.String(),
+		Asset:      asset.String(),
+		AssetID:    asset.ID,
+		SystemUser: sysUser.Username,
+		Command:    command,
+		RiskLevel:  level,
+	})
+	if f == nil {
+		return nil
+	}
+	s.core.LogFilteredCommand(f, user.String(), asset.String(), sysUser.Username, command)
+	switch f.Action {
+	case model.FilterWarn:
+		// the output of the command must be unchanged, so the warning is only recorded
+		return nil
+	case model.FilterConfirm:
+		srv := auth.NewLoginConfirm(s.core,
+			auth.ConfirmWithUser(user),
+			auth.ConfirmWithSystemUser(sysUser),
+			auth.ConfirmWithAssetID(asset.ID),
+			auth.ConfirmWithAssetName(asset.Name),
+		)
+		if err = srv.RequestCommandConfirm(command); err != nil {
+			return fmt.Errorf("request command confirm failed: %s", err)
+		}
+		switch srv.WaitLoginConfirm(sess.Context()) {
+		case auth.StatusApprove:
+			s.core.InsertLog("command", user.String(), fmt.Sprintf("command `%s` on %s is approved by %s",
+				command, asset.String(), srv.GetApprover()))
+			return nil
+		case auth.StatusReject:
+			return fmt.Errorf("command is rejected by %s", srv.GetApprover())
+		case auth.StatusExpire:
+			return errors.New("ticket expired")
+		default:
+			return errors.New("cancel confirm")
+		}
+	default:
+		return fmt.Errorf("command is forbidden by the filter %s", f.Name)
+	}
+}
+
+// checkDirectLogin applies the expiry and login confirm checks of the grant
+func (s *server) checkDirectLogin(ctx context.Context, user *model.User, asset *model.Asset,
+	sysUser *model.SystemUser) (*model.ExpireInfo, error) {
+	expireInfo, err := s.core.QueryAssetUserExpire(user.ID, asset.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get asset expire info err: %s", err)
+	}
+	if expireInfo.IsExpired(time.Now()) {
+		return nil, errors.New("your permission to login to this asset has expired")
+	}
+	// the client has no terminal to show the progress, so only the result is written to stderr
+	srv := auth.NewLoginConfirm(s.core,
+		auth.ConfirmWithUser(user),
+		auth.ConfirmWithSystemUser(sysUser),
+		auth.ConfirmWithAssetID(asset.ID),
+		auth.ConfirmWithAssetName(asset.Name),
+	)
+	need, err := srv.CheckIsNeedLoginConfirm()
+	if err != nil {
+		return nil, fmt.Errorf("validate login confirm err: %s", err)
+	}
+	if !need {
+		return expireInfo, nil
+	}
+	// the reason can not be asked without a terminal
+	if err = srv.RequestLoginConfirm("", ""); err != nil {
+		return nil, fmt.Errorf("request login confirm err: %s", err)
+	}
+	log.Info.Printf("User %s waits for the login confirm of %s", user.Username, asset.Name)
+	switch srv.WaitLoginConfirm(ctx) {
+	case auth.StatusApprove:
+		return expireInfo, nil
+	case auth.StatusReject:
+		return nil, fmt.Errorf("%s rejected", srv.GetApprover())
+	case auth.StatusExpire:
+		return nil, errors.New("ticket expired")
+	default:
+		return nil, errors.New("cancel confirm")
+	}
+}
+
+// startChannelSession adds the proxied channel to the live sessions, its context is done if it's killed
+func (s *server) startChannelSession(ctx ssh.Context, id string, protocol string, user *model.User,
+	asset *model.Asset, sysUser *model.SystemUser) *proxy.ChannelSession {
+	host, _, _ := net.SplitHostPort(ctx.RemoteAddr().String())
+	return proxy.StartChannelSession(ctx, s.core, model.Session{
+		ID:           id,
+		User:         user.String(),
+		LoginFrom:    "ST",
+		RemoteAddr:   host,
+		Protocol:     protocol,
+		UserID:       user.ID,
+		SystemUser:   sysUser.Username,
+		SystemUserID: sysUser.ID,
+		Asset:        asset.String(),
+		AssetID:      asset.ID,
+	})
+}
+
+// dialAsset logs in to the asset by the secrets of the system user on it
+func (s *server) dialAsset(user *model.User, asset *model.Asset, sysUser *model.SystemUser) (*srvconn.SSHClient, error) {
+	loginUser := *sysUser
+	if err := s.core.ApplyAssetSecret(asset.ID, &loginUser); err != nil {
+		return nil, fmt.Errorf("get secret of system user err: %s", err)
+	}
+	return ops.DialAsset(s.core, user.Username, asset, &loginUser)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/handewo/gojump/pkg/auth"
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/config"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/ops"
+	"github.com/handewo/gojump/pkg/srvconn"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// countWriter counts the bytes written by io.Copy
+type countWriter struct {
+	w     io.Writer
+	count int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.count, int64(n))
+	return n, err
+}
+
+// ProxyJumpChannelHandler forwards the direct-tcpip channel to the ssh port of an asset granted to the user,
+// so that "ssh -J user@gojump sysuser@asset" works, the client authenticates with the asset itself.
+func (s *server) ProxyJumpChannelHandler(ctx ssh.Context, newChan gossh.NewChannel, host string, port uint32) {
+	user, ok := ctx.Value(auth.ContextKeyUser).(*model.User)
+	if !ok || user.ID == "" {
+		_ = newChan.Reject(gossh.Prohibited, "not auth user")
+		return
+	}
+	if user.OTPLevel == model.OTPLevelTOTP && !s.core.IsTOTPEnrolled(user) {
+		_ = newChan.Reject(gossh.Prohibited, "TOTP authenticator is not enrolled, login with PTY to enroll")
+		return
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	asset, err := s.core.GetGrantedAssetByAddr(user.ID, host, int(port))
+	if err != nil {
+		log.Info.Printf("User %s forwarding to %s denied: %s", user.Username, dest, err)
+		s.core.InsertLog("forward", user.Username, fmt.Sprintf("denied forwarding to %s", dest))
+		_ = newChan.Reject(gossh.Prohibited, "no permission to forward to "+dest)
+		return
+	}
+	// the system user is chosen by the client, which is unknown here
+	expireInfo, err := s.checkDirectLogin(ctx, user, &asset, &model.SystemUser{})
+	if err != nil {
+		_ = newChan.Reject(gossh.Prohibited, err.Error())
+		return
+	}
+	gateways, err := ops.AssetGateways(s.core, user.Username, &asset)
+	if err != nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(asset.IP, strconv.Itoa(int(port)))
+	dConn, err := srvconn.DialGateway(addr, config.GlobalConfig.SSHTimeout, gateways...)
+	if err != nil {
+		_ = newChan.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+	defer dConn.Close()
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go gossh.DiscardRequests(reqs)
+
+	target := fmt.Sprintf("%s(%s)", asset.Name, addr)
+	start := time.Now()
+	cs := s.startChannelSession(ctx, common.UUID(), "forward", user, &asset, &model.SystemUser{})
+	defer cs.End()
+	s.core.InsertLog("forward", user.Username, fmt.Sprintf("start forwarding to %s", target))
+	log.Info.Printf("Session[%s] User %s start forwarding to %s", cs.ID[:8], user.Username, target)
+	sent := &countWriter{w: cs.ActiveWriter(dConn)}
+	received := &countWriter{w: cs.ActiveWriter(ch)}
+	defer func() {
+		msg := fmt.Sprintf("end forwarding to %s, %d bytes sent, %d bytes received in %s", target,
+			atomic.LoadInt64(&sent.count), atomic.LoadInt64(&received.count), time.Since(start).Round(time.Second))
+		s.core.InsertLog("forward", user.Username, msg)
+		log.Info.Printf("User %s %s", user.Username, msg)
+	}()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(sent, ch)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(received, dConn)
+		done <- struct{}{}
+	}()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-cs.Context().Done():
+			if admin := cs.TerminateAdmin(); admin != "" {
+				log.Info.Printf("User %s end forwarding to %s as terminated by admin %s", user.Username, target, admin)
+				s.core.InsertLog("forward", user.Username, fmt.Sprintf("forwarding to %s terminated by admin %s",
+					target, admin))
+			}
+			return
+		case now := <-ticker.C:
+			if expireInfo.IsExpired(now) {
+				log.Info.Printf("User %s end forwarding to %s as permission has expired", user.Username, target)
+				return
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -16,6 +17,9 @@ import (
 	"github.com/handewo/gojump/pkg/core"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
+	"github.com/handewo/gojump/pkg/notify"
+	"github.com/handewo/gojump/pkg/ops"
+	"github.com/handewo/gojump/pkg/proxy"
 	"github.com/pires/go-proxyproto"
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -24,6 +28,7 @@ type server struct {
 	terminalConf atomic.Value
 	core         *core.Core
 	srv          *ssh.Server
+	apiSrv       *http.Server
 	sync.Mutex
 	vscodeClients map[string]*vscodeReq
 }
@@ -60,6 +65,10 @@ func Run(cfg string, isDaemon bool) {
 	srv := NewServer(core)
 	srv.initSSHServer()
 	go srv.Serve()
+	if config.GlobalConfig.APIPort != "" {
+		srv.initAPIServer()
+		go srv.ServeAPI()
+	}
 	defer srv.Shutdown()
 	<-gracefulStop
 }
@@ -75,6 +84,12 @@ func NewServer(c *core.Core) *server {
 	}
 	srv.UpdateTerminalConfig(terminalConf)
 	go srv.updateTermCfgPeriodcally()
+	go ops.RunRotation(c)
+	go ops.RunHealthCheck(c)
+	go proxy.RunReplayUpload()
+	go proxy.RunReplayJanitor(c)
+	go c.RunTicketJanitor()
+	go notify.Run(c)
 	return &srv
 }
 
@@ -95,6 +110,7 @@ func (s *server) Shutdown() {
 	defer log.Close()
 	defer s.core.Close()
 	defer cancelFunc()
+	s.ShutdownAPI(ctx)
 	if err := s.srv.Shutdown(ctx); err != nil {
 		log.Fatal.Print(err)
 	}
@@ -109,8 +125,17 @@ func (s *server) initSSHServer() {
 		PublicKeyHandler: func(ctx ssh.Context, key ssh.PublicKey) bool {
 			return s.PublicKeyAuth(ctx, key)
 		},
+		KeyboardInteractiveHandler: func(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+			return s.KeyboardInteractiveAuth(ctx, challenger)
+		},
+		NextAuthMethodsHandler: func(ctx ssh.Context) []string {
+			return s.NextAuthMethodsHandler(ctx)
+		},
 		HostSigners: []ssh.Signer{s.GetSSHSigner()},
 		Handler:     s.SessionHandler,
+		SubsystemHandlers: map[string]ssh.SubsystemHandler{
+			"sftp": s.SFTPHandler,
+		},
 		LocalPortForwardingCallback: func(ctx ssh.Context, destinationHost string, destinationPort uint32) bool {
 			return s.LocalPortForwardingPermission(ctx, destinationHost, destinationPort)
 		},
@@ -123,12 +148,15 @@ func (s *server) initSSHServer() {
 					return
 				}
 
-				if srv.LocalPortForwardingCallback == nil || !srv.LocalPortForwardingCallback(ctx, localD.DestAddr, localD.DestPort) {
-					_ = newChan.Reject(gossh.Prohibited, "port forwarding is disabled")
+				// forwarding of VS Code, otherwise ProxyJump to the granted assets
+				reqId, _ := ctx.Value(ctxID).(string)
+				if srv.LocalPortForwardingCallback != nil && srv.LocalPortForwardingCallback(ctx, localD.DestAddr, localD.DestPort) &&
+					s.getVSCodeReq(reqId) != nil {
+					dest := net.JoinHostPort(localD.DestAddr, strconv.FormatInt(int64(localD.DestPort), 10))
+					s.DirectTCPIPChannelHandler(ctx, newChan, dest)
 					return
 				}
-				dest := net.JoinHostPort(localD.DestAddr, strconv.FormatInt(int64(localD.DestPort), 10))
-				s.DirectTCPIPChannelHandler(ctx, newChan, dest)
+				s.ProxyJumpChannelHandler(ctx, newChan, localD.DestAddr, localD.DestPort)
 			},
 		},
 	}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/handewo/gojump/pkg/auth"
+	"github.com/handewo/gojump/pkg/common"
+	"github.com/handewo/gojump/pkg/log"
+	"github.com/handewo/gojump/pkg/model"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var ErrNoTransferPerm = errors.New("no permission to transfer files with the asset")
+
+// SFTPHandler proxies the sftp subsystem to the asset of the direct login format user@sysuser@asset
+func (s *server) SFTPHandler(sess ssh.Session) {
+	user, ok := sess.Context().Value(auth.ContextKeyUser).(*model.User)
+	if !ok || user.ID == "" {
+		log.Error.Printf("SSH User %s not found, exit.", sess.User())
+		return
+	}
+	if user.OTPLevel == model.OTPLevelTOTP && !s.core.IsTOTPEnrolled(user) {
+		common.IgnoreErrWriteString(sess.Stderr(), "TOTP authenticator is not enrolled, login with PTY to enroll.\n")
+		return
+	}
+	directLogin, ok := sess.Context().Value(auth.ContextKeyDirectLoginFormat).(map[string]string)
+	if !ok {
+		common.IgnoreErrWriteString(sess.Stderr(), "Login as user@sysuser@asset to transfer files.\n")
+		return
+	}
+	if err := s.proxyFileTransfer(sess, user, directLogin, nil); err != nil {
+		log.Error.Printf("User %s sftp err: %s", user.Username, err)
+		common.IgnoreErrWriteString(sess.Stderr(), err.Error()+"\n")
+	}
+}
+
+// proxyFileTransfer runs the sftp subsystem, or the scp command if cmd is not nil, on the asset
+func (s *server) proxyFileTransfer(sess ssh.Session, user *model.User, directLogin map[string]string,
+	cmd *scpCommand) error {
+	asset, sysUser, err := s.core.QueryDirectLoginInfo(user.ID, directLogin)
+	if err != nil {
+		return err
+	}
+	perm, err := s.core.QueryAssetUserSFTPPerm(user.ID, asset.ID)
+	if err != nil {
+		return fmt.Errorf("get asset sftp permission err: %s", err)
+	}
+	if !perm {
+		log.Info.Printf("%s has no permission to transfer files with %s", user.Username, asset.Name)
+		return ErrNoTransferPerm
+	}
+	expireInfo, err := s.checkDirectLogin(sess.Context(), user, &asset, &sysUser)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := s.dialAsset(user, &asset, &sysUser)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+	goSess, err := sshClient.AcquireSession()
+	if err != nil {
+		return fmt.Errorf("get SSH session failed: %s", err)
+	}
+	defer goSess.Close()
+	defer sshClient.ReleaseSession(goSess)
+	stdout, err := goSess.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("get SSH session StdoutPipe failed: %s", err)
+	}
+	stdin, err := goSess.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("get SSH session StdinPipe failed: %s", err)
+	}
+	goSess.Stderr = sess.Stderr()
+
+	tl := &transferLogger{
+		core:     s.core,
+		protocol: "sftp",
+		username: user.Username,
+		target:   fmt.Sprintf("%s as %s", asset.Name, sysUser.Username),
+	}
+	var clientW, serverW io.Writer = stdin, sess
+	if cmd == nil {
+		if err = goSess.RequestSubsystem("sftp"); err != nil {
+			return fmt.Errorf("request sftp subsystem failed: %s", err)
+		}
+		auditor := newSFTPAuditor(tl)
+		defer auditor.close()
+		clientW = &auditWriter{w: stdin, feed: auditor.feedClient}
+		serverW = &auditWriter{w: sess, feed: auditor.feedServer}
+	} else {
+		tl.protocol = "scp"
+		if err = goSess.Start(cmd.String()); err != nil {
+			return fmt.Errorf("start scp failed: %s", err)
+		}
+		auditor := &scpAuditor{log: tl, cmd: cmd}
+		if cmd.upload {
+			clientW = &auditWriter{w: stdin, feed: auditor.feed}
+		} else {
+			serverW = &auditWriter{w: sess, feed: auditor.feed}
+		}
+	}
+	cs := s.startChannelSession(sess.Context(), common.UUID(), tl.protocol, user, &asset, &sysUser)
+	defer cs.End()
+	s.core.InsertLog(tl.protocol, user.Username, fmt.Sprintf("%s connect to %s", tl.protocol, tl.target))
+	defer s.core.InsertLog(tl.protocol, user.Username, fmt.Sprintf("%s disconnect to %s", tl.protocol, tl.target))
+	log.Info.Printf("Session[%s] User %s start %s to %s", cs.ID[:8], user.Username, tl.protocol, sshClient)
+
+	go func() {
+		_, _ = io.Copy(cs.ActiveWriter(clientW), sess)
+		_ = stdin.Close()
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = io.Copy(cs.ActiveWriter(serverW), stdout)
+	}()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			err = goSess.Wait()
+			log.Info.Printf("User %s end %s to %s", user.Username, tl.protocol, sshClient)
+			var exitErr *gossh.ExitError
+			if errors.As(err, &exitErr) {
+				_ = sess.Exit(exitErr.ExitStatus())
+			}
+			return nil
+		case <-cs.Context().Done():
+			if admin := cs.TerminateAdmin(); admin != "" {
+				log.Info.Printf("User %s end %s to %s as terminated by admin %s", user.Username, tl.protocol,
+					sshClient, admin)
+				tl.insert("terminated by admin %s", admin)
+				common.IgnoreErrWriteString(sess.Stderr(), fmt.Sprintf("Terminated by admin %s\n", admin))
+				return nil
+			}
+			log.Info.Printf("User %s end %s to %s as session done", user.Username, tl.protocol, sshClient)
+			return nil
+		case now := <-ticker.C:
+			if expireInfo.IsExpired(now) {
+				log.Info.Printf("User %s end %s to %s as permission has expired", user.Username,
+					tl.protocol, sshClient)
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/handewo/gojump/pkg/core"
+	"github.com/handewo/gojump/pkg/log"
+)
+
+// the packet types and flags of SFTP version 3
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRmdir    = 15
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpExtended = 200
+
+	sftpFlagWrite  = 0x02
+	sftpFlagAppend = 0x04
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+
+	sftpStatusOK = 0
+
+	// OpenSSH limits the packet to 256KB, the other servers may use larger ones, so up to 1MB is accepted
+	maxSFTPPacket = 1 << 20
+)
+
+// transferLogger writes the file transfers to USERLOG
+type transferLogger struct {
+	core     *core.Core
+	protocol string
+	username string
+	target   string
+}
+
+func (t *transferLogger) insert(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	t.core.InsertLog(t.protocol, t.username, fmt.Sprintf("%s on %s", msg, t.target))
+}
+
+func (t *transferLogger) insertFile(action string, name string, size int64) {
+	t.insert("%s %s (%d bytes)", action, name, size)
+}
+
+// auditWriter passes the data to the auditor after it is written
+type auditWriter struct {
+	w    io.Writer
+	feed func(p []byte)
+}
+
+func (a *auditWriter) Write(p []byte) (int, error) {
+	n, err := a.w.Write(p)
+	a.feed(p[:n])
+	return n, err
+}
+
+type sftpPacketReader struct {
+	buf    []byte
+	broken bool
+	handle func(typ byte, data sftpPayload)
+	// stop is called once the packets can't be followed any more
+	stop func(length uint32)
+}
+
+func (r *sftpPacketReader) feed(p []byte) {
+	if r.broken {
+		return
+	}
+	r.buf = append(r.buf, p...)
+	for len(r.buf) >= 4 {
+		n := binary.BigEndian.Uint32(r.buf)
+		if n == 0 || n > maxSFTPPacket {
+			log.Error.Printf("Invalid SFTP packet length %d, stop auditing", n)
+			r.broken = true
+			r.buf = nil
+			r.stop(n)
+			return
+		}
+		if uint32(len(r.buf)-4) < n {
+			break
+		}
+		// only the version is in the payload of init and version
+		if typ := r.buf[4]; typ != sftpInit && typ != sftpVersion {
+			r.handle(typ, r.buf[5:4+n])
+		}
+		r.buf = r.buf[4+n:]
+	}
+	r.buf = append([]byte(nil), r.buf...)
+}
+
+type sftpPayload []byte
+
+func (d *sftpPayload) uint32() (uint32, bool) {
+	if len(*d) < 4 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint32(*d)
+	*d = (*d)[4:]
+	return v, true
+}
+
+func (d *sftpPayload) string() (string, bool) {
+	n, ok := d.uint32()
+	if !ok || uint32(len(*d)) < n {
+		return "", false
+	}
+	v := string((*d)[:n])
+	*d = (*d)[n:]
+	return v, true
+}
+
+type sftpRequest struct {
+	typ     byte
+	path    string
+	newPath string
+	handle  string
+	flags   uint32
+	size    int64
+}
+
+type sftpFile struct {
+	path    string
+	write   bool
+	read    int64
+	written int64
+}
+
+// sftpAuditor follows the requests of the client and the responses of the server,
+// and logs the uploads, downloads, renames and deletes which succeed.
+type sftpAuditor struct {
+	sync.Mutex
+	log *transferLogger
+
+	requests map[uint32]sftpRequest
+	files    map[string]*sftpFile
+
+	client sftpPacketReader
+	server sftpPacketReader
+}
+
+func newSFTPAuditor(l *transferLogger) *sftpAuditor {
+	a := &sftpAuditor{
+		log:      l,
+		requests: make(map[uint32]sftpRequest),
+		files:    make(map[string]*sftpFile),
+	}
+	a.client.handle = a.handleRequest
+	a.server.handle = a.handleResponse
+	a.client.stop = func(n uint32) { a.log.insert("audit stopped, invalid packet length %d from the client", n) }
+	a.server.stop = func(n uint32) { a.log.insert("audit stopped, invalid packet length %d from the server", n) }
+	return a
+}
+
+func (a *sftpAuditor) feedClient(p []byte) {
+	a.Lock()
+	defer a.Unlock()
+	a.client.feed(p)
+}
+
+func (a *sftpAuditor) feedServer(p []byte) {
+	a.Lock()
+	defer a.Unlock()
+	a.server.feed(p)
+}
+
+func (a *sftpAuditor) handleRequest(typ byte, data sftpPayload) {
+	id, ok := data.uint32()
+	if !ok {
+		return
+	}
+	req := sftpRequest{typ: typ}
+	switch typ {
+	case sftpOpen:
+		req.path, _ = data.string()
+		req.flags, _ = data.uint32()
+	case sftpClose, sftpRead:
+		req.handle, _ = data.string()
+	case sftpWrite:
+		req.handle, _ = data.string()
+		// skip the offset
+		_, _ = data.uint32()
+		_, _ = data.uint32()
+		n, _ := data.uint32()
+		req.size = int64(n)
+	case sftpRemove, sftpMkdir, sftpRmdir:
+		req.path, _ = data.string()
+	case sftpRename:
+		req.path, _ = data.string()
+		req.newPath, _ = data.string()
+	case sftpExtended:
+		if name, _ := data.string(); name != "posix-rename@openssh.com" {
+			return
+		}
+		req.typ = sftpRename
+		req.path, _ = data.string()
+		req.newPath, _ = data.string()
+	default:
+		return
+	}
+	a.requests[id] = req
+}
+
+func (a *sftpAuditor) handleResponse(typ byte, data sftpPayload) {
+	id, ok := data.uint32()
+	if !ok {
+		return
+	}
+	req, ok := a.requests[id]
+	if !ok {
+		return
+	}
+	delete(a.requests, id)
+	switch typ {
+	case sftpHandle:
+		if req.typ != sftpOpen {
+			return
+		}
+		if handle, ok := data.string(); ok {
+			write := req.flags&(sftpFlagWrite|sftpFlagAppend|sftpFlagCreate|sftpFlagTrunc) != 0
+			a.files[handle] = &sftpFile{path: req.path, write: write}
+		}
+	case sftpData:
+		if f, ok := a.files[req.handle]; ok && req.typ == sftpRead {
+			n, _ := data.uint32()
+			f.read += int64(n)
+		}
+	case sftpStatus:
+		code, _ := data.uint32()
+		if req.typ == sftpClose {
+			a.closeFile(req.handle)
+			return
+		}
+		if code != sftpStatusOK {
+			return
+		}
+		switch req.typ {
+		case sftpWrite:
+			if f, ok := a.files[req.handle]; ok {
+				f.written += req.size
+			}
+		case sftpRemove:
+			a.log.insert("delete %s", req.path)
+		case sftpRmdir:
+			a.log.insert("delete directory %s", req.path)
+		case sftpMkdir:
+			a.log.insert("create directory %s", req.path)
+		case sftpRename:
+			a.log.insert("rename %s to %s", req.path, req.newPath)
+		}
+	}
+}
+
+func (a *sftpAuditor) closeFile(handle string) {
+	f, ok := a.files[handle]
+	if !ok {
+		return
+	}
+	delete(a.files, handle)
+	if f.write || f.written > 0 {
+		a.log.insertFile("upload", f.path, f.written)
+	}
+	if f.read > 0 {
+		a.log.insertFile("download", f.path, f.read)
+	}
+}
+
+// close logs the files which are not closed before the connection ends
+func (a *sftpAuditor) close() {
+	a.Lock()
+	defer a.Unlock()
+	for handle := range a.files {
+		a.closeFile(handle)
+	}
+}
+
+// scpCommand is the scp command run by the client on the remote side
+type scpCommand struct {
+	upload bool
+	args   []string
+	paths  []string
+}
+
+func isSCPCommand(args []string) bool {
+	return len(args) > 0 && args[0] == "scp"
+}
+
+// parseSCPCommand accepts "scp [-r] [-p] [-d] [-v] -t|-f [--] PATH..." only
+func parseSCPCommand(args []string) (*scpCommand, error) {
+	if len(args) < 2 || !isSCPCommand(args) {
+		return nil, fmt.Errorf("not a scp command")
+	}
+	cmd := &scpCommand{args: args}
+	var to, from, endFlags bool
+	for _, arg := range args[1:] {
+		if endFlags || !strings.HasPrefix(arg, "-") {
+			cmd.paths = append(cmd.paths, arg)
+			continue
+		}
+		if arg == "--" {
+			endFlags = true
+			continue
+		}
+		for _, f := range arg[1:] {
+			switch f {
+			case 't':
+				to = true
+			case 'f':
+				from = true
+			case 'r', 'p', 'd', 'v':
+			default:
+				return nil, fmt.Errorf("unsupported scp flag -%c", f)
+			}
+		}
+	}
+	if to == from || len(cmd.paths) == 0 {
+		return nil, fmt.Errorf("invalid scp command")
+	}
+	cmd.upload = to
+	return cmd, nil
+}
+
+// String quotes the arguments for the shell of the asset
+func (c *scpCommand) String() string {
+	quoted := make([]string, 0, len(c.args))
+	for _, arg := range c.args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+// scpAuditor parses the stream of the source side, which is the client for uploads and
+// the asset for downloads, and logs every copied file.
+type scpAuditor struct {
+	log    *transferLogger
+	cmd    *scpCommand
+	dirs   []string
+	line   []byte
+	inLine bool
+
+	name   string
+	size   int64
+	remain int64
+}
+
+func (a *scpAuditor) feed(p []byte) {
+	for len(p) > 0 {
+		if a.remain > 0 {
+			n := int64(len(p))
+			if n > a.remain {
+				n = a.remain
+			}
+			a.remain -= n
+			p = p[n:]
+			if a.remain == 0 {
+				a.logFile()
+			}
+			continue
+		}
+		b := p[0]
+		p = p[1:]
+		if a.inLine {
+			if b == '\n' {
+				a.handleLine(string(a.line))
+				a.line = a.line[:0]
+				a.inLine = false
+			} else {
+				a.line = append(a.line, b)
+			}
+			continue
+		}
+		switch b {
+		case 'C', 'D', 'E', 'T', 0x01, 0x02:
+			a.inLine = true
+			a.line = append(a.line[:0], b)
+		}
+	}
+}
+
+func (a *scpAuditor) handleLine(line string) {
+	switch line[0] {
+	case 'C':
+		fields := strings.SplitN(line[1:], " ", 3)
+		if len(fields) != 3 {
+			return
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return
+		}
+		a.name = path.Join(append(a.dirs, fields[2])...)
+		a.size = size
+		a.remain = size
+		if size == 0 {
+			a.logFile()
+		}
+	case 'D':
+		if fields := strings.SplitN(line[1:], " ", 3); len(fields) == 3 {
+			a.dirs = append(a.dirs, fields[2])
+		}
+	case 'E':
+		if len(a.dirs) > 0 {
+			a.dirs = a.dirs[:len(a.dirs)-1]
+		}
+	}
+}
+
+func (a *scpAuditor) logFile() {
+	paths := strings.Join(a.cmd.paths, " ")
+	if a.cmd.upload {
+		a.log.insert("upload %s (%d bytes) to %s", a.name, a.size, paths)
+		return
+	}
+	a.log.insert("download %s (%d bytes) from %s", a.name, a.size, paths)
+}
@@ -60,7 +60,16 @@ func (s *server) PublicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
 	return sshAuthHandler(ctx, "", publicKey)
 }
 
+func (s *server) KeyboardInteractiveAuth(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+	sshAuthHandler := auth.SSHTOTPAuth(s.core)
+	return sshAuthHandler(ctx, challenger)
+}
+
 func (s *server) NextAuthMethodsHandler(ctx ssh.Context) []string {
+	user, ok := ctx.Value(auth.ContextKeyUser).(*model.User)
+	if !ok || !auth.NeedTOTP(s.core, user) {
+		return nil
+	}
 	return []string{nextAuthMethod}
 }
 
@@ -71,6 +80,13 @@ func (s *server) SessionHandler(sess ssh.Session) {
 		common.IgnoreErrWriteString(sess, "Not auth user.\n")
 		return
 	}
+	if user.OTPLevel == model.OTPLevelTOTP && !s.core.IsTOTPEnrolled(user) {
+		if _, _, isPty := sess.Pty(); !isPty || !handler.EnrollTOTP(sess, s.core, user) {
+			log.Info.Printf("User %s has not enrolled totp authenticator, exit.", user.Username)
+			common.IgnoreErrWriteString(sess, "TOTP authenticator is not enrolled, login with PTY to enroll.\n")
+			return
+		}
+	}
 	termConf := s.GetTerminalConfig()
 	directLogin := sess.Context().Value(auth.ContextKeyDirectLoginFormat)
 
@@ -90,7 +106,7 @@ func (s *server) SessionHandler(sess ssh.Session) {
 		defer s.core.InteractiveLog(sess.User())
 		log.Debug.Printf("User %s request pty %s", sess.User(), pty.Term)
 		go interactiveSrv.WatchWinSizeChange(winChan)
-		if user.Username == "admin" {
+		if user.Role == model.RoleAdmin {
 			interactiveSrv.AdminSystem()
 			return
 		}
@@ -99,6 +115,30 @@ func (s *server) SessionHandler(sess ssh.Session) {
 		return
 	}
 
+	if directLogin, ok := directLogin.(map[string]string); ok && isSCPCommand(sess.Command()) {
+		cmd, err := parseSCPCommand(sess.Command())
+		if err != nil {
+			common.IgnoreErrWriteString(sess.Stderr(), err.Error()+"\n")
+			_ = sess.Exit(1)
+			return
+		}
+		if err := s.proxyFileTransfer(sess, user, directLogin, cmd); err != nil {
+			log.Error.Printf("User %s scp err: %s", user.Username, err)
+			common.IgnoreErrWriteString(sess.Stderr(), err.Error()+"\n")
+			_ = sess.Exit(1)
+		}
+		return
+	}
+
+	if directLogin, ok := directLogin.(map[string]string); ok && sess.RawCommand() != "" {
+		if err := s.proxyExec(sess, user, directLogin); err != nil {
+			log.Error.Printf("User %s exec err: %s", user.Username, err)
+			common.IgnoreErrWriteString(sess.Stderr(), err.Error()+"\n")
+			_ = sess.Exit(exitStatusFailed)
+		}
+		return
+	}
+
 	if !config.GlobalConfig.EnableLocalPortForward {
 		common.IgnoreErrWriteString(sess, "No PTY requested.\n")
 		return
@@ -175,10 +215,9 @@ func (s *server) proxyVscode(sess ssh.Session, user *model.User, directLogin map
 		log.Info.Printf("%s has no permission to login to %s in vscode", user.Username, asset.Name)
 		return nil
 	}
-	sshAuthOpts := srvconn.BuildSSHClientOptions(&asset, &sysUser)
-	sshClient, err := srvconn.NewSSHClient(sshAuthOpts...)
+	sshClient, err := s.dialAsset(user, &asset, &sysUser)
 	if err != nil {
-		return fmt.Errorf("get SSH Client failed: %s", err)
+		return err
 	}
 	defer sshClient.Close()
 	vsReq := &vscodeReq{
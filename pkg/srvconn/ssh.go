@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/handewo/gojump/pkg/common"
 	"github.com/handewo/gojump/pkg/config"
 	"github.com/handewo/gojump/pkg/log"
 	"github.com/handewo/gojump/pkg/model"
@@ -179,6 +180,10 @@ type SSHClientOptions struct {
 	Timeout      int
 	keyboardAuth gossh.KeyboardInteractiveChallenge
 	PrivateAuth  gossh.Signer
+
+	hostKeyCallback gossh.HostKeyCallback
+
+	proxySSHClientOptions []SSHClientOptions
 }
 
 func (cfg *SSHClientOptions) AuthMethods() []gossh.AuthMethod {
@@ -280,6 +285,19 @@ func SSHClientKeyboardAuth(keyboardAuth gossh.KeyboardInteractiveChallenge) SSHC
 	}
 }
 
+func SSHClientHostKeyCallback(hostKeyCallback gossh.HostKeyCallback) SSHClientOption {
+	return func(conf *SSHClientOptions) {
+		conf.hostKeyCallback = hostKeyCallback
+	}
+}
+
+// SSHClientProxyClient sets the gateways to reach the host, they are tried in order until one works
+func SSHClientProxyClient(proxyArgs ...SSHClientOptions) SSHClientOption {
+	return func(args *SSHClientOptions) {
+		args.proxySSHClientOptions = proxyArgs
+	}
+}
+
 func NewSSHClient(opts ...SSHClientOption) (*SSHClient, error) {
 	cfg := &SSHClientOptions{
 		Host: "127.0.0.1",
@@ -292,19 +310,85 @@ func NewSSHClient(opts ...SSHClientOption) (*SSHClient, error) {
 }
 
 var (
+	ErrNoAvailable = errors.New("no available gateway")
 	ErrGatewayDial = errors.New("gateway dial addr failed")
 	ErrSSHClient   = errors.New("new ssh client failed")
 )
 
+// getAvailableProxyClient connects to the gateways in order, and returns the first one which reaches destAddr
+func getAvailableProxyClient(destAddr string, cfgs ...SSHClientOptions) (*SSHClient, net.Conn, error) {
+	var err error
+	for i := range cfgs {
+		var proxyClient *SSHClient
+		proxyClient, err = NewSSHClientWithCfg(&cfgs[i])
+		if err != nil {
+			log.Error.Printf("Connect gateway %s:%s err: %s", cfgs[i].Host, cfgs[i].Port, err)
+			continue
+		}
+		var destConn net.Conn
+		destConn, err = proxyClient.Dial("tcp", destAddr)
+		if err != nil {
+			_ = proxyClient.Close()
+			err = fmt.Errorf("%w: %s", ErrGatewayDial, err)
+			log.Error.Printf("Gateway client(%s) dial %s err: %s", proxyClient, destAddr, err)
+			continue
+		}
+		log.Info.Printf("Get gateway client(%s) success ", proxyClient)
+		return proxyClient, destConn, nil
+	}
+	return nil, nil, fmt.Errorf("%w: %s", ErrNoAvailable, err)
+}
+
+// gatewayConn closes the gateway client with the connection
+type gatewayConn struct {
+	net.Conn
+	client *SSHClient
+}
+
+func (g *gatewayConn) Close() error {
+	err := g.Conn.Close()
+	_ = g.client.Close()
+	return err
+}
+
+// DialGateway connects to addr through the first available gateway, or directly if there is none.
+func DialGateway(addr string, timeout int, gateways ...SSHClientOptions) (net.Conn, error) {
+	if len(gateways) == 0 {
+		return net.DialTimeout("tcp", addr, time.Duration(timeout)*time.Second)
+	}
+	proxyClient, destConn, err := getAvailableProxyClient(addr, gateways...)
+	if err != nil {
+		return nil, err
+	}
+	return &gatewayConn{Conn: destConn, client: proxyClient}, nil
+}
+
 func NewSSHClientWithCfg(cfg *SSHClientOptions) (*SSHClient, error) {
 	gosshCfg := gossh.ClientConfig{
 		User:            cfg.Username,
 		Auth:            cfg.AuthMethods(),
 		Timeout:         time.Duration(cfg.Timeout) * time.Second,
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback: cfg.hostKeyCallback,
 		Config:          createSSHConfig(),
 	}
 	destAddr := net.JoinHostPort(cfg.Host, cfg.Port)
+	if len(cfg.proxySSHClientOptions) > 0 {
+		proxyClient, destConn, err := getAvailableProxyClient(destAddr, cfg.proxySSHClientOptions...)
+		if err != nil {
+			log.Error.Printf("Get gateway client err: %s", err)
+			return nil, err
+		}
+		proxyConn, chans, reqs, err := gossh.NewClientConn(destConn, destAddr, &gosshCfg)
+		if err != nil {
+			_ = proxyClient.Close()
+			_ = destConn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSSHClient, err)
+		}
+		gosshClient := gossh.NewClient(proxyConn, chans, reqs)
+		return &SSHClient{Cfg: cfg, Client: gosshClient,
+			traceSessionMap: make(map[*gossh.Session]time.Time),
+			ProxyClient:     proxyClient}, nil
+	}
 	gosshClient, err := gossh.Dial("tcp", destAddr, &gosshCfg)
 	if err != nil {
 		return nil, err
@@ -386,25 +470,73 @@ var (
 	}
 )
 
-func BuildSSHClientOptions(asset *model.Asset, systemUser *model.SystemUser) []SSHClientOption {
+// BuildSSHClientOptions builds the options to login to the asset, through the gateways if any.
+// The secrets of the system user are decrypted here only.
+func BuildSSHClientOptions(asset *model.Asset, systemUser *model.SystemUser,
+	gateways ...SSHClientOptions) ([]SSHClientOption, error) {
+	password, err := common.DecryptSecret(systemUser.Password)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt password of system user %s err: %w", systemUser.Username, err)
+	}
+	privateKey, err := common.DecryptSecret(systemUser.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key of system user %s err: %w", systemUser.Username, err)
+	}
 	timeout := config.GlobalConfig.SSHTimeout
 	sshAuthOpts := make([]SSHClientOption, 0, 6)
 	sshAuthOpts = append(sshAuthOpts, SSHClientUsername(systemUser.Username))
 	sshAuthOpts = append(sshAuthOpts, SSHClientHost(asset.IP))
 	sshAuthOpts = append(sshAuthOpts, SSHClientPort(asset.ProtocolPort(systemUser.Protocol)))
-	sshAuthOpts = append(sshAuthOpts, SSHClientPassword(systemUser.Password))
+	sshAuthOpts = append(sshAuthOpts, SSHClientPassword(password))
 	sshAuthOpts = append(sshAuthOpts, SSHClientTimeout(timeout))
-	if systemUser.PrivateKey != "" {
+	if privateKey != "" {
 		// 先使用 password 解析 PrivateKey
-		if signer, err1 := gossh.ParsePrivateKeyWithPassphrase([]byte(systemUser.PrivateKey),
-			[]byte(systemUser.Password)); err1 == nil {
+		if signer, err1 := gossh.ParsePrivateKeyWithPassphrase([]byte(privateKey),
+			[]byte(password)); err1 == nil {
 			sshAuthOpts = append(sshAuthOpts, SSHClientPrivateAuth(signer))
 		} else {
 			// 如果之前使用password解析失败，则去掉 password, 尝试直接解析 PrivateKey 防止错误的passphrase
-			if signer, err1 = gossh.ParsePrivateKey([]byte(systemUser.PrivateKey)); err1 == nil {
+			if signer, err1 = gossh.ParsePrivateKey([]byte(privateKey)); err1 == nil {
 				sshAuthOpts = append(sshAuthOpts, SSHClientPrivateAuth(signer))
 			}
 		}
 	}
-	return sshAuthOpts
+	if len(gateways) > 0 {
+		sshAuthOpts = append(sshAuthOpts, SSHClientProxyClient(gateways...))
+	}
+	return sshAuthOpts, nil
+}
+
+// BuildGatewayOptions builds the options of the gateway routes, the gateways to reach a gateway are
+// set as its proxies, so that the client dials hop by hop.
+func BuildGatewayOptions(routes []model.GatewayRoute,
+	hostKeyCallback func(gateway *model.Gateway) gossh.HostKeyCallback) ([]SSHClientOptions, error) {
+	res := make([]SSHClientOptions, 0, len(routes))
+	for i := range routes {
+		g := &routes[i].Gateway
+		password, err := common.DecryptSecret(g.Password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt password of gateway %s err: %w", g.Name, err)
+		}
+		privateKey, err := common.DecryptSecret(g.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt private key of gateway %s err: %w", g.Name, err)
+		}
+		via, err := BuildGatewayOptions(routes[i].Via, hostKeyCallback)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, SSHClientOptions{
+			Host:                  g.IP,
+			Port:                  strconv.Itoa(g.Port),
+			Username:              g.Username,
+			Password:              password,
+			PrivateKey:            privateKey,
+			Passphrase:            password,
+			Timeout:               config.GlobalConfig.SSHTimeout,
+			hostKeyCallback:       hostKeyCallback(g),
+			proxySSHClientOptions: via,
+		})
+	}
+	return res, nil
 }
@@ -41,6 +41,7 @@ type Server struct {
 	KeyboardInteractiveHandler    KeyboardInteractiveHandler    // keyboard-interactive authentication handler
 	PasswordHandler               PasswordHandler               // password authentication handler
 	PublicKeyHandler              PublicKeyHandler              // public key authentication handler
+	NextAuthMethodsHandler        NextAuthMethodsHandler        // further authentication methods after the first one, keyboard-interactive is only offered as a further method if set
 	PtyCallback                   PtyCallback                   // callback for allowing PTY sessions, allows all if nil
 	ConnCallback                  ConnCallback                  // optional callback for wrapping net.Conn before handling
 	LocalPortForwardingCallback   LocalPortForwardingCallback   // callback for allowing local port forwarding, denies all if nil
@@ -138,7 +139,7 @@ func (srv *Server) config(ctx Context) *gossh.ServerConfig {
 			if ok := srv.PasswordHandler(ctx, string(password)); !ok {
 				return ctx.Permissions().Permissions, fmt.Errorf("permission denied")
 			}
-			return ctx.Permissions().Permissions, nil
+			return ctx.Permissions().Permissions, srv.nextAuthMethods(ctx)
 		}
 	}
 	if srv.PublicKeyHandler != nil {
@@ -148,19 +149,44 @@ func (srv *Server) config(ctx Context) *gossh.ServerConfig {
 				return ctx.Permissions().Permissions, fmt.Errorf("permission denied")
 			}
 			ctx.SetValue(ContextKeyPublicKey, key)
-			return ctx.Permissions().Permissions, nil
+			return ctx.Permissions().Permissions, srv.nextAuthMethods(ctx)
 		}
 	}
-	if srv.KeyboardInteractiveHandler != nil {
-		config.KeyboardInteractiveCallback = func(conn gossh.ConnMetadata, challenger gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
-			applyConnMetadata(ctx, conn)
-			if ok := srv.KeyboardInteractiveHandler(ctx, challenger); !ok {
-				return ctx.Permissions().Permissions, fmt.Errorf("permission denied")
+	if srv.KeyboardInteractiveHandler != nil && srv.NextAuthMethodsHandler == nil {
+		config.KeyboardInteractiveCallback = srv.keyboardInteractiveCallback(ctx)
+	}
+	return config
+}
+
+func (srv *Server) keyboardInteractiveCallback(ctx Context) func(conn gossh.ConnMetadata, challenger gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+	return func(conn gossh.ConnMetadata, challenger gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+		applyConnMetadata(ctx, conn)
+		if ok := srv.KeyboardInteractiveHandler(ctx, challenger); !ok {
+			return ctx.Permissions().Permissions, fmt.Errorf("permission denied")
+		}
+		return ctx.Permissions().Permissions, nil
+	}
+}
+
+// nextAuthMethods returns a partial success error carrying the callbacks of
+// the further authentication methods, or nil if no further method is required.
+func (srv *Server) nextAuthMethods(ctx Context) error {
+	if srv.NextAuthMethodsHandler == nil {
+		return nil
+	}
+	var next gossh.ServerAuthCallbacks
+	for _, method := range srv.NextAuthMethodsHandler(ctx) {
+		switch method {
+		case "keyboard-interactive":
+			if srv.KeyboardInteractiveHandler != nil {
+				next.KeyboardInteractiveCallback = srv.keyboardInteractiveCallback(ctx)
 			}
-			return ctx.Permissions().Permissions, nil
 		}
 	}
-	return config
+	if next.KeyboardInteractiveCallback == nil {
+		return nil
+	}
+	return &gossh.PartialSuccessError{Next: next}
 }
 
 // Handle sets the Handler for the server.
@@ -44,6 +44,11 @@ type PasswordHandler func(ctx Context, password string) bool
 // KeyboardInteractiveHandler is a callback for performing keyboard-interactive authentication.
 type KeyboardInteractiveHandler func(ctx Context, challenger gossh.KeyboardInteractiveChallenge) bool
 
+// NextAuthMethodsHandler is a callback returning the further authentication
+// methods a client must pass after a successful password or public key
+// authentication. No further method is required if it returns an empty list.
+type NextAuthMethodsHandler func(ctx Context) []string
+
 // PtyCallback is a hook for allowing PTY sessions.
 type PtyCallback func(ctx Context, pty Pty) bool
 
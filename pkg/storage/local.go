@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps the replays in the replay folder, where they are recorded
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+func (l *LocalStorage) TypeName() string {
+	return TypeLocal
+}
+
+// Upload does nothing, the file is already in the storage
+func (l *LocalStorage) Upload(target, path string) error {
+	return nil
+}
+
+func (l *LocalStorage) Download(target string, w io.Writer) error {
+	f, err := os.Open(l.path(target))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (l *LocalStorage) Delete(target string) error {
+	return os.Remove(l.path(target))
+}
+
+func (l *LocalStorage) List() ([]Object, error) {
+	res := make([]Object, 0, 64)
+	err := filepath.WalkDir(l.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == l.root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, Object{Target: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	return res, err
+}
+
+// path keeps the target under the root
+func (l *LocalStorage) path(target string) string {
+	return filepath.Join(l.root, filepath.Clean("/"+strings.TrimPrefix(target, "/")))
+}
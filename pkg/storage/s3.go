@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3DefaultRegion = "us-east-1"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3TimeFormat    = "20060102T150405Z"
+	s3Timeout       = 5 * time.Minute
+)
+
+type S3Config struct {
+	// such as https://s3.amazonaws.com or http://127.0.0.1:9000 of MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Storage keeps the replays in a bucket of an S3 compatible storage, the requests are signed by
+// signature version 4 and use the path style.
+type S3Storage struct {
+	conf     S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Storage(conf S3Config) (*S3Storage, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, errors.New("the endpoint and the bucket of s3 are required")
+	}
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %s", conf.Endpoint)
+	}
+	if conf.Region == "" {
+		conf.Region = s3DefaultRegion
+	}
+	conf.Prefix = strings.Trim(conf.Prefix, "/")
+	return &S3Storage{
+		conf:     conf,
+		endpoint: u,
+		client:   &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+func (s *S3Storage) TypeName() string {
+	return TypeS3
+}
+
+// Upload puts the file with its MD5, which is checked by the storage before the object is saved
+func (s *S3Storage) Upload(target, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sha, md := sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, md), f)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := s.newRequest(http.MethodPut, s.key(target), nil, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md.Sum(nil)))
+	s.sign(req, hex.EncodeToString(sha.Sum(nil)))
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Download(target string, w io.Writer) error {
+	req, err := s.newRequest(http.MethodGet, s.key(target), nil, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptySHA256)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (s *S3Storage) Delete(target string) error {
+	req, err := s.newRequest(http.MethodDelete, s.key(target), nil, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, emptySHA256)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Storage) List() ([]Object, error) {
+	res := make([]Object, 0, 64)
+	prefix := ""
+	if s.conf.Prefix != "" {
+		prefix = s.conf.Prefix + "/"
+	}
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := s.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.sign(req, emptySHA256)
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range result.Contents {
+			res = append(res, Object{Target: strings.TrimPrefix(v.Key, prefix), Size: v.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return res, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3Storage) key(target string) string {
+	target = strings.TrimPrefix(target, "/")
+	if s.conf.Prefix == "" {
+		return target
+	}
+	return s.conf.Prefix + "/" + target
+}
+
+func (s *S3Storage) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = "/" + s.conf.Bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+	return http.NewRequest(method, u.String(), body)
+}
+
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var e struct {
+		Code    string
+		Message string
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&e)
+	if e.Code == "" {
+		return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s, %s", req.Method, req.URL.Path, e.Code, e.Message)
+}
+
+// sha256 of the empty body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds the authorization of signature version 4 to the request
+func (s *S3Storage) sign(req *http.Request, payloadHash string) {
+	now := time.Now().UTC()
+	amzDate := now.Format(s3TimeFormat)
+	scope := strings.Join([]string{now.Format("20060102"), s.conf.Region, "s3", "aws4_request"}, "/")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || lk == "content-md5" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.conf.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath encodes each byte except the unreserved characters and /
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || isS3Unreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3EscapeQuery(k)+"="+s3EscapeQuery(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3EscapeQuery(s string) string {
+	return strings.ReplaceAll(s3EscapePath(s), "/", "%2F")
+}
+
+func isS3Unreserved(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
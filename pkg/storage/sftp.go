@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const sftpTimeout = 30 * time.Second
+
+type SFTPConfig struct {
+	Addr     string
+	User     string
+	Password string
+	KeyFile  string
+	// the public key of the server in the format of authorized_keys
+	HostKey string
+	Path    string
+}
+
+// SFTPStorage keeps the replays under a folder of an SFTP server
+type SFTPStorage struct {
+	conf      SFTPConfig
+	sshConfig *gossh.ClientConfig
+}
+
+func NewSFTPStorage(conf SFTPConfig) (*SFTPStorage, error) {
+	if conf.Addr == "" || conf.User == "" {
+		return nil, errors.New("the address and the user of sftp are required")
+	}
+	if _, _, err := net.SplitHostPort(conf.Addr); err != nil {
+		conf.Addr = net.JoinHostPort(conf.Addr, "22")
+	}
+	if conf.HostKey == "" {
+		return nil, errors.New("the host key of the sftp server is required")
+	}
+	hostKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(conf.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key of the sftp server: %s", err)
+	}
+	auths := make([]gossh.AuthMethod, 0, 2)
+	if conf.KeyFile != "" {
+		raw, err := os.ReadFile(conf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := gossh.ParsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %s", conf.KeyFile, err)
+		}
+		auths = append(auths, gossh.PublicKeys(signer))
+	}
+	if conf.Password != "" {
+		auths = append(auths, gossh.Password(conf.Password))
+	}
+	if len(auths) == 0 {
+		return nil, errors.New("the password or the key file of sftp is required")
+	}
+	if conf.Path == "" {
+		conf.Path = "."
+	}
+	return &SFTPStorage{
+		conf: conf,
+		sshConfig: &gossh.ClientConfig{
+			User:            conf.User,
+			Auth:            auths,
+			HostKeyCallback: gossh.FixedHostKey(hostKey),
+			Timeout:         sftpTimeout,
+		},
+	}, nil
+}
+
+func (s *SFTPStorage) TypeName() string {
+	return TypeSFTP
+}
+
+// connect opens a new connection for each operation, the replays are not uploaded often
+func (s *SFTPStorage) connect() (*sftp.Client, func(), error) {
+	conn, err := gossh.Dial("tcp", s.conf.Addr, s.sshConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return client, func() {
+		client.Close()
+		conn.Close()
+	}, nil
+}
+
+// Upload writes a temporary file and renames it after the size is checked, so a broken upload
+// never leaves a partial replay.
+func (s *SFTPStorage) Upload(target, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	client, closer, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	dst := s.path(target)
+	if err = client.MkdirAll(path.Dir(dst)); err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	w, err := client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(w, f)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		var info os.FileInfo
+		if info, err = client.Stat(tmp); err == nil && info.Size() != size {
+			err = fmt.Errorf("uploaded %d bytes, but the remote file has %d bytes", size, info.Size())
+		}
+	}
+	if err == nil {
+		err = client.PosixRename(tmp, dst)
+	}
+	if err != nil {
+		_ = client.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *SFTPStorage) Download(target string, w io.Writer) error {
+	client, closer, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	f, err := client.Open(s.path(target))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (s *SFTPStorage) Delete(target string) error {
+	client, closer, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer closer()
+	return client.Remove(s.path(target))
+}
+
+func (s *SFTPStorage) List() ([]Object, error) {
+	client, closer, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	res := make([]Object, 0, 64)
+	walker := client.Walk(s.conf.Path)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == s.conf.Path && os.IsNotExist(err) {
+				return res, nil
+			}
+			return nil, err
+		}
+		info := walker.Stat()
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".part") {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), s.conf.Path), "/")
+		res = append(res, Object{Target: rel, Size: info.Size()})
+	}
+	return res, nil
+}
+
+// path keeps the target under the folder
+func (s *SFTPStorage) path(target string) string {
+	return path.Join(s.conf.Path, path.Clean("/"+target))
+}
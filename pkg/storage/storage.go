@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/handewo/gojump/pkg/config"
+)
+
+const (
+	TypeLocal = "local"
+	TypeS3    = "s3"
+	TypeSFTP  = "sftp"
+)
+
+// Object is a replay in the storage, the target is DATE/FILENAME
+type Object struct {
+	Target string
+	Size   int64
+}
+
+// ReplayStorage keeps the compressed replays. Upload returns after the storage has confirmed the
+// whole file, so the local file can be removed.
+type ReplayStorage interface {
+	TypeName() string
+	Upload(target, path string) error
+	Download(target string, w io.Writer) error
+	List() ([]Object, error)
+	Delete(target string) error
+}
+
+// NewReplayStorage returns the storage of REPLAY_STORAGE, the replays stay in REPLAY_PATH if it is local
+func NewReplayStorage(conf config.Config) (ReplayStorage, error) {
+	switch strings.ToLower(conf.ReplayStorage) {
+	case "", TypeLocal:
+		return NewLocalStorage(conf.ReplayFolderPath), nil
+	case TypeS3:
+		return NewS3Storage(S3Config{
+			Endpoint:  conf.ReplayS3Endpoint,
+			Region:    conf.ReplayS3Region,
+			Bucket:    conf.ReplayS3Bucket,
+			Prefix:    conf.ReplayS3Prefix,
+			AccessKey: conf.ReplayS3AccessKey,
+			SecretKey: conf.ReplayS3SecretKey,
+		})
+	case TypeSFTP:
+		return NewSFTPStorage(SFTPConfig{
+			Addr:     conf.ReplaySFTPAddr,
+			User:     conf.ReplaySFTPUser,
+			Password: conf.ReplaySFTPPassword,
+			KeyFile:  conf.ReplaySFTPKeyFile,
+			HostKey:  conf.ReplaySFTPHostKey,
+			Path:     conf.ReplaySFTPPath,
+		})
+	}
+	return nil, fmt.Errorf("unknown replay storage %s", conf.ReplayStorage)
+}